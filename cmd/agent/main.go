@@ -12,8 +12,11 @@ import (
 	"github.com/NikolosHGW/metric/internal/client/config"
 	"github.com/NikolosHGW/metric/internal/client/metrics"
 	"github.com/NikolosHGW/metric/internal/client/request"
+	"github.com/NikolosHGW/metric/internal/compress"
 	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
@@ -28,7 +31,34 @@ var (
 func main() {
 	config := config.NewConfig()
 
-	conn, err := grpc.NewClient(config.GetAddress(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	tlsConfig, err := tlsconfig.NewClientConfig(config.GetTLSOptions())
+	if err != nil {
+		log.Fatalf("invalid tls config: %v", err)
+	}
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	var interceptors []grpc.UnaryClientInterceptor
+	if config.GetToken() != "" {
+		interceptors = append(interceptors, request.NewTokenInterceptor(config.GetToken()))
+	}
+	if config.GetKey() != "" {
+		interceptors = append(interceptors, request.NewSignInterceptor(config.GetKey()))
+	}
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	}
+	if err := compress.ValidGRPC(config.GetGRPCCompressor()); err != nil {
+		log.Fatalf("invalid grpc compressor: %v", err)
+	}
+	if config.GetGRPCCompressor() != "" {
+		dialOptions = append(dialOptions, grpc.WithDefaultCallOptions(grpc.UseCompressor(config.GetGRPCCompressor())))
+	}
+
+	conn, err := grpc.NewClient(config.GetAddress(), dialOptions...)
 	if err != nil {
 		log.Fatalf("could not connect to gRPC server: %v", err)
 	}
@@ -0,0 +1,165 @@
+// Keytool утилита для работы с ключами шифрования метрик.
+//
+// Использование:
+//
+//	keytool generate -type rsa -bits 4096 -format pkcs1 -private server.pem -public agent.pem
+//	keytool inspect server.pem agent.pem
+//	keytool rotate -dir /etc/metric/keys -public agent.pem -keep 2
+//
+// Поддерживаемые типы ключей: rsa, ecdsa (P-256), x25519. Для шифрования тела запросов
+// сервер использует только RSA ключи, остальные типы пригодны, например, для TLS.
+// Приватные ключи пишутся в PKCS#1 (только RSA) или PKCS#8, публичные в PKCS#1 или PKIX.
+//
+// После rotate сервер, у которого в CRYPTO_KEY указана директория с ключами,
+// подхватывает новый ключ автоматически или по сигналу SIGHUP.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/NikolosHGW/metric/internal/crypto"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(fmt.Errorf("keytool: %w", err))
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("expected subcommand: generate, inspect or rotate")
+	}
+
+	switch args[0] {
+	case "generate":
+		return generate(args[1:], out)
+	case "inspect":
+		return inspect(args[1:], out)
+	case "rotate":
+		return rotate(args[1:], out)
+	}
+
+	return fmt.Errorf("unknown subcommand %q", args[0])
+}
+
+func generate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	keyType := fs.String("type", crypto.KeyTypeRSA, "key type: rsa, ecdsa or x25519")
+	bits := fs.Int("bits", crypto.DefaultRSABits, "RSA key size in bits")
+	format := fs.String("format", "", "private key format: pkcs1 or pkcs8 (default pkcs1 for rsa, pkcs8 otherwise)")
+	privatePath := fs.String("private", "private.pem", "path to private key")
+	publicPath := fs.String("public", "public.pem", "path to public key, empty to skip")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = crypto.FormatPKCS8
+		if *keyType == crypto.KeyTypeRSA {
+			*format = crypto.FormatPKCS1
+		}
+	}
+
+	privateKey, err := crypto.GenerateKey(*keyType, *bits)
+	if err != nil {
+		return err
+	}
+	privatePEM, err := crypto.EncodePrivateKeyPEM(privateKey, *format)
+	if err != nil {
+		return err
+	}
+	if err := crypto.WriteKeyFile(*privatePath, privatePEM, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "private key saved:", *privatePath)
+
+	if *publicPath == "" {
+		return nil
+	}
+
+	publicKey, err := crypto.PublicKeyOf(privateKey)
+	if err != nil {
+		return err
+	}
+	publicFormat := crypto.FormatPKIX
+	if *format == crypto.FormatPKCS1 {
+		publicFormat = crypto.FormatPKCS1
+	}
+	publicPEM, err := crypto.EncodePublicKeyPEM(publicKey, publicFormat)
+	if err != nil {
+		return err
+	}
+	if err := crypto.WriteKeyFile(*publicPath, publicPEM, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "public key saved:", *publicPath)
+
+	return nil
+}
+
+func inspect(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("inspect: expected at least one key file")
+	}
+
+	for _, path := range args {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := crypto.InspectPEM(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		kind := "public"
+		if info.Private {
+			kind = "private"
+		}
+		keyID := info.KeyID
+		if keyID == "" {
+			keyID = "-"
+		}
+		fmt.Fprintf(out, "%s: %s %s key, %d bits, format %s, key id %s\n",
+			path, info.Type, kind, info.Size, info.Format, keyID)
+	}
+
+	return nil
+}
+
+func rotate(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rotate", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory with active server private keys")
+	publicPath := fs.String("public", "", "path to write the new agent public key")
+	bits := fs.Int("bits", crypto.DefaultRSABits, "RSA key size in bits")
+	format := fs.String("format", crypto.FormatPKCS1, "private key format: pkcs1 or pkcs8")
+	keep := fs.Int("keep", 2, "number of newest private keys to keep active")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		return errors.New("rotate: -dir is required")
+	}
+
+	result, err := crypto.RotateKeys(*dir, *publicPath, *bits, *format, *keep)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "new key id:", result.KeyID)
+	fmt.Fprintln(out, "private key saved:", result.PrivateKeyPath)
+	if result.PublicKeyPath != "" {
+		fmt.Fprintln(out, "public key saved:", result.PublicKeyPath)
+	}
+	for _, path := range result.Removed {
+		fmt.Fprintln(out, "old key removed:", path)
+	}
+
+	return nil
+}
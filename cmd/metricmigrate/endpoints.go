@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NikolosHGW/metric/internal/client/request"
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/NikolosHGW/metric/internal/server/storage"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	grpcScheme = "grpc://"
+	fileScheme = "file:"
+	// pgScheme префикс для DSN в формате key=value
+	pgScheme     = "pg:"
+	sqliteScheme = "sqlite:"
+	boltScheme   = "bolt:"
+)
+
+// ErrNotSource приёмник, из которого нельзя выгрузить метрики
+var ErrNotSource = errors.New("endpoint cannot be a migration source")
+
+// endpointStorage выгрузка, чтение по имени и запись метрик, они повторяют методы
+// services.Repository и storage.Storage
+type endpointStorage interface {
+	ExportMetrics(context.Context) ([]models.Metrics, error)
+	GetMetric(context.Context, string) (models.Metrics, error)
+	UpsertMetrics(context.Context, models.MetricCollection) (models.MetricCollection, error)
+}
+
+// endpoint хранилище, между которыми переносятся метрики
+type endpoint interface {
+	endpointStorage
+	Close() error
+}
+
+// importer хранилище, в которое метрики можно записать как есть, не суммируя counter
+type importer interface {
+	ImportMetrics(context.Context, []models.Metrics) error
+}
+
+// flusher хранилище, которое дописывает данные на диск после переноса
+type flusher interface {
+	Flush() error
+}
+
+type endpointOptions struct {
+	format string
+	// source хранилище читается, файл снимка обязан существовать
+	source bool
+	token  string
+	key    string
+	tls    tlsconfig.Options
+}
+
+// openEndpoint открывает хранилище по адресу: grpc://host:port, postgres://..., pg:key=value,
+// sqlite:path, bolt:path или путь к файлу снимка, в том числе с префиксом file:
+func openEndpoint(spec string, opts endpointOptions) (endpoint, error) {
+	switch {
+	case strings.HasPrefix(spec, grpcScheme):
+		return openGRPC(strings.TrimPrefix(spec, grpcScheme), opts)
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		return openDB(spec)
+	case strings.HasPrefix(spec, pgScheme):
+		return openDB(strings.TrimPrefix(spec, pgScheme))
+	case strings.HasPrefix(spec, boltScheme):
+		return storage.NewBoltStorage(strings.TrimPrefix(spec, boltScheme), zap.NewNop(), 0)
+	case strings.HasPrefix(spec, sqliteScheme):
+		return openSQLite(strings.TrimPrefix(strings.TrimPrefix(spec, sqliteScheme+"//"), sqliteScheme))
+	case spec == "":
+		return nil, errors.New("empty endpoint")
+	}
+
+	return openFile(strings.TrimPrefix(spec, fileScheme), opts)
+}
+
+// dbStorage хранилище в базе: DBStorage или SQLiteStorage
+type dbStorage interface {
+	endpointStorage
+	importer
+}
+
+type dbEndpoint struct {
+	dbStorage
+	db *sqlx.DB
+}
+
+func openDB(dsn string) (*dbEndpoint, error) {
+	database, err := db.InitDB(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbEndpoint{
+		dbStorage: storage.NewDBStorage(database, zap.NewNop()),
+		db:        database,
+	}, nil
+}
+
+func openSQLite(path string) (*dbEndpoint, error) {
+	database, err := db.InitSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbEndpoint{
+		dbStorage: storage.NewSQLiteStorage(database, zap.NewNop()),
+		db:        database,
+	}, nil
+}
+
+func (e *dbEndpoint) Close() error {
+	return e.db.Close()
+}
+
+// fileEndpoint снимок на диске. Записанные метрики сохраняются в Flush,
+// после чего GetMetric читает уже записанный файл
+type fileEndpoint struct {
+	metrics map[string]models.Metrics
+	path    string
+	format  string
+	order   []string
+	dirty   bool
+}
+
+func openFile(path string, opts endpointOptions) (*fileEndpoint, error) {
+	if err := storage.ValidSnapshotFormat(opts.format); err != nil {
+		return nil, err
+	}
+
+	e := &fileEndpoint{
+		metrics: make(map[string]models.Metrics),
+		path:    path,
+		format:  opts.format,
+	}
+	if err := e.load(); err != nil && (opts.source || !errors.Is(err, os.ErrNotExist)) {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *fileEndpoint) load() error {
+	file, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	metrics, err := storage.ReadSnapshot(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.path, err)
+	}
+
+	e.metrics = make(map[string]models.Metrics, len(metrics))
+	e.order = e.order[:0]
+	e.set(metrics)
+
+	return nil
+}
+
+func (e *fileEndpoint) set(metrics []models.Metrics) {
+	for _, m := range metrics {
+		if _, ok := e.metrics[m.ID]; !ok {
+			e.order = append(e.order, m.ID)
+		}
+		e.metrics[m.ID] = m
+	}
+}
+
+func (e *fileEndpoint) ExportMetrics(context.Context) ([]models.Metrics, error) {
+	metrics := make([]models.Metrics, 0, len(e.order))
+	for _, id := range e.order {
+		metrics = append(metrics, e.metrics[id])
+	}
+
+	return metrics, nil
+}
+
+func (e *fileEndpoint) ImportMetrics(_ context.Context, metrics []models.Metrics) error {
+	e.set(metrics)
+	e.dirty = true
+
+	return nil
+}
+
+func (e *fileEndpoint) UpsertMetrics(ctx context.Context, mc models.MetricCollection) (models.MetricCollection, error) {
+	return mc, e.ImportMetrics(ctx, mc.Metrics)
+}
+
+func (e *fileEndpoint) GetMetric(_ context.Context, name string) (models.Metrics, error) {
+	metric, ok := e.metrics[name]
+	if !ok {
+		return models.Metrics{}, fmt.Errorf("%s metric not found", name)
+	}
+
+	return metric, nil
+}
+
+func (e *fileEndpoint) Flush() error {
+	if !e.dirty {
+		return nil
+	}
+
+	metrics, _ := e.ExportMetrics(context.Background())
+	if err := storage.WriteSnapshotFile(e.path, e.format, metrics); err != nil {
+		return err
+	}
+	e.dirty = false
+
+	return e.load()
+}
+
+func (e *fileEndpoint) Close() error {
+	return e.Flush()
+}
+
+// grpcEndpoint работающий сервер. В gRPC API нет перечисления метрик,
+// поэтому сервер может быть только приёмником, а counter на нём суммируются
+type grpcEndpoint struct {
+	conn   *grpc.ClientConn
+	client proto.MetricServiceClient
+}
+
+func openGRPC(address string, opts endpointOptions) (*grpcEndpoint, error) {
+	transportCredentials := insecure.NewCredentials()
+	tlsConfig, err := tlsconfig.NewClientConfig(opts.tls)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	var interceptors []grpc.UnaryClientInterceptor
+	if opts.token != "" {
+		interceptors = append(interceptors, request.NewTokenInterceptor(opts.token))
+	}
+	if opts.key != "" {
+		interceptors = append(interceptors, request.NewSignInterceptor(opts.key))
+	}
+
+	conn, err := grpc.NewClient(address,
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s: %w", address, err)
+	}
+
+	return &grpcEndpoint{
+		conn:   conn,
+		client: proto.NewMetricServiceClient(conn),
+	}, nil
+}
+
+func (e *grpcEndpoint) ExportMetrics(context.Context) ([]models.Metrics, error) {
+	return nil, fmt.Errorf("%w: gRPC API cannot list metrics", ErrNotSource)
+}
+
+func (e *grpcEndpoint) UpsertMetrics(ctx context.Context, mc models.MetricCollection) (models.MetricCollection, error) {
+	req := &proto.UpsertMetricRequest{}
+	for _, m := range mc.Metrics {
+		metric := &proto.Metric{Id: m.ID, Type: m.MType}
+		if m.Value != nil {
+			metric.Value = *m.Value
+		}
+		if m.Delta != nil {
+			metric.Delta = *m.Delta
+		}
+		req.Metrics = append(req.Metrics, metric)
+	}
+
+	if _, err := e.client.UpsertMetrics(ctx, req); err != nil {
+		return mc, err
+	}
+
+	return mc, nil
+}
+
+func (e *grpcEndpoint) GetMetric(ctx context.Context, name string) (models.Metrics, error) {
+	resp, err := e.client.GetMetric(ctx, &proto.MetricRequest{Id: name})
+	if err != nil {
+		return models.Metrics{}, err
+	}
+
+	metric := models.Metrics{ID: resp.GetId(), MType: resp.GetType()}
+	if metric.MType == models.CounterType {
+		delta := resp.GetDelta()
+		metric.Delta = &delta
+	} else {
+		value := resp.GetValue()
+		metric.Value = &value
+	}
+
+	return metric, nil
+}
+
+func (e *grpcEndpoint) Close() error {
+	return e.conn.Close()
+}
@@ -2,28 +2,46 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	_ "net/http/pprof"
 
+	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	_ "github.com/NikolosHGW/metric/internal/compress" // компрессоры gzip и zstd для gRPC
+	"github.com/NikolosHGW/metric/internal/crypto"
+	"github.com/NikolosHGW/metric/internal/netfilter"
 	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/ratelimit"
+	"github.com/NikolosHGW/metric/internal/server/auth"
 	"github.com/NikolosHGW/metric/internal/server/config"
 	"github.com/NikolosHGW/metric/internal/server/db"
 	"github.com/NikolosHGW/metric/internal/server/grpcserver"
+	"github.com/NikolosHGW/metric/internal/server/handlers"
 	"github.com/NikolosHGW/metric/internal/server/interceptor"
 	"github.com/NikolosHGW/metric/internal/server/logger"
+	"github.com/NikolosHGW/metric/internal/server/middlewares"
+	"github.com/NikolosHGW/metric/internal/server/routes"
 	"github.com/NikolosHGW/metric/internal/server/services"
 	"github.com/NikolosHGW/metric/internal/server/storage"
+	"github.com/NikolosHGW/metric/internal/signature"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
 )
 
+const shutdownTimeout = 5 * time.Second
+
 const defaultTagValue = "N/A"
 
 var (
@@ -45,9 +63,27 @@ func run() error {
 		return err
 	}
 
-	database, err := db.InitDB(config.GetDBConnection())
-	if err != nil {
-		logger.Log.Info("init db", zap.Error(err))
+	var database *sqlx.DB
+	var boltStrg *storage.BoltStorage
+	var err error
+	if config.GetKVPath() != "" {
+		boltStrg, err = storage.NewBoltStorage(config.GetKVPath(), logger.Log, config.GetKVHistoryBucket())
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := boltStrg.Close(); err != nil {
+				logger.Log.Info("err close kv storage", zap.Error(err))
+			}
+		}()
+	} else if config.GetDBConnection() != "" {
+		database, err = db.Open(config.GetDBDriver(), config.GetDBConnection())
+		if errors.Is(err, db.ErrSQLiteUnavailable) {
+			return err
+		}
+		if err != nil {
+			logger.Log.Info("init db", zap.Error(err))
+		}
 	}
 	if database != nil {
 		defer func() {
@@ -59,19 +95,137 @@ func run() error {
 	}
 
 	strg := storage.NewMemStorage()
-	metricService := services.NewMetricService(strg)
-	if database != nil {
+	var repo services.Repository = strg
+	var snapshotStrg storage.Storage = strg
+	var seriesStore services.SeriesStore = strg
+	var health *db.HealthChecker
+	var buffered *storage.BufferedStorage
+	var partitions *db.Partitions
+	var historyStore services.HistoryStore
+	var rawRetention time.Duration
+	if boltStrg != nil {
+		repo = boltStrg
+		snapshotStrg = boltStrg
+		seriesStore = boltStrg
+		if config.GetKVHistoryBucket() > 0 {
+			historyStore = boltStrg
+			rawRetention = config.GetKVHistoryRetention()
+		}
+	} else if database != nil && config.GetDBDriver() == db.DriverSQLite {
+		sqliteStrg := storage.NewSQLiteStorage(database, logger.Log)
+		repo = sqliteStrg
+		snapshotStrg = sqliteStrg
+		seriesStore = sqliteStrg
+	} else if database != nil {
+		db.ConfigurePool(database, config.GetDBPoolOptions())
 		databaseStrg := storage.NewDBStorage(database, logger.Log)
-		metricService = services.NewMetricService(databaseStrg)
+		databaseStrg.SetStatementTimeout(config.GetDBStatementTimeout())
+		databaseStrg.SetHistory(config.GetDBHistory())
+		if config.GetDBHistory() {
+			partitions = db.NewPartitions(database, logger.Log, config.GetDBHistoryRetention())
+			// без новых секций история пишется в секцию по умолчанию, сервер может работать
+			if err := partitions.Maintain(context.Background(), time.Now()); err != nil {
+				logger.Log.Info("cannot maintain history partitions", zap.Error(err))
+			}
+			historyStore = databaseStrg
+			rawRetention = config.GetDBHistoryRetention()
+		}
+		health = db.NewHealthChecker(database, logger.Log, config.GetDBHealthInterval(), config.GetDBStatementTimeout())
+		buffered = storage.NewBufferedStorage(databaseStrg, health, logger.Log)
+		repo = buffered
+		snapshotStrg = buffered
+		seriesStore = databaseStrg
+	}
+	diskStrg := storage.NewDiskStorage(snapshotStrg, logger.Log, config.GetFileStoragePath())
+	diskStrg.SetGenerations(config.GetSnapshotKeep())
+	if err := storage.ValidSnapshotFormat(config.GetSnapshotFormat()); err != nil {
+		return err
+	}
+	diskStrg.SetFormat(config.GetSnapshotFormat())
+	rollupTiers, err := services.ParseRollupTiers(config.GetRollupTiers())
+	if err != nil {
+		return err
+	}
+	ttlRules, err := services.ParseTTLRules(config.GetMetricTTLRules())
+	if err != nil {
+		return err
 	}
-	diskStrg := storage.NewDiskStorage(strg, logger.Log, config.GetFileStoragePath())
 	diskService := services.NewDiskService(diskStrg, config.GetStoreInterval(), config.GetRestore())
-	diskService.FillMetricStorage()
+
+	var walStrg *storage.WALStorage
+	if database == nil && boltStrg == nil && config.GetWALEnabled() {
+		if err := storage.ValidWALSync(config.GetWALSync()); err != nil {
+			return err
+		}
+		walStrg = storage.NewWALStorage(strg, logger.Log, config.GetWALPath(), config.GetWALSync(), config.GetWALSyncInterval())
+		defer func() {
+			if err := walStrg.Close(); err != nil {
+				logger.Log.Info("err close wal", zap.Error(err))
+			}
+		}()
+		repo = walStrg
+		seriesStore = walStrg
+		diskStrg.SetWAL(walStrg)
+		diskService.SetWAL(walStrg)
+	}
+	metricService := services.NewMetricService(repo)
+	metricService.SetMaxBatchSize(config.GetMaxBatchSize())
+	if err := diskService.FillMetricStorage(); err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go diskService.CollectMetrics(ctx)
+	if walStrg != nil {
+		go walStrg.Run(ctx)
+	}
+	if boltStrg != nil {
+		go boltStrg.Run(ctx, config.GetKVHistoryRetention())
+	}
+	if partitions != nil {
+		go partitions.Run(ctx, db.PartitionMaintenanceInterval)
+	}
+	janitor := services.NewJanitor(seriesStore, repo, config.GetMetricTTL(), ttlRules, logger.Log)
+	if janitor.Enabled() {
+		go janitor.Run(ctx)
+	}
+	historyHandler := handlers.NewHistoryHandler(nil, logger.Log)
+	if historyStore != nil && len(rollupTiers) > 0 {
+		rollups := services.NewRollupService(historyStore, rollupTiers, rawRetention, logger.Log)
+		go rollups.Run(ctx)
+		historyHandler = handlers.NewHistoryHandler(rollups, logger.Log)
+	}
+	dbHandler := handlers.NewDBHandler(nil, nil, logger.Log)
+	if health != nil {
+		go health.Run(ctx)
+		go buffered.Run(ctx, config.GetDBHealthInterval())
+		dbHandler = handlers.NewDBHandler(health, buffered, logger.Log)
+	}
+
+	keyCache, err := crypto.NewKeyCache(config.GetCryptoKeyPaths(), logger.Log)
+	if err != nil {
+		return fmt.Errorf("load private keys: %w", err)
+	}
+	go keyCache.Watch(ctx)
+
+	tlsConfig, err := tlsconfig.NewServerConfig(config.GetTLSOptions())
+	if err != nil {
+		return fmt.Errorf("tls config: %w", err)
+	}
+
+	tokenStore, err := auth.NewTokenStore(config.GetAuthTokensFile())
+	if err != nil {
+		return fmt.Errorf("load agent tokens: %w", err)
+	}
+	authenticator := auth.NewAuthenticator(tokenStore, config.GetAdminToken(), config.GetAuthRequired())
+
+	ipFilter, err := netfilter.New(config.GetTrustedSubnets(), config.GetDeniedSubnets(), config.GetTrustedProxies())
+	if err != nil {
+		return fmt.Errorf("ip filter: %w", err)
+	}
+	limiter := ratelimit.New(config.GetRateLimit(), config.GetRateBurst())
 
 	fmt.Println(
 		"Build version: ", buildVersion, "\n",
@@ -88,13 +242,18 @@ func run() error {
 	grpcServerChan := make(chan *grpc.Server)
 
 	go func() {
-		grpcServer, err := startGRPCServer(config, *metricService, logger.Log)
+		grpcServer, err := startGRPCServer(config, *metricService, keyCache, authenticator, ipFilter, limiter, tlsConfig, logger.Log)
 		if err != nil {
 			errChan <- err
 		}
 		grpcServerChan <- grpcServer
 	}()
 
+	httpServer, err := startHTTPServer(config, metricService, dbHandler, historyHandler, keyCache, tokenStore, authenticator, ipFilter, limiter, tlsConfig, errChan)
+	if err != nil {
+		return err
+	}
+
 	select {
 	case sig := <-signalChan:
 		logger.Log.Info("Received signal, shutting down", zap.String("signal", sig.String()))
@@ -109,6 +268,14 @@ func run() error {
 	grpcServer := <-grpcServerChan
 	grpcServer.GracefulStop()
 
+	if httpServer != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer shutdownCancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Log.Info("err shutdown http server", zap.Error(err))
+		}
+	}
+
 	logger.Log.Info("Server exited gracefully")
 
 	return nil
@@ -116,30 +283,55 @@ func run() error {
 
 type configer interface {
 	GetAddress() string
+	GetHTTPAddress() string
 	GetKey() string
-	GetCryptoKeyPath() string
-	GetTrustedSubnet() string
+	GetSignatureWindow() time.Duration
+	GetMaxBodySize() int64
+	GetCompressMinSize() int
+	GetTLSAllowedClients() []string
 }
 
 type customLogger interface {
 	Info(string, ...zap.Field)
 }
 
-func startGRPCServer(config configer, metricService services.MetricService, log customLogger) (*grpc.Server, error) {
+func startGRPCServer(
+	config configer,
+	metricService services.MetricService,
+	keyCache *crypto.KeyCache,
+	authenticator *auth.Authenticator,
+	ipFilter *netfilter.Filter,
+	limiter *ratelimit.Limiter,
+	tlsConfig *tls.Config,
+	log customLogger,
+) (*grpc.Server, error) {
 	lis, err := net.Listen("tcp", config.GetAddress())
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen: %w", err)
 	}
 
-	grpcServer := grpc.NewServer(
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if config.GetMaxBodySize() > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(config.GetMaxBodySize())))
+	}
+
+	authInterceptor := interceptor.NewAuth(authenticator, logger.Log)
+	grpcServer := grpc.NewServer(append(opts,
 		grpc.ChainUnaryInterceptor(
+			// как и в HTTP, подсеть проверяется до любой работы над запросом
+			interceptor.NewCheckIP(ipFilter, logger.Log).UnaryCheckIPInterceptor,
 			interceptor.UnaryLoggingInterceptor,
-			interceptor.UnaryGzipInterceptor,
-			interceptor.NewHashMiddleware(config.GetKey()).UnaryHashInterceptor,
-			interceptor.NewDecryptMiddleware(config.GetCryptoKeyPath(), logger.Log).UnaryDecryptInterceptor,
-			interceptor.NewCheckIP(config.GetTrustedSubnet(), logger.Log).UnaryCheckIPInterceptor,
+			interceptor.NewClientCert(config.GetTLSAllowedClients(), logger.Log).UnaryClientCertInterceptor,
+			authInterceptor.UnaryAuthInterceptor,
+			authInterceptor.RoleInterceptor(grpcserver.MethodRoles),
+			interceptor.NewRateLimit(limiter, ipFilter, logger.Log).UnaryRateLimitInterceptor,
+			interceptor.NewHashMiddleware(config.GetKey(), signature.NewVerifier(config.GetKey(), config.GetSignatureWindow())).UnaryHashInterceptor,
+			interceptor.NewDecryptMiddleware(keyCache, logger.Log).UnaryDecryptInterceptor,
 		),
-	)
+	)...)
 	proto.RegisterMetricServiceServer(grpcServer, grpcserver.NewMetricServiceServer(metricService, logger.Log))
 
 	log.Info("Starting gRPC server at", zap.String("address", config.GetAddress()))
@@ -152,3 +344,67 @@ func startGRPCServer(config configer, metricService services.MetricService, log
 
 	return grpcServer, nil
 }
+
+func startHTTPServer(
+	config configer,
+	metricService *services.MetricService,
+	dbHandler *handlers.DBHandler,
+	historyHandler *handlers.HistoryHandler,
+	keyCache *crypto.KeyCache,
+	tokenStore *auth.TokenStore,
+	authenticator *auth.Authenticator,
+	ipFilter *netfilter.Filter,
+	limiter *ratelimit.Limiter,
+	tlsConfig *tls.Config,
+	errChan chan<- error,
+) (*http.Server, error) {
+	if config.GetHTTPAddress() == "" {
+		return nil, nil
+	}
+
+	router := routes.InitRouter(
+		handlers.NewHandler(metricService, logger.Log),
+		handlers.NewTokenHandler(tokenStore, logger.Log),
+		dbHandler,
+		historyHandler,
+		middlewares.NewHashMiddleware(config.GetKey(), signature.NewVerifier(config.GetKey(), config.GetSignatureWindow())),
+		middlewares.NewDecryptMiddleware(keyCache, logger.Log),
+		middlewares.NewAuth(authenticator, logger.Log),
+		middlewares.NewLimits(limiter, ipFilter, config.GetMaxBodySize(), logger.Log),
+		middlewares.NewCompression(config.GetCompressMinSize(), logger.Log),
+	)
+
+	// клиент из запрещённой подсети отсекается раньше, чем на него потрачены
+	// распаковка, лимиты, nonce и расшифровка
+	handler := middlewares.NewCheckIP(ipFilter, logger.Log).WithCheckIP(
+		middlewares.NewClientCert(config.GetTLSAllowedClients(), logger.Log).WithClientCert(router),
+	)
+
+	server := &http.Server{
+		Addr:              config.GetHTTPAddress(),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: shutdownTimeout,
+	}
+
+	lis, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen http: %w", err)
+	}
+
+	logger.Log.Info("Starting HTTP server at", zap.String("address", server.Addr), zap.Bool("tls", tlsConfig != nil))
+
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = server.ServeTLS(lis, "", "")
+		} else {
+			err = server.Serve(lis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- fmt.Errorf("http server: %w", err)
+		}
+	}()
+
+	return server, nil
+}
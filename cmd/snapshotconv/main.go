@@ -0,0 +1,117 @@
+// Snapshotconv утилита для перевода снимков метрик между форматами json и binary.
+//
+// Использование:
+//
+//	snapshotconv -to binary /tmp/metrics-db.json /tmp/metrics-db.bin
+//	snapshotconv -info /tmp/metrics-db.json
+//
+// Перед записью исходный снимок читается целиком и проверяется по контрольной сумме,
+// так что повреждённый снимок не превратится в целый снимок другого формата.
+// Сервер читает снимки обоих форматов, SNAPSHOT_FORMAT влияет только на новые снимки.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/NikolosHGW/metric/internal/server/storage"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(fmt.Errorf("snapshotconv: %w", err))
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("snapshotconv", flag.ContinueOnError)
+	to := fs.String("to", storage.FormatBinary, "target format: json or binary")
+	info := fs.Bool("info", false, "only print the format and number of metrics of the snapshot")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *info {
+		if fs.NArg() != 1 {
+			return errors.New("expected one snapshot file")
+		}
+		return printInfo(fs.Arg(0), out)
+	}
+
+	if fs.NArg() != 2 {
+		return errors.New("expected source and destination snapshot files")
+	}
+	if err := storage.ValidSnapshotFormat(*to); err != nil {
+		return err
+	}
+
+	return convert(fs.Arg(0), fs.Arg(1), *to, out)
+}
+
+func printInfo(path string, out io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	consumer, err := storage.NewConsumer(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	count := 0
+	for {
+		_, err := consumer.ReadMetric()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		count++
+	}
+
+	fmt.Fprintf(out, "%s: format %s, %d metrics\n", path, consumer.Format(), count)
+
+	return nil
+}
+
+func convert(src, dst, format string, out io.Writer) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	tmp := dst + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	count, err := storage.ConvertSnapshot(in, file, format)
+	if err != nil {
+		return errors.Join(fmt.Errorf("%s: %w", src, err), file.Close(), os.Remove(tmp))
+	}
+	if err := file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%d metrics written to %s in %s format\n", count, dst, format)
+
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 
+	"github.com/NikolosHGW/metric/internal/compress"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
 	"github.com/caarlos0/env"
 )
 
@@ -14,6 +16,13 @@ type config struct {
 	Key            string `env:"KEY"`
 	CryptoKey      string `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
 	ConfigPath     string `env:"CONFIG"`
+	TLSCA          string `env:"TLS_CA" json:"tls_ca,omitempty"`
+	TLSCert        string `env:"TLS_CERT" json:"tls_cert,omitempty"`
+	TLSKey         string `env:"TLS_KEY" json:"tls_key,omitempty"`
+	TLSServerName  string `env:"TLS_SERVER_NAME" json:"tls_server_name,omitempty"`
+	TLSMinVersion  string `env:"TLS_MIN_VERSION" json:"tls_min_version,omitempty"`
+	Token          string `env:"TOKEN"`
+	GRPCCompressor string `env:"GRPC_COMPRESSOR" json:"grpc_compressor,omitempty"`
 	PollInterval   int    `env:"POLL_INTERVAL" json:"poll_interval,omitempty"`
 	ReportInterval int    `env:"REPORT_INTERVAL" json:"report_interval,omitempty"`
 	RateLimit      int    `end:"RATE_LIMIT"`
@@ -35,6 +44,14 @@ func (c config) GetKey() string {
 	return c.Key
 }
 
+func (c config) GetToken() string {
+	return c.Token
+}
+
+func (c config) GetGRPCCompressor() string {
+	return c.GRPCCompressor
+}
+
 func (c config) GetRateLimit() int {
 	return c.RateLimit
 }
@@ -50,6 +67,16 @@ func (c config) GetCryptoKeyPath() string {
 	return c.CryptoKey
 }
 
+func (c config) GetTLSOptions() tlsconfig.Options {
+	return tlsconfig.Options{
+		CertFile:   c.TLSCert,
+		KeyFile:    c.TLSKey,
+		CAFile:     c.TLSCA,
+		MinVersion: c.TLSMinVersion,
+		ServerName: c.TLSServerName,
+	}
+}
+
 func (c *config) parseFlags() {
 	flag.StringVar(&c.Address, "a", "localhost:8080", "net address host:port")
 	flag.IntVar(&c.ReportInterval, "r", 10, "report seconds interval")
@@ -58,6 +85,13 @@ func (c *config) parseFlags() {
 	flag.IntVar(&c.RateLimit, "l", 10, "Rate limit for outgoing requests")
 	flag.StringVar(&c.CryptoKey, "crypto-key", "", "path to public crypto key")
 	flag.StringVar(&c.ConfigPath, "c", "", "path to config file")
+	flag.StringVar(&c.TLSCA, "tls-ca", "", "path to CA bundle for server certificate, enables TLS")
+	flag.StringVar(&c.TLSCert, "tls-cert", "", "path to client TLS certificate for mTLS")
+	flag.StringVar(&c.TLSKey, "tls-key", "", "path to client TLS private key for mTLS")
+	flag.StringVar(&c.TLSServerName, "tls-server-name", "", "expected server name in certificate")
+	flag.StringVar(&c.TLSMinVersion, "tls-min-version", tlsconfig.DefaultMinVersion, "minimal TLS version: 1.2 or 1.3")
+	flag.StringVar(&c.Token, "token", "", "agent token issued by the server admin API")
+	flag.StringVar(&c.GRPCCompressor, "grpc-compressor", compress.Gzip, "gRPC compressor: gzip, zstd or empty to disable")
 
 	flag.Parse()
 }
@@ -102,4 +136,28 @@ func (c *config) loadFromJSON() {
 	if c.ReportInterval == 10 && tempConfig.ReportInterval != 10 {
 		c.ReportInterval = tempConfig.ReportInterval
 	}
+
+	if c.TLSCA == "" && tempConfig.TLSCA != "" {
+		c.TLSCA = tempConfig.TLSCA
+	}
+
+	if c.TLSCert == "" && tempConfig.TLSCert != "" {
+		c.TLSCert = tempConfig.TLSCert
+	}
+
+	if c.TLSKey == "" && tempConfig.TLSKey != "" {
+		c.TLSKey = tempConfig.TLSKey
+	}
+
+	if c.TLSServerName == "" && tempConfig.TLSServerName != "" {
+		c.TLSServerName = tempConfig.TLSServerName
+	}
+
+	if c.TLSMinVersion == tlsconfig.DefaultMinVersion && tempConfig.TLSMinVersion != "" {
+		c.TLSMinVersion = tempConfig.TLSMinVersion
+	}
+
+	if c.GRPCCompressor == compress.Gzip && tempConfig.GRPCCompressor != "" {
+		c.GRPCCompressor = tempConfig.GRPCCompressor
+	}
 }
@@ -0,0 +1,61 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/NikolosHGW/metric/internal/signature"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewTokenInterceptor добавляет токен агента в метаданные каждого вызова
+func NewTokenInterceptor(token string) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// NewSignInterceptor подписывает каждый вызов ключом key вместе с меткой времени и nonce
+func NewSignInterceptor(key string) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		pb, ok := req.(proto.Message)
+		if !ok {
+			return fmt.Errorf("cannot sign request of type %T", req)
+		}
+		data, err := proto.Marshal(pb)
+		if err != nil {
+			return fmt.Errorf("cannot marshal request: %w", err)
+		}
+
+		params, err := signature.Sign(key, data)
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			strings.ToLower(signature.HashHeader), params.Hash,
+			strings.ToLower(signature.TimestampHeader), params.Timestamp,
+			strings.ToLower(signature.NonceHeader), params.Nonce,
+		)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -2,11 +2,7 @@ package request
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net"
@@ -16,11 +12,15 @@ import (
 	"time"
 
 	"github.com/NikolosHGW/metric/internal/client/metrics"
+	"github.com/NikolosHGW/metric/internal/compress"
 	"github.com/NikolosHGW/metric/internal/crypto"
 	"github.com/NikolosHGW/metric/internal/models"
 	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/signature"
 )
 
+const updatesRoute = "/updates/"
+
 type ClientMetrics interface {
 	GetMetrics() map[string]interface{}
 }
@@ -122,7 +122,8 @@ func getResultURL(host, metricType, metricName, metricValue string) string {
 	return sb.String()
 }
 
-func SendJSONMetrics(ctx context.Context, m ClientMetrics, reportInterval int, host, key string) {
+// SendJSONMetrics периодически отправляет метрики по одной, тело сжимается кодировкой encoding
+func SendJSONMetrics(ctx context.Context, m ClientMetrics, reportInterval int, host, key, encoding string) {
 	metricTypeMap := GetMetricTypeMap()
 	ticker := time.NewTicker(time.Duration(reportInterval) * time.Second)
 	defer ticker.Stop()
@@ -148,18 +149,9 @@ func SendJSONMetrics(ctx context.Context, m ClientMetrics, reportInterval int, h
 					continue
 				}
 
-				hash := hash(data, key)
-
-				buf := bytes.NewBuffer(nil)
-				zb := gzip.NewWriter(buf)
-				_, gzipErr := zb.Write(data)
-				if gzipErr != nil {
-					log.Println("metric/internal/client/util/util.go SendMetrics cannot gzip write", gzipErr)
-					continue
-				}
-				err = zb.Close()
+				buf, err := compressBody(data, encoding)
 				if err != nil {
-					log.Println("metric/internal/client/util/util.go SendMetrics cannot gzip cloze", err)
+					log.Println("metric/internal/client/util/util.go SendMetrics cannot compress body", err)
 					continue
 				}
 
@@ -169,10 +161,10 @@ func SendJSONMetrics(ctx context.Context, m ClientMetrics, reportInterval int, h
 					continue
 				}
 				nr.Header.Set("Content-Type", "application/json")
-				nr.Header.Set("Content-Encoding", "gzip")
-				nr.Header.Set("Accept-Encoding", "gzip")
-				if hash != "" {
-					nr.Header.Set("HashSHA256", hash)
+				setEncodingHeaders(nr, encoding)
+				if err := signRequest(nr, data, key); err != nil {
+					log.Println("metric/internal/client/util/util.go SendMetrics cannot sign request", err)
+					continue
 				}
 				resp, err := http.DefaultClient.Do(nr)
 
@@ -191,7 +183,8 @@ func SendJSONMetrics(ctx context.Context, m ClientMetrics, reportInterval int, h
 	}
 }
 
-func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath string) {
+// SendBatchJSONMetrics отправляет метрики пачкой, тело сжимается кодировкой encoding
+func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath, encoding string) {
 	metricTypeMap := GetMetricTypeMap()
 	metricsBatch := make([]models.Metrics, 0, len(m.GetMetrics()))
 
@@ -220,7 +213,7 @@ func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath string) {
 			return
 		}
 
-		encryptedData, err := crypto.EncryptData(publicKey, data)
+		encryptedData, err := crypto.EncryptData(publicKey, data, updatesRoute)
 		if err != nil {
 			log.Println("cannot encrypt data", err)
 			return
@@ -229,18 +222,9 @@ func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath string) {
 		data = encryptedData
 	}
 
-	hash := hash(data, key)
-
-	buf := bytes.NewBuffer(nil)
-	zb := gzip.NewWriter(buf)
-	_, gzipErr := zb.Write(data)
-	if gzipErr != nil {
-		log.Println("metric/internal/client/util/util.go SendBatchMetrics cannot gzip write", gzipErr)
-		return
-	}
-	err = zb.Close()
+	buf, err := compressBody(data, encoding)
 	if err != nil {
-		log.Println("metric/internal/client/util/util.go SendBatchMetrics cannot gzip close", err)
+		log.Println("metric/internal/client/util/util.go SendBatchMetrics cannot compress body", err)
 		return
 	}
 
@@ -250,14 +234,14 @@ func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath string) {
 		return
 	}
 	nr.Header.Set("Content-Type", "application/json")
-	nr.Header.Set("Content-Encoding", "gzip")
-	nr.Header.Set("Accept-Encoding", "gzip")
+	setEncodingHeaders(nr, encoding)
 	realIP := getOutboundIP()
 	if realIP != "" {
 		nr.Header.Set("X-Real-IP", realIP)
 	}
-	if hash != "" {
-		nr.Header.Set("HashSHA256", hash)
+	if err := signRequest(nr, data, key); err != nil {
+		log.Println("metric/internal/client/util/util.go SendBatchMetrics cannot sign request", err)
+		return
 	}
 	resp, err := http.DefaultClient.Do(nr)
 
@@ -272,6 +256,35 @@ func SendBatchJSONMetrics(m ClientMetrics, host, key, publicKeyPath string) {
 	}
 }
 
+// compressBody сжимает тело запроса, пустая кодировка или identity оставляют его как есть
+func compressBody(data []byte, encoding string) (*bytes.Buffer, error) {
+	buf := bytes.NewBuffer(nil)
+	if encoding == "" || encoding == compress.Identity {
+		buf.Write(data)
+		return buf, nil
+	}
+
+	zw, err := compress.NewWriter(encoding, buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func setEncodingHeaders(r *http.Request, encoding string) {
+	if encoding != "" && encoding != compress.Identity {
+		r.Header.Set("Content-Encoding", encoding)
+	}
+	r.Header.Set("Accept-Encoding", strings.Join(compress.HTTPEncodings, ", "))
+}
+
 func getURL(host string) string {
 	sb := strings.Builder{}
 
@@ -287,7 +300,7 @@ func getUpdatesURL(host string) string {
 
 	sb.WriteString("http://")
 	sb.WriteString(host)
-	sb.WriteString("/updates/")
+	sb.WriteString(updatesRoute)
 
 	return sb.String()
 }
@@ -314,14 +327,21 @@ func GetFloatValue(metricType string, value interface{}) float64 {
 	return 0
 }
 
-func hash(data []byte, key string) string {
-	if key != "" {
-		h := hmac.New(sha256.New, []byte(key))
-		h.Write(data)
-		return hex.EncodeToString(h.Sum(nil))
+// signRequest добавляет в запрос подпись тела с меткой времени и nonce, если задан ключ
+func signRequest(r *http.Request, data []byte, key string) error {
+	if key == "" {
+		return nil
 	}
 
-	return ""
+	params, err := signature.Sign(key, data)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(signature.HashHeader, params.Hash)
+	r.Header.Set(signature.TimestampHeader, params.Timestamp)
+	r.Header.Set(signature.NonceHeader, params.Nonce)
+
+	return nil
 }
 
 func getOutboundIP() string {
@@ -1,19 +1,20 @@
 package request
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/NikolosHGW/metric/internal/compress"
 	"github.com/NikolosHGW/metric/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_getStringValue(t *testing.T) {
@@ -152,7 +153,7 @@ func TestSendJSONMetrics(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	go SendJSONMetrics(ctx, mockMetrics, 1, "localhost", "test-key")
+	go SendJSONMetrics(ctx, mockMetrics, 1, "localhost", "test-key", compress.Gzip)
 
 	<-ctx.Done()
 
@@ -160,50 +161,62 @@ func TestSendJSONMetrics(t *testing.T) {
 }
 
 func TestSendBatchJSONMetrics(t *testing.T) {
-	mockMetrics := new(MockClientMetrics)
-
-	mockMetrics.On("GetMetrics").Return(map[string]interface{}{
-		"testMetric": models.Gauge(42),
-	})
-
-	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		assert.Equal(t, "/updates/", req.URL.String())
-		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
-		assert.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
-		assert.Equal(t, "gzip", req.Header.Get("Accept-Encoding"))
-
-		body, err := io.ReadAll(req.Body)
-		assert.NoError(t, err)
-
-		gr, err := gzip.NewReader(bytes.NewBuffer(body))
-		assert.NoError(t, err)
-		defer func() {
-			err := gr.Close()
-			if err != nil {
-				t.Errorf("failed to close gzip reader: %v", err)
-			}
-		}()
-
-		decompressedBody, err := io.ReadAll(gr)
-		assert.NoError(t, err)
-
-		var metrics []models.Metrics
-		err = json.Unmarshal(decompressedBody, &metrics)
-		assert.NoError(t, err)
-
-		assert.Equal(t, "testMetric", metrics[0].ID)
-		assert.Equal(t, models.GaugeType, metrics[0].MType)
-		assert.NotNil(t, metrics[0].Value)
-		assert.Equal(t, float64(42), *metrics[0].Value)
-
-		_, err = rw.Write([]byte(`OK`))
-		if err != nil {
-			t.Errorf("failed to write body: %v", err)
-		}
-	}))
-	defer server.Close()
-
-	SendBatchJSONMetrics(mockMetrics, server.URL, "testKey", "")
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "gzip", encoding: compress.Gzip},
+		{name: "zstd", encoding: compress.Zstd},
+	}
 
-	mockMetrics.AssertExpectations(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockMetrics := new(MockClientMetrics)
+
+			mockMetrics.On("GetMetrics").Return(map[string]interface{}{
+				models.Alloc: models.Gauge(42),
+			})
+
+			var called bool
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				called = true
+				assert.Equal(t, "/updates/", req.URL.String())
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				assert.Equal(t, tt.encoding, req.Header.Get("Content-Encoding"))
+				assert.Equal(t, "zstd, br, gzip", req.Header.Get("Accept-Encoding"))
+
+				zr, err := compress.NewReader(tt.encoding, req.Body)
+				require.NoError(t, err)
+				defer func() {
+					err := zr.Close()
+					if err != nil {
+						t.Errorf("failed to close reader: %v", err)
+					}
+				}()
+
+				decompressedBody, err := io.ReadAll(zr)
+				assert.NoError(t, err)
+
+				var metrics []models.Metrics
+				err = json.Unmarshal(decompressedBody, &metrics)
+				require.NoError(t, err)
+
+				assert.Equal(t, models.Alloc, metrics[0].ID)
+				assert.Equal(t, models.GaugeType, metrics[0].MType)
+				assert.NotNil(t, metrics[0].Value)
+				assert.Equal(t, float64(42), *metrics[0].Value)
+
+				_, err = rw.Write([]byte(`OK`))
+				if err != nil {
+					t.Errorf("failed to write body: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			SendBatchJSONMetrics(mockMetrics, strings.TrimPrefix(server.URL, "http://"), "testKey", "", tt.encoding)
+
+			assert.True(t, called)
+			mockMetrics.AssertExpectations(t)
+		})
+	}
 }
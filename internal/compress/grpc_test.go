@@ -0,0 +1,116 @@
+package compress
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echoServer struct {
+	proto.UnimplementedMetricServiceServer
+}
+
+func (echoServer) UpsertMetrics(_ context.Context, req *proto.UpsertMetricRequest) (*proto.UpsertMetricResponse, error) {
+	return &proto.UpsertMetricResponse{Metrics: req.Metrics}, nil
+}
+
+// payloadStats запоминает размеры последнего входящего сообщения на сервере
+type payloadStats struct {
+	length     atomic.Int64
+	compressed atomic.Int64
+}
+
+func (s *payloadStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (s *payloadStats) HandleRPC(_ context.Context, st stats.RPCStats) {
+	if in, ok := st.(*stats.InPayload); ok {
+		s.length.Store(int64(in.Length))
+		s.compressed.Store(int64(in.CompressedLength))
+	}
+}
+
+func (s *payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (s *payloadStats) HandleConn(context.Context, stats.ConnStats) {}
+
+func TestGRPCCompressors_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressor string
+		compressed bool
+	}{
+		{name: "Без сжатия", compressor: ""},
+		{name: "gzip", compressor: Gzip, compressed: true},
+		{name: "zstd", compressor: Zstd, compressed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &payloadStats{}
+			lis := bufconn.Listen(1 << 20)
+			server := grpc.NewServer(grpc.StatsHandler(st))
+			proto.RegisterMetricServiceServer(server, echoServer{})
+			go func() {
+				_ = server.Serve(lis)
+			}()
+			defer server.Stop()
+
+			opts := []grpc.DialOption{
+				grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+					return lis.DialContext(ctx)
+				}),
+				grpc.WithTransportCredentials(insecure.NewCredentials()),
+			}
+			if tt.compressor != "" {
+				opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(tt.compressor)))
+			}
+			conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			req := &proto.UpsertMetricRequest{}
+			for i := 0; i < 100; i++ {
+				req.Metrics = append(req.Metrics, &proto.Metric{
+					Id:    strings.Repeat("GCCPUFraction", 3),
+					Type:  "gauge",
+					Value: float64(i),
+				})
+			}
+
+			// несколько вызовов подряд проверяют переиспользование энкодеров из пула
+			for i := 0; i < 3; i++ {
+				resp, err := proto.NewMetricServiceClient(conn).UpsertMetrics(context.Background(), req)
+				require.NoError(t, err)
+				require.Len(t, resp.Metrics, len(req.Metrics))
+				assert.Equal(t, req.Metrics[99].Value, resp.Metrics[99].Value)
+			}
+
+			if tt.compressed {
+				assert.Less(t, st.compressed.Load(), st.length.Load(), "сервер получил сжатое сообщение")
+			} else {
+				assert.Equal(t, st.length.Load(), st.compressed.Load())
+			}
+		})
+	}
+}
+
+func TestValidGRPC(t *testing.T) {
+	assert.NoError(t, ValidGRPC(""))
+	assert.NoError(t, ValidGRPC(Gzip))
+	assert.NoError(t, ValidGRPC(Zstd))
+	assert.Error(t, ValidGRPC("lz4"))
+}
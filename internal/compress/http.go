@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Brotli   = "br"
+	Identity = "identity"
+)
+
+// HTTPEncodings поддерживаемые кодировки тела HTTP в порядке предпочтения сервера
+var HTTPEncodings = []string{Zstd, Brotli, Gzip}
+
+// NewWriter оборачивает w в компрессор для кодировки encoding
+func NewWriter(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	case Brotli:
+		return brotli.NewWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// NewReader оборачивает r в декомпрессор для кодировки encoding
+func NewReader(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	}
+
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// Negotiate выбирает кодировку ответа по заголовку Accept-Encoding с учётом q-значений.
+// При равных весах побеждает порядок supported. Пустая строка означает ответ без сжатия
+func Negotiate(acceptEncoding string, supported []string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if !ok || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				parsed = 0
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,60 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           string
+	}{
+		{name: "пустой заголовок", acceptEncoding: "", want: ""},
+		{name: "одна кодировка", acceptEncoding: "gzip", want: Gzip},
+		{name: "порядок сервера при равных весах", acceptEncoding: "gzip, deflate, br, zstd", want: Zstd},
+		{name: "наибольший q", acceptEncoding: "zstd;q=0.2, br;q=0.9, gzip;q=0.5", want: Brotli},
+		{name: "q=0 запрещает кодировку", acceptEncoding: "zstd;q=0, br;q=0, gzip", want: Gzip},
+		{name: "звёздочка", acceptEncoding: "*;q=0.5, zstd;q=0", want: Brotli},
+		{name: "только identity", acceptEncoding: "identity", want: ""},
+		{name: "регистр и пробелы", acceptEncoding: " GZIP ; q=0.8 ", want: Gzip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.acceptEncoding, HTTPEncodings))
+		})
+	}
+}
+
+func TestWriterReader_RoundTrip(t *testing.T) {
+	data := strings.Repeat(`{"id":"Alloc","type":"gauge","value":42.1}`, 100)
+
+	for _, encoding := range HTTPEncodings {
+		t.Run(encoding, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			zw, err := NewWriter(encoding, buf)
+			require.NoError(t, err)
+			_, err = io.WriteString(zw, data)
+			require.NoError(t, err)
+			require.NoError(t, zw.Close())
+			assert.Less(t, buf.Len(), len(data))
+
+			zr, err := NewReader(encoding, buf)
+			require.NoError(t, err)
+			defer zr.Close()
+			got, err := io.ReadAll(zr)
+			require.NoError(t, err)
+			assert.Equal(t, data, string(got))
+		})
+	}
+
+	_, err := NewWriter("deflate", io.Discard)
+	assert.Error(t, err)
+}
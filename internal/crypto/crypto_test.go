@@ -21,83 +21,6 @@ func (l *testLogger) Info(msg string, fields ...zap.Field) {
 	l.logs = append(l.logs, msg)
 }
 
-func TestGeneratePrivateKey(t *testing.T) {
-	tests := []struct {
-		name                 string
-		serverPrivateKeyPath string
-		expectError          bool
-	}{
-		{
-			name:                 "Successful key generation",
-			serverPrivateKeyPath: "test_private_key.pem",
-			expectError:          false,
-		},
-		{
-			name:                 "Invalid file path",
-			serverPrivateKeyPath: "",
-			expectError:          true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			l := &testLogger{}
-
-			err := GeneratePrivateKey(l, tt.serverPrivateKeyPath)
-			if (err != nil) != tt.expectError {
-				t.Errorf("GeneratePrivateKey() error = %v, expectError %v", err, tt.expectError)
-			}
-
-			if !tt.expectError {
-				err = os.Remove(tt.serverPrivateKeyPath)
-				if err != nil {
-					t.Fatalf("Failed to remove serverPrivateKeyPath: %v", err)
-				}
-			}
-		})
-	}
-}
-
-func TestGeneratePublicKey(t *testing.T) {
-	privateKey, _ := rsa.GenerateKey(rand.Reader, 4096)
-
-	tests := []struct {
-		name               string
-		privateKey         *rsa.PrivateKey
-		agentPublicKeyPath string
-		expectError        bool
-	}{
-		{
-			name:               "Successful key generation",
-			privateKey:         privateKey,
-			agentPublicKeyPath: "test_public_key.pem",
-			expectError:        false,
-		},
-		{
-			name:               "Invalid file path",
-			privateKey:         privateKey,
-			agentPublicKeyPath: "",
-			expectError:        true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := GeneratePublicKey(tt.privateKey, tt.agentPublicKeyPath)
-			if (err != nil) != tt.expectError {
-				t.Errorf("GeneratePublicKey() error = %v, expectError %v", err, tt.expectError)
-			}
-
-			if !tt.expectError {
-				err = os.Remove(tt.agentPublicKeyPath)
-				if err != nil {
-					t.Fatalf("Failed to remove agentPublicKeyPath: %v", err)
-				}
-			}
-		})
-	}
-}
-
 func TestLoadPrivateKey_Success(t *testing.T) {
 	privateKeyPath := "test_private_key.pem"
 	serverPrivateKeyFile, err := os.CreateTemp("", privateKeyPath)
@@ -111,11 +34,17 @@ func TestLoadPrivateKey_Success(t *testing.T) {
 		}
 	}()
 
-	logger := &testLogger{}
-
-	err = GeneratePrivateKey(logger, serverPrivateKeyFile.Name())
+	key, err := GenerateKey(KeyTypeRSA, 2048)
 	if err != nil {
-		t.Fatalf("Failed GenerateCrypto: %v", err)
+		t.Fatalf("Failed GenerateKey: %v", err)
+	}
+	privatePEM, err := EncodePrivateKeyPEM(key, FormatPKCS1)
+	if err != nil {
+		t.Fatalf("Failed EncodePrivateKeyPEM: %v", err)
+	}
+	err = WriteKeyFile(serverPrivateKeyFile.Name(), privatePEM, 0600)
+	if err != nil {
+		t.Fatalf("Failed WriteKeyFile: %v", err)
 	}
 
 	privateKey, err := LoadPrivateKey(serverPrivateKeyFile.Name())
@@ -174,12 +103,16 @@ func TestLoadPrivateKey_CorruptedFile(t *testing.T) {
 }
 
 func TestLoadPublicKey(t *testing.T) {
-	privateKey, _ := rsa.GenerateKey(rand.Reader, 4096)
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
 	publicKeyPath := "agent_public_key.pem"
 
-	err := GeneratePublicKey(privateKey, publicKeyPath)
+	publicPEM, err := EncodePublicKeyPEM(&privateKey.PublicKey, FormatPKCS1)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	err = WriteKeyFile(publicKeyPath, publicPEM, 0644)
 	if err != nil {
-		t.Fatalf("Failed to generate keys: %v", err)
+		t.Fatalf("Failed to write public key: %v", err)
 	}
 
 	publicKey, err := LoadPublicKey(publicKeyPath)
@@ -310,7 +243,7 @@ func TestEncryptData(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			encryptedData, err := EncryptData(publicKey, tt.data)
+			encryptedData, err := EncryptData(publicKey, tt.data, "/updates/")
 			if tt.wantErr {
 				assert.Error(t, err)
 				assert.Nil(t, encryptedData)
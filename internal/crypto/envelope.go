@@ -0,0 +1,188 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Формат конверта (все многобайтовые поля в big-endian):
+//
+//	[0]      версия формата
+//	[1]      алгоритм шифрования симметричного ключа
+//	[2]      алгоритм шифрования данных
+//	[3]      длина идентификатора ключа (n)
+//	[4:4+n]  идентификатор ключа
+//	[+2]     длина зашифрованного симметричного ключа (m)
+//	[+m]     зашифрованный симметричный ключ
+//	[+12]    nonce
+//	[...]    шифротекст вместе с тегом GCM
+//
+// Заголовок (всё до nonce) вместе с маршрутом метрики передаётся в GCM как
+// дополнительные данные, поэтому конверт нельзя переиспользовать для другого маршрута.
+const (
+	EnvelopeVersion1 byte = 1
+
+	KeyAlgRSAOAEPSHA256 byte = 1
+
+	DataAlgAES256GCM byte = 1
+)
+
+const (
+	aesKeySize    = 32
+	keyIDSize     = 8
+	minHeaderSize = 4
+)
+
+var (
+	ErrMalformedEnvelope  = errors.New("malformed envelope")
+	ErrUnsupportedVersion = errors.New("unsupported envelope version")
+	ErrUnsupportedAlg     = errors.New("unsupported envelope algorithm")
+	ErrUnknownKey         = errors.New("unknown key id")
+)
+
+// KeyID возвращает идентификатор публичного ключа: первые байты SHA-256 от его PKCS#1 представления
+func KeyID(publicKey *rsa.PublicKey) string {
+	return hex.EncodeToString(keyID(publicKey))
+}
+
+func keyID(publicKey *rsa.PublicKey) []byte {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(publicKey))
+
+	return sum[:keyIDSize]
+}
+
+// EncryptData шифрует data гибридной схемой RSA-OAEP + AES-256-GCM и упаковывает результат в конверт,
+// привязанный к маршруту route
+func EncryptData(publicKey *rsa.PublicKey, data []byte, route string) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte{}, nil
+	}
+
+	// Генерация нового симметричного ключа AES-256
+	aesKey := make([]byte, aesKeySize)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, fmt.Errorf("cannot generate AES key: %w", err)
+	}
+
+	// Шифрование симметричного ключа с использованием RSA
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, aesKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt AES key: %w", err)
+	}
+
+	id := keyID(publicKey)
+	header := make([]byte, 0, minHeaderSize+len(id)+2+len(encryptedKey))
+	header = append(header, EnvelopeVersion1, KeyAlgRSAOAEPSHA256, DataAlgAES256GCM, byte(len(id)))
+	header = append(header, id...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(encryptedKey)))
+	header = append(header, encryptedKey...)
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	result := append(header, nonce...)
+	result = gcm.Seal(result, nonce, data, additionalData(header, route))
+
+	return result, nil
+}
+
+// DecryptData разбирает конверт, находит в keyRing приватный ключ по идентификатору
+// и расшифровывает данные, проверяя привязку к маршруту route
+func DecryptData(keyRing *KeyRing, data []byte, route string) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte{}, nil
+	}
+
+	if len(data) < minHeaderSize {
+		return nil, fmt.Errorf("%w: too short", ErrMalformedEnvelope)
+	}
+
+	if data[0] != EnvelopeVersion1 {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if data[1] != KeyAlgRSAOAEPSHA256 || data[2] != DataAlgAES256GCM {
+		return nil, fmt.Errorf("%w: key %d, data %d", ErrUnsupportedAlg, data[1], data[2])
+	}
+
+	offset := minHeaderSize
+	idLen := int(data[3])
+	if len(data) < offset+idLen+2 {
+		return nil, fmt.Errorf("%w: truncated key id", ErrMalformedEnvelope)
+	}
+	id := hex.EncodeToString(data[offset : offset+idLen])
+	offset += idLen
+
+	encryptedKeyLen := int(binary.BigEndian.Uint16(data[offset:]))
+	offset += 2
+	if len(data) < offset+encryptedKeyLen {
+		return nil, fmt.Errorf("%w: truncated encrypted key", ErrMalformedEnvelope)
+	}
+	encryptedKey := data[offset : offset+encryptedKeyLen]
+	offset += encryptedKeyLen
+	header := data[:offset]
+
+	privateKey, ok := keyRing.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	// Расшифровка симметричного ключа с использованием RSA
+	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt AES key: %w", err)
+	}
+
+	gcm, err := newGCM(aesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < offset+nonceSize {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrMalformedEnvelope)
+	}
+	nonce, ciphertext := data[offset:offset+nonceSize], data[offset+nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData(header, route))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create AES cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create GCM: %w", err)
+	}
+
+	return gcm, nil
+}
+
+func additionalData(header []byte, route string) []byte {
+	aad := make([]byte, 0, len(header)+len(route))
+	aad = append(aad, header...)
+
+	return append(aad, route...)
+}
@@ -0,0 +1,157 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRoute = "/updates/"
+
+func TestDecryptData(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	foreignKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyRing := NewKeyRing(oldKey, newKey)
+	message := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+
+	encrypt := func(key *rsa.PrivateKey, route string) []byte {
+		data, err := EncryptData(&key.PublicKey, message, route)
+		require.NoError(t, err)
+
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		data    func() []byte
+		route   string
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:  "Старый ключ во время ротации",
+			data:  func() []byte { return encrypt(oldKey, testRoute) },
+			route: testRoute,
+			want:  message,
+		},
+		{
+			name:  "Новый ключ",
+			data:  func() []byte { return encrypt(newKey, testRoute) },
+			route: testRoute,
+			want:  message,
+		},
+		{
+			name:  "Пустые данные",
+			data:  func() []byte { return []byte{} },
+			route: testRoute,
+			want:  []byte{},
+		},
+		{
+			name:    "Неизвестный ключ",
+			data:    func() []byte { return encrypt(foreignKey, testRoute) },
+			route:   testRoute,
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name: "Неподдерживаемая версия",
+			data: func() []byte {
+				data := encrypt(newKey, testRoute)
+				data[0] = 2
+
+				return data
+			},
+			route:   testRoute,
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name: "Неподдерживаемый алгоритм",
+			data: func() []byte {
+				data := encrypt(newKey, testRoute)
+				data[2] = 42
+
+				return data
+			},
+			route:   testRoute,
+			wantErr: ErrUnsupportedAlg,
+		},
+		{
+			name:    "Обрезанный конверт",
+			data:    func() []byte { return encrypt(newKey, testRoute)[:20] },
+			route:   testRoute,
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:    "Слишком короткие данные",
+			data:    func() []byte { return []byte{1, 1} },
+			route:   testRoute,
+			wantErr: ErrMalformedEnvelope,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptData(keyRing, tt.data(), tt.route)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "unexpected error: %v", err)
+				assert.Nil(t, got)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecryptData_RouteMismatch(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data, err := EncryptData(&key.PublicKey, []byte("payload"), testRoute)
+	require.NoError(t, err)
+
+	_, err = DecryptData(NewKeyRing(key), data, "/update/")
+	assert.Error(t, err)
+}
+
+func TestDecryptData_TamperedHeader(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data, err := EncryptData(&key.PublicKey, []byte("payload"), testRoute)
+	require.NoError(t, err)
+
+	// портим первый байт зашифрованного симметричного ключа
+	data[minHeaderSize+keyIDSize+2] ^= 0xff
+
+	_, err = DecryptData(NewKeyRing(key), data, testRoute)
+	assert.Error(t, err)
+}
+
+func TestKeyRing(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	keyRing := NewKeyRing()
+	assert.Equal(t, 0, keyRing.Len())
+
+	id := keyRing.Add(key)
+	assert.Equal(t, KeyID(&key.PublicKey), id)
+	assert.Equal(t, []string{id}, keyRing.IDs())
+
+	got, ok := keyRing.Get(id)
+	assert.True(t, ok)
+	assert.Equal(t, key, got)
+
+	_, ok = keyRing.Get("unknown")
+	assert.False(t, ok)
+}
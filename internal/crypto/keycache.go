@@ -0,0 +1,196 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+const keyFileExt = ".pem"
+
+// ErrNoPrivateKeys пути к ключам заданы, но ни одного ключа загрузить не удалось.
+// Без этой проверки сервер молча принимал бы незашифрованные запросы
+var ErrNoPrivateKeys = errors.New("no private keys loaded")
+
+// KeyCache держит в памяти набор приватных ключей сервера и перечитывает его
+// при изменении файлов на диске или по сигналу SIGHUP.
+// Каждый путь может указывать на файл с ключом или на директорию с *.pem файлами.
+type KeyCache struct {
+	log   customLogger
+	ring  atomic.Pointer[KeyRing]
+	paths []string
+}
+
+// NewKeyCache конструктор кэша ключей, сразу загружает ключи с диска
+func NewKeyCache(paths []string, log customLogger) (*KeyCache, error) {
+	kc := &KeyCache{
+		paths: paths,
+		log:   log,
+	}
+	if err := kc.Reload(); err != nil {
+		return nil, err
+	}
+
+	return kc, nil
+}
+
+// KeyRing возвращает актуальный набор ключей
+func (kc *KeyCache) KeyRing() *KeyRing {
+	return kc.ring.Load()
+}
+
+// Reload перечитывает ключи с диска. При ошибке, в том числе если по заданным путям
+// не нашлось ни одного ключа, продолжает использоваться предыдущий набор
+func (kc *KeyCache) Reload() error {
+	ring := NewKeyRing()
+	for _, path := range kc.paths {
+		if err := kc.loadPath(ring, path); err != nil {
+			return err
+		}
+	}
+	if len(kc.paths) > 0 && ring.Len() == 0 {
+		return fmt.Errorf("%w from %s", ErrNoPrivateKeys, strings.Join(kc.paths, ", "))
+	}
+
+	kc.ring.Store(ring)
+	kc.log.Info("private keys loaded", zap.Strings("ids", ring.IDs()))
+
+	return nil
+}
+
+func (kc *KeyCache) loadPath(ring *KeyRing, path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot stat key path %s: %w", path, err)
+	}
+
+	if !stat.IsDir() {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("cannot load private key %s: %w", path, err)
+		}
+		ring.Add(key)
+
+		return nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("cannot read key dir %s: %w", path, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), keyFileExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key, err := LoadPrivateKey(filepath.Join(path, name))
+		if err != nil {
+			kc.log.Info("skip key file", zap.String("file", name), zap.Error(err))
+			continue
+		}
+		ring.Add(key)
+	}
+
+	return nil
+}
+
+// Watch следит за изменениями файлов ключей и сигналом SIGHUP до отмены ctx
+func (kc *KeyCache) Watch(ctx context.Context) {
+	if len(kc.paths) == 0 {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events chan fsnotify.Event
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		kc.log.Info("cannot create key watcher, only SIGHUP reload is available", zap.Error(err))
+	} else {
+		defer func() {
+			err := watcher.Close()
+			if err != nil {
+				kc.log.Info("cannot close key watcher", zap.Error(err))
+			}
+		}()
+		for _, dir := range kc.watchDirs() {
+			if err := watcher.Add(dir); err != nil {
+				kc.log.Info("cannot watch key dir", zap.String("dir", dir), zap.Error(err))
+			}
+		}
+		events = watcher.Events
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			kc.reload("SIGHUP")
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if kc.isKeyFile(event.Name) {
+				kc.reload(event.String())
+			}
+		}
+	}
+}
+
+func (kc *KeyCache) reload(reason string) {
+	if err := kc.Reload(); err != nil {
+		kc.log.Info("cannot reload private keys", zap.String("reason", reason), zap.Error(err))
+	}
+}
+
+// watchDirs возвращает директории для наблюдения: для файла следим за родительской
+// директорией, чтобы не потерять файл при атомарной замене через rename
+func (kc *KeyCache) watchDirs() []string {
+	seen := make(map[string]struct{})
+	var dirs []string
+	for _, path := range kc.paths {
+		dir := path
+		if stat, err := os.Stat(path); err != nil || !stat.IsDir() {
+			dir = filepath.Dir(path)
+		}
+		if _, ok := seen[dir]; !ok {
+			seen[dir] = struct{}{}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+func (kc *KeyCache) isKeyFile(name string) bool {
+	name = filepath.Clean(name)
+	for _, path := range kc.paths {
+		path = filepath.Clean(path)
+		if name == path {
+			return true
+		}
+		if filepath.Dir(name) == path && strings.HasSuffix(name, keyFileExt) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"sort"
+)
+
+// KeyRing набор активных приватных ключей сервера, индексированных по KeyID.
+// Позволяет принимать данные, зашифрованные как старым, так и новым ключом, во время ротации.
+type KeyRing struct {
+	keys map[string]*rsa.PrivateKey
+}
+
+// NewKeyRing конструктор набора ключей
+func NewKeyRing(keys ...*rsa.PrivateKey) *KeyRing {
+	kr := &KeyRing{
+		keys: make(map[string]*rsa.PrivateKey, len(keys)),
+	}
+	for _, key := range keys {
+		kr.Add(key)
+	}
+
+	return kr
+}
+
+// LoadKeyRing загружает приватные ключи из файлов paths
+func LoadKeyRing(paths ...string) (*KeyRing, error) {
+	kr := NewKeyRing()
+	for _, path := range paths {
+		key, err := LoadPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load private key %s: %w", path, err)
+		}
+		kr.Add(key)
+	}
+
+	return kr, nil
+}
+
+// Add добавляет ключ в набор и возвращает его идентификатор
+func (kr *KeyRing) Add(key *rsa.PrivateKey) string {
+	id := KeyID(&key.PublicKey)
+	kr.keys[id] = key
+
+	return id
+}
+
+// Get возвращает приватный ключ по идентификатору
+func (kr *KeyRing) Get(id string) (*rsa.PrivateKey, bool) {
+	if kr == nil {
+		return nil, false
+	}
+	key, ok := kr.keys[id]
+
+	return key, ok
+}
+
+// IDs возвращает отсортированный список идентификаторов ключей
+func (kr *KeyRing) IDs() []string {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Len количество ключей в наборе
+func (kr *KeyRing) Len() int {
+	if kr == nil {
+		return 0
+	}
+
+	return len(kr.keys)
+}
@@ -0,0 +1,224 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	KeyTypeRSA    = "rsa"
+	KeyTypeECDSA  = "ecdsa"
+	KeyTypeX25519 = "x25519"
+)
+
+const (
+	FormatPKCS1 = "pkcs1"
+	FormatPKCS8 = "pkcs8"
+	FormatPKIX  = "pkix"
+)
+
+const (
+	pemTypeRSAPrivateKey = "RSA PRIVATE KEY"
+	pemTypeRSAPublicKey  = "RSA PUBLIC KEY"
+	pemTypePrivateKey    = "PRIVATE KEY"
+	pemTypePublicKey     = "PUBLIC KEY"
+)
+
+const DefaultRSABits = 4096
+
+var (
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+	ErrUnsupportedFormat  = errors.New("unsupported key format")
+)
+
+// KeyInfo описание ключа, прочитанного из PEM
+type KeyInfo struct {
+	Type    string
+	Format  string
+	KeyID   string
+	Size    int
+	Private bool
+}
+
+// GenerateKey генерирует приватный ключ типа keyType, bits используется только для RSA
+func GenerateKey(keyType string, bits int) (any, error) {
+	switch keyType {
+	case KeyTypeRSA:
+		if bits == 0 {
+			bits = DefaultRSABits
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	case KeyTypeECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeX25519:
+		return ecdh.X25519().GenerateKey(rand.Reader)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeyType, keyType)
+}
+
+// PublicKeyOf возвращает публичную часть приватного ключа
+func PublicKeyOf(privateKey any) (any, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &key.PublicKey, nil
+	case *ecdsa.PrivateKey:
+		return &key.PublicKey, nil
+	case *ecdh.PrivateKey:
+		return key.PublicKey(), nil
+	}
+
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, privateKey)
+}
+
+// EncodePrivateKeyPEM кодирует приватный ключ в PEM. PKCS#1 поддерживается только для RSA
+func EncodePrivateKeyPEM(privateKey any, format string) ([]byte, error) {
+	switch format {
+	case FormatPKCS1:
+		key, ok := privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s for %T", ErrUnsupportedFormat, format, privateKey)
+		}
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  pemTypeRSAPrivateKey,
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}), nil
+	case FormatPKCS8:
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal PKCS#8 private key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der}), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// EncodePublicKeyPEM кодирует публичный ключ в PEM. PKCS#1 поддерживается только для RSA
+func EncodePublicKeyPEM(publicKey any, format string) ([]byte, error) {
+	switch format {
+	case FormatPKCS1:
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s for %T", ErrUnsupportedFormat, format, publicKey)
+		}
+		return pem.EncodeToMemory(&pem.Block{
+			Type:  pemTypeRSAPublicKey,
+			Bytes: x509.MarshalPKCS1PublicKey(key),
+		}), nil
+	case FormatPKIX, FormatPKCS8:
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal PKIX public key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemTypePublicKey, Bytes: der}), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// ParsePrivateKeyPEM разбирает приватный ключ в формате PKCS#1 или PKCS#8
+func ParsePrivateKeyPEM(data []byte) (any, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", errors.New("failed to decode PEM block containing private key")
+	}
+
+	switch block.Type {
+	case pemTypeRSAPrivateKey:
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		return key, FormatPKCS1, err
+	case pemTypePrivateKey:
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		return key, FormatPKCS8, err
+	}
+
+	return nil, "", errors.New("failed to decode PEM block containing private key")
+}
+
+// ParsePublicKeyPEM разбирает публичный ключ в формате PKCS#1 или PKIX
+func ParsePublicKeyPEM(data []byte) (any, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", errors.New("failed to decode PEM block containing public key")
+	}
+
+	switch block.Type {
+	case pemTypeRSAPublicKey:
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		return key, FormatPKCS1, err
+	case pemTypePublicKey:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		return key, FormatPKIX, err
+	}
+
+	return nil, "", errors.New("failed to decode PEM block containing public key")
+}
+
+// InspectPEM возвращает описание приватного или публичного ключа из PEM
+func InspectPEM(data []byte) (KeyInfo, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return KeyInfo{}, errors.New("failed to decode PEM block")
+	}
+
+	var (
+		key    any
+		format string
+		err    error
+		info   KeyInfo
+	)
+	switch block.Type {
+	case pemTypeRSAPrivateKey, pemTypePrivateKey:
+		key, format, err = ParsePrivateKeyPEM(data)
+		if err != nil {
+			return KeyInfo{}, err
+		}
+		info.Private = true
+		key, err = PublicKeyOf(key)
+	default:
+		key, format, err = ParsePublicKeyPEM(data)
+	}
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	info.Format = format
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		info.Type = KeyTypeRSA
+		info.Size = pub.N.BitLen()
+		info.KeyID = KeyID(pub)
+	case *ecdsa.PublicKey:
+		info.Type = KeyTypeECDSA
+		info.Size = pub.Curve.Params().BitSize
+	case *ecdh.PublicKey:
+		info.Type = KeyTypeX25519
+		info.Size = len(pub.Bytes()) * 8
+	default:
+		return KeyInfo{}, fmt.Errorf("%w: %T", ErrUnsupportedKeyType, key)
+	}
+
+	return info, nil
+}
+
+// WriteKeyFile атомарно записывает PEM в файл: сначала во временный файл рядом, затем rename
+func WriteKeyFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("cannot write key file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("cannot rename key file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package crypto
+
+import (
+	"context"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAndInspectKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyType       string
+		format        string
+		publicFormat  string
+		wantSize      int
+		wantKeyID     bool
+		wantEncodeErr bool
+	}{
+		{name: "RSA PKCS#1", keyType: KeyTypeRSA, format: FormatPKCS1, publicFormat: FormatPKCS1, wantSize: 2048, wantKeyID: true},
+		{name: "RSA PKCS#8", keyType: KeyTypeRSA, format: FormatPKCS8, publicFormat: FormatPKIX, wantSize: 2048, wantKeyID: true},
+		{name: "ECDSA PKCS#8", keyType: KeyTypeECDSA, format: FormatPKCS8, publicFormat: FormatPKIX, wantSize: 256},
+		{name: "X25519 PKCS#8", keyType: KeyTypeX25519, format: FormatPKCS8, publicFormat: FormatPKIX, wantSize: 256},
+		{name: "ECDSA PKCS#1 не поддерживается", keyType: KeyTypeECDSA, format: FormatPKCS1, wantEncodeErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateKey, err := GenerateKey(tt.keyType, 2048)
+			require.NoError(t, err)
+
+			privatePEM, err := EncodePrivateKeyPEM(privateKey, tt.format)
+			if tt.wantEncodeErr {
+				assert.ErrorIs(t, err, ErrUnsupportedFormat)
+				return
+			}
+			require.NoError(t, err)
+
+			info, err := InspectPEM(privatePEM)
+			require.NoError(t, err)
+			assert.True(t, info.Private)
+			assert.Equal(t, tt.keyType, info.Type)
+			assert.Equal(t, tt.format, info.Format)
+			assert.Equal(t, tt.wantSize, info.Size)
+			assert.Equal(t, tt.wantKeyID, info.KeyID != "")
+
+			publicKey, err := PublicKeyOf(privateKey)
+			require.NoError(t, err)
+			publicPEM, err := EncodePublicKeyPEM(publicKey, tt.publicFormat)
+			require.NoError(t, err)
+
+			publicInfo, err := InspectPEM(publicPEM)
+			require.NoError(t, err)
+			assert.False(t, publicInfo.Private)
+			assert.Equal(t, info.Type, publicInfo.Type)
+			assert.Equal(t, info.KeyID, publicInfo.KeyID)
+		})
+	}
+}
+
+func TestGenerateKey_UnsupportedType(t *testing.T) {
+	_, err := GenerateKey("dsa", 0)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+}
+
+func TestLoadKeys_PKCS8AndPKIX(t *testing.T) {
+	dir := t.TempDir()
+	key, err := GenerateKey(KeyTypeRSA, 2048)
+	require.NoError(t, err)
+
+	privatePEM, err := EncodePrivateKeyPEM(key, FormatPKCS8)
+	require.NoError(t, err)
+	publicPEM, err := EncodePublicKeyPEM(&key.(*rsa.PrivateKey).PublicKey, FormatPKIX)
+	require.NoError(t, err)
+
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, WriteKeyFile(privatePath, privatePEM, 0600))
+	require.NoError(t, WriteKeyFile(publicPath, publicPEM, 0644))
+
+	privateKey, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	publicKey, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(&privateKey.PublicKey), KeyID(publicKey))
+}
+
+func TestLoadPrivateKey_NotRSA(t *testing.T) {
+	key, err := GenerateKey(KeyTypeECDSA, 0)
+	require.NoError(t, err)
+	privatePEM, err := EncodePrivateKeyPEM(key, FormatPKCS8)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "ecdsa.pem")
+	require.NoError(t, WriteKeyFile(path, privatePEM, 0600))
+
+	_, err = LoadPrivateKey(path)
+	assert.ErrorIs(t, err, ErrUnsupportedKeyType)
+}
+
+func TestRotateKeys(t *testing.T) {
+	dir := t.TempDir()
+	publicPath := filepath.Join(t.TempDir(), "agent.pem")
+
+	first, err := RotateKeys(dir, publicPath, 1024, FormatPKCS1, 2)
+	require.NoError(t, err)
+	second, err := RotateKeys(dir, publicPath, 1024, FormatPKCS1, 2)
+	require.NoError(t, err)
+	assert.Empty(t, second.Removed)
+
+	third, err := RotateKeys(dir, publicPath, 1024, FormatPKCS8, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first.PrivateKeyPath}, third.Removed)
+
+	publicKey, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	assert.Equal(t, third.KeyID, KeyID(publicKey))
+
+	ring, err := LoadKeyRing(second.PrivateKeyPath, third.PrivateKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ring.Len())
+}
+
+func TestKeyCache_ReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	_, err := RotateKeys(dir, "", 1024, FormatPKCS1, 5)
+	require.NoError(t, err)
+
+	cache, err := NewKeyCache([]string{dir}, &testLogger{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.KeyRing().Len())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go cache.Watch(ctx)
+	// даём наблюдателю время подписаться на директорию
+	time.Sleep(100 * time.Millisecond)
+
+	rotated, err := RotateKeys(dir, "", 1024, FormatPKCS1, 5)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, ok := cache.KeyRing().Get(rotated.KeyID)
+		return ok
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, 2, cache.KeyRing().Len())
+}
+
+func TestKeyCache_KeepsPreviousRingOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.pem")
+	key, err := GenerateKey(KeyTypeRSA, 1024)
+	require.NoError(t, err)
+	privatePEM, err := EncodePrivateKeyPEM(key, FormatPKCS1)
+	require.NoError(t, err)
+	require.NoError(t, WriteKeyFile(path, privatePEM, 0600))
+
+	cache, err := NewKeyCache([]string{path}, &testLogger{})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0600))
+	assert.Error(t, cache.Reload())
+	assert.Equal(t, 1, cache.KeyRing().Len())
+}
+
+func TestKeyCache_NoPaths(t *testing.T) {
+	cache, err := NewKeyCache(nil, &testLogger{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, cache.KeyRing().Len())
+}
+
+func TestKeyCache_NoKeysLoaded(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{
+			name: "пустая директория",
+		},
+		{
+			name:  "все ключи битые",
+			files: map[string]string{"a.pem": "broken", "b.pem": "also broken"},
+		},
+		{
+			name:  "нет файлов с расширением .pem",
+			files: map[string]string{"server.key": "broken"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0600))
+			}
+
+			_, err := NewKeyCache([]string{dir}, &testLogger{})
+			assert.ErrorIs(t, err, ErrNoPrivateKeys)
+		})
+	}
+}
+
+func TestKeyCache_KeepsPreviousRingWhenDirEmptied(t *testing.T) {
+	dir := t.TempDir()
+	rotated, err := RotateKeys(dir, "", 1024, FormatPKCS1, 5)
+	require.NoError(t, err)
+
+	cache, err := NewKeyCache([]string{dir}, &testLogger{})
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(rotated.PrivateKeyPath))
+	assert.ErrorIs(t, cache.Reload(), ErrNoPrivateKeys)
+	_, ok := cache.KeyRing().Get(rotated.KeyID)
+	assert.True(t, ok, "сервер не переходит на незашифрованные запросы")
+}
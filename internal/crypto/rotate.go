@@ -0,0 +1,103 @@
+package crypto
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RotateResult результат ротации ключей в директории
+type RotateResult struct {
+	KeyID          string
+	PrivateKeyPath string
+	PublicKeyPath  string
+	Removed        []string
+}
+
+// RotateKeys генерирует новый RSA ключ в директории dir, записывает его публичную часть
+// в publicKeyPath и оставляет в директории не более keep самых новых приватных ключей.
+// Старые ключи остаются активными на сервере, пока агенты не получат новый публичный ключ.
+func RotateKeys(dir, publicKeyPath string, bits int, format string, keep int) (RotateResult, error) {
+	if keep < 1 {
+		return RotateResult{}, fmt.Errorf("keep must be positive, got %d", keep)
+	}
+
+	key, err := GenerateKey(KeyTypeRSA, bits)
+	if err != nil {
+		return RotateResult{}, fmt.Errorf("cannot generate key: %w", err)
+	}
+	privateKey := key.(*rsa.PrivateKey)
+
+	privatePEM, err := EncodePrivateKeyPEM(privateKey, format)
+	if err != nil {
+		return RotateResult{}, err
+	}
+	publicFormat := FormatPKCS1
+	if format != FormatPKCS1 {
+		publicFormat = FormatPKIX
+	}
+	publicPEM, err := EncodePublicKeyPEM(&privateKey.PublicKey, publicFormat)
+	if err != nil {
+		return RotateResult{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return RotateResult{}, fmt.Errorf("cannot create key dir: %w", err)
+	}
+
+	result := RotateResult{
+		KeyID:         KeyID(&privateKey.PublicKey),
+		PublicKeyPath: publicKeyPath,
+	}
+	// префикс из времени нужен, чтобы имена сортировались по возрасту ключа
+	result.PrivateKeyPath = filepath.Join(dir, fmt.Sprintf("%d-%s%s", time.Now().UnixNano(), result.KeyID, keyFileExt))
+
+	if err := WriteKeyFile(result.PrivateKeyPath, privatePEM, 0600); err != nil {
+		return RotateResult{}, err
+	}
+	if publicKeyPath != "" {
+		if err := WriteKeyFile(publicKeyPath, publicPEM, 0644); err != nil {
+			return RotateResult{}, err
+		}
+	}
+
+	result.Removed, err = pruneKeys(dir, keep)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func pruneKeys(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read key dir: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), keyFileExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) <= keep {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	var removed []string
+	for _, name := range names[:len(names)-keep] {
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("cannot remove old key: %w", err)
+		}
+		removed = append(removed, path)
+	}
+
+	return removed, nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// HistoryPoint значение метрики, записанное в Time: у counter накопленное, у gauge текущее
+type HistoryPoint struct {
+	Time   time.Time
+	Metric Metrics
+}
+
+// Rollup сводка значений метрики за интервал [Start, Start+Step).
+// Для gauge заполняются Min, Max и Avg, для counter прирост Delta и Rate в секунду.
+// У сырых значений Step равен нулю, а Count единице
+type Rollup struct {
+	Start time.Time     `json:"start" db:"bucket_start"`
+	Step  time.Duration `json:"-" db:"-"`
+	ID    string        `json:"id" db:"id"`
+	MType string        `json:"type" db:"type"`
+	Count int64         `json:"count" db:"count"`
+	Min   float64       `json:"min,omitempty" db:"min"`
+	Max   float64       `json:"max,omitempty" db:"max"`
+	Avg   float64       `json:"avg,omitempty" db:"avg"`
+	Delta int64         `json:"delta,omitempty" db:"delta"`
+	Rate  float64       `json:"rate,omitempty" db:"rate"`
+}
@@ -54,6 +54,8 @@ type Metrics struct {
 	Value *float64 `json:"value,omitempty" db:"value"` // значение метрики в случае передачи gauge
 	ID    string   `json:"id" db:"id"`                 // имя метрики
 	MType string   `json:"type" db:"type"`             // параметр, принимающий значение gauge или counter
+	// имя агента, последним записавшего метрику
+	UpdatedBy string `json:"updated_by,omitempty" db:"updated_by"`
 }
 
 func NewMetricModel() *Metrics {
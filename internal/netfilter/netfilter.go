@@ -0,0 +1,140 @@
+// Пакет netfilter проверяет адрес клиента по спискам разрешённых и запрещённых подсетей
+// и определяет реальный адрес клиента за доверенными прокси
+package netfilter
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Filter списки подсетей, разобранные один раз при старте сервера
+type Filter struct {
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+	proxies []netip.Prefix
+}
+
+// New конструктор фильтра. Элементы списков CIDR (IPv4 или IPv6) или отдельные адреса.
+// Пустой allow разрешает все адреса, кроме запрещённых в deny
+func New(allow, deny, trustedProxies []string) (*Filter, error) {
+	var f Filter
+	var err error
+
+	if f.allow, err = parsePrefixes(allow); err != nil {
+		return nil, fmt.Errorf("allowed subnets: %w", err)
+	}
+	if f.deny, err = parsePrefixes(deny); err != nil {
+		return nil, fmt.Errorf("denied subnets: %w", err)
+	}
+	if f.proxies, err = parsePrefixes(trustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+
+	return &f, nil
+}
+
+// Enabled возвращает true, если задан хотя бы один список подсетей
+func (f *Filter) Enabled() bool {
+	return f != nil && (len(f.allow) > 0 || len(f.deny) > 0)
+}
+
+// Allowed проверяет адрес клиента. Запрещающие подсети важнее разрешающих
+func (f *Filter) Allowed(ip netip.Addr) bool {
+	if !f.Enabled() {
+		return true
+	}
+	if !ip.IsValid() {
+		return false
+	}
+
+	ip = ip.Unmap()
+	if contains(f.deny, ip) {
+		return false
+	}
+
+	return len(f.allow) == 0 || contains(f.allow, ip)
+}
+
+// ClientIP возвращает адрес клиента. Заголовки X-Real-IP и X-Forwarded-For учитываются,
+// только если соединение пришло от доверенного прокси. header возвращает значение заголовка по имени
+func (f *Filter) ClientIP(peer netip.Addr, header func(string) string) netip.Addr {
+	peer = peer.Unmap()
+	if f == nil || !contains(f.proxies, peer) {
+		return peer
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(header("X-Real-IP"))); err == nil {
+		return realIP.Unmap()
+	}
+
+	// идём справа налево: правые адреса добавлены нашими прокси, первый недоверенный и есть клиент
+	hops := strings.Split(header("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		hop = hop.Unmap()
+		if !contains(f.proxies, hop) {
+			return hop
+		}
+	}
+
+	return peer
+}
+
+// ParseAddr разбирает адрес вида host:port или просто host
+func ParseAddr(addr string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(addr); err == nil {
+		return addrPort.Addr()
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip, _ := netip.ParseAddr(addr)
+
+	return ip
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q: %w", value, err)
+			}
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,86 @@
+package netfilter
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_InvalidCIDR(t *testing.T) {
+	_, err := New([]string{"invalid-cidr"}, nil, nil)
+	assert.Error(t, err)
+
+	_, err = New(nil, nil, []string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestFilter_Allowed(t *testing.T) {
+	filter, err := New([]string{"192.168.1.0/24", "2001:db8::/32"}, []string{"192.168.1.128/25"}, nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		ip       string
+		expected bool
+	}{
+		{name: "Адрес из разрешённой подсети", ip: "192.168.1.10", expected: true},
+		{name: "Адрес из запрещённой части подсети", ip: "192.168.1.200"},
+		{name: "Адрес вне подсетей", ip: "10.0.0.1"},
+		{name: "IPv6 адрес", ip: "2001:db8::42", expected: true},
+		{name: "IPv4 в IPv6 записи", ip: "::ffff:192.168.1.10", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filter.Allowed(netip.MustParseAddr(tt.ip)))
+		})
+	}
+
+	assert.False(t, filter.Allowed(netip.Addr{}), "пустой адрес не пропускается")
+}
+
+func TestFilter_ClientIP(t *testing.T) {
+	filter, err := New(nil, nil, []string{"10.0.0.0/24"})
+	require.NoError(t, err)
+
+	headers := func(realIP, forwarded string) func(string) string {
+		return func(name string) string {
+			switch name {
+			case "X-Real-IP":
+				return realIP
+			case "X-Forwarded-For":
+				return forwarded
+			}
+			return ""
+		}
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		realIP    string
+		forwarded string
+		expected  string
+	}{
+		{name: "Прямое соединение, заголовки игнорируются", peer: "203.0.113.5", realIP: "192.168.1.1", expected: "203.0.113.5"},
+		{name: "X-Real-IP от доверенного прокси", peer: "10.0.0.1", realIP: "192.168.1.1", expected: "192.168.1.1"},
+		{name: "Цепочка прокси в X-Forwarded-For", peer: "10.0.0.1", forwarded: "1.2.3.4, 192.168.1.1, 10.0.0.2", expected: "192.168.1.1"},
+		{name: "Прокси без заголовков", peer: "10.0.0.1", expected: "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip := filter.ClientIP(netip.MustParseAddr(tt.peer), headers(tt.realIP, tt.forwarded))
+			assert.Equal(t, tt.expected, ip.String())
+		})
+	}
+}
+
+func TestParseAddr(t *testing.T) {
+	assert.Equal(t, "192.168.1.1", ParseAddr("192.168.1.1:8080").String())
+	assert.Equal(t, "2001:db8::1", ParseAddr("[2001:db8::1]:8080").String())
+	assert.Equal(t, "192.168.1.1", ParseAddr("192.168.1.1").String())
+	assert.False(t, ParseAddr("bufconn").IsValid())
+}
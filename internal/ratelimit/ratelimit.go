@@ -0,0 +1,111 @@
+// Пакет ratelimit ограничивает частоту запросов отдельно для каждого клиента по алгоритму token bucket
+package ratelimit
+
+import (
+	"math"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// sweepInterval как часто из памяти удаляются корзины неактивных клиентов
+const sweepInterval = time.Minute
+
+type bucket struct {
+	updatedAt time.Time
+	tokens    float64
+}
+
+// Limiter пополняет корзину каждого клиента со скоростью rate токенов в секунду до burst токенов
+type Limiter struct {
+	lastSweep time.Time
+	now       func() time.Time
+	buckets   map[string]*bucket
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+}
+
+// New конструктор, rate <= 0 отключает ограничение. Если burst не задан, он равен rate
+func New(rate float64, burst int) *Limiter {
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &Limiter{
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+		rate:    rate,
+		burst:   float64(burst),
+	}
+}
+
+// Enabled возвращает true, если ограничение включено
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.rate > 0
+}
+
+// Allow забирает токен из корзины клиента key. Если токенов нет, возвращает false
+// и время, через которое появится следующий токен
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+
+	return true, 0
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	// корзина, которая успела наполниться, ничем не отличается от новой
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedAt) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfterSeconds округляет ожидание вверх до целых секунд для заголовка Retry-After
+func RetryAfterSeconds(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+
+	return seconds
+}
+
+// Key ключ клиента для лимитера: имя аутентифицированного клиента, иначе его IP адрес
+func Key(name string, ip netip.Addr) string {
+	if name != "" {
+		return "client:" + name
+	}
+
+	return "ip:" + ip.String()
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	l := New(2, 3)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("agent-1")
+		assert.True(t, ok, "запрос %d в пределах всплеска", i)
+	}
+
+	ok, wait := l.Allow("agent-1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	ok, _ = l.Allow("agent-2")
+	assert.True(t, ok, "у другого клиента своя корзина")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent-1")
+	assert.True(t, ok, "корзина пополнилась")
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := New(0, 0)
+	assert.False(t, l.Enabled())
+	for i := 0; i < 100; i++ {
+		ok, _ := l.Allow("agent-1")
+		assert.True(t, ok)
+	}
+}
+
+func TestLimiter_SweepsIdleBuckets(t *testing.T) {
+	l := New(1, 1)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	l.Allow("agent-1")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("agent-2")
+
+	assert.NotContains(t, l.buckets, "agent-1")
+	assert.Contains(t, l.buckets, "agent-2")
+}
+
+func TestKeyAndRetryAfter(t *testing.T) {
+	assert.Equal(t, "client:agent-1", Key("agent-1", netip.MustParseAddr("10.0.0.1")))
+	assert.Equal(t, "ip:10.0.0.1", Key("", netip.MustParseAddr("10.0.0.1")))
+	assert.Equal(t, 1, RetryAfterSeconds(100*time.Millisecond))
+	assert.Equal(t, 2, RetryAfterSeconds(1500*time.Millisecond))
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+)
+
+const (
+	AdminName    = "admin"
+	bearerPrefix = "Bearer "
+)
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("insufficient role")
+)
+
+// Authenticator проверяет токены агентов и административный токен из конфига
+type Authenticator struct {
+	tokens     *TokenStore
+	adminToken string
+	required   bool
+}
+
+// NewAuthenticator конструктор, required запрещает анонимные запросы
+func NewAuthenticator(tokens *TokenStore, adminToken string, required bool) *Authenticator {
+	return &Authenticator{
+		tokens:     tokens,
+		adminToken: adminToken,
+		required:   required,
+	}
+}
+
+// Authenticate возвращает идентификатор вызывающей стороны по токену
+func (a *Authenticator) Authenticate(token string) (identity.Identity, error) {
+	if a.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1 {
+		return identity.Identity{Name: AdminName, Source: identity.SourceAdmin, Role: identity.RoleAdmin}, nil
+	}
+
+	return a.tokens.Authenticate(token)
+}
+
+// Required возвращает true, если запросы без токена должны отклоняться
+func (a *Authenticator) Required() bool {
+	return a.required
+}
+
+// Authorize проверяет, что у клиента из контекста есть роль role.
+// Анонимным запросам, если аутентификация не обязательна, доступно всё, кроме административных методов
+func (a *Authenticator) Authorize(ctx context.Context, role string) error {
+	id, ok := identity.FromContext(ctx)
+	if !ok {
+		if a.required || role == identity.RoleAdmin {
+			return ErrUnauthenticated
+		}
+		return nil
+	}
+	if !id.HasRole(role) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// ParseBearer достаёт токен из значения заголовка Authorization
+func ParseBearer(header string) (string, bool) {
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
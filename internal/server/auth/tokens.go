@@ -0,0 +1,247 @@
+// Пакет auth хранит токены агентов и проверяет их при аутентификации запросов
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+)
+
+const (
+	tokenIDSize     = 8
+	tokenSecretSize = 32
+	tokenSeparator  = "."
+)
+
+var (
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrTokenRevoked  = errors.New("token revoked")
+	ErrTokenNotFound = errors.New("token not found")
+	ErrEmptyAgent    = errors.New("agent name is required")
+	ErrInvalidRole   = errors.New("unknown role")
+)
+
+// Token запись о выданном токене. Сам секрет не хранится, только его SHA-256.
+// Токены без роли, выпущенные до появления ролей, считаются токенами writer
+type Token struct {
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ID        string     `json:"id"`
+	Agent     string     `json:"agent"`
+	Role      string     `json:"role,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+}
+
+// Revoked возвращает true, если токен отозван
+func (t Token) Revoked() bool {
+	return t.RevokedAt != nil
+}
+
+// TokenStore хранилище токенов агентов. Если задан путь, изменения сохраняются в JSON файл
+type TokenStore struct {
+	tokens map[string]Token
+	path   string
+	mu     sync.RWMutex
+}
+
+// NewTokenStore конструктор хранилища токенов, загружает ранее выданные токены из path
+func NewTokenStore(path string) (*TokenStore, error) {
+	ts := &TokenStore{
+		tokens: make(map[string]Token),
+		path:   path,
+	}
+	if path == "" {
+		return ts, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read tokens file: %w", err)
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid tokens file: %w", err)
+	}
+	for _, token := range tokens {
+		ts.tokens[token.ID] = token
+	}
+
+	return ts, nil
+}
+
+// Create выпускает новый токен для агента с ролью role и областями доступа scopes
+// и возвращает запись и сам токен. Токен показывается один раз, восстановить его из хранилища нельзя
+func (ts *TokenStore) Create(agent, role string, scopes []string) (Token, string, error) {
+	if agent == "" {
+		return Token{}, "", ErrEmptyAgent
+	}
+	if role == "" {
+		role = identity.RoleWriter
+	}
+	if !identity.ValidRole(role) {
+		return Token{}, "", fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	id, err := randomString(tokenIDSize, hex.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+	secret, err := randomString(tokenSecretSize, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return Token{}, "", err
+	}
+
+	token := Token{
+		ID:        id,
+		Agent:     agent,
+		Role:      role,
+		Scopes:    scopes,
+		Hash:      hashSecret(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	ts.tokens[id] = token
+	if err := ts.save(); err != nil {
+		delete(ts.tokens, id)
+		return Token{}, "", err
+	}
+
+	return token, id + tokenSeparator + secret, nil
+}
+
+// Revoke отзывает токен по идентификатору
+func (ts *TokenStore) Revoke(id string) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	token, ok := ts.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	if token.Revoked() {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	token.RevokedAt = &now
+	ts.tokens[id] = token
+	if err := ts.save(); err != nil {
+		token.RevokedAt = nil
+		ts.tokens[id] = token
+		return err
+	}
+
+	return nil
+}
+
+// List возвращает все токены без хешей, отсортированные по времени выпуска
+func (ts *TokenStore) List() []Token {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tokens := make([]Token, 0, len(ts.tokens))
+	for _, token := range ts.tokens {
+		token.Hash = ""
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	return tokens
+}
+
+// Authenticate проверяет токен и возвращает идентификатор агента
+func (ts *TokenStore) Authenticate(raw string) (identity.Identity, error) {
+	id, secret, ok := strings.Cut(raw, tokenSeparator)
+	if !ok || id == "" || secret == "" {
+		return identity.Identity{}, ErrInvalidToken
+	}
+
+	ts.mu.RLock()
+	token, ok := ts.tokens[id]
+	ts.mu.RUnlock()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return identity.Identity{}, ErrInvalidToken
+	}
+	if token.Revoked() {
+		return identity.Identity{}, ErrTokenRevoked
+	}
+
+	role := token.Role
+	if role == "" {
+		role = identity.RoleWriter
+	}
+
+	return identity.Identity{
+		Name:   token.Agent,
+		Source: identity.SourceToken,
+		Role:   role,
+		Scopes: token.Scopes,
+	}, nil
+}
+
+func (ts *TokenStore) save() error {
+	if ts.path == "" {
+		return nil
+	}
+
+	tokens := make([]Token, 0, len(ts.tokens))
+	for _, token := range ts.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].ID < tokens[j].ID
+	})
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode tokens: %w", err)
+	}
+
+	tmp := ts.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("cannot write tokens file: %w", err)
+	}
+	if err := os.Rename(tmp, ts.path); err != nil {
+		return fmt.Errorf("cannot rename tokens file: %w", err)
+	}
+
+	return nil
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate token: %w", err)
+	}
+
+	return encode(buf), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenStore_Authenticate(t *testing.T) {
+	store, err := NewTokenStore("")
+	require.NoError(t, err)
+
+	token, raw, err := store.Create("agent-1", "", nil)
+	require.NoError(t, err)
+	revoked, revokedRaw, err := store.Create("agent-2", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Revoke(revoked.ID))
+
+	tests := []struct {
+		name         string
+		raw          string
+		expectedName string
+		expectedErr  error
+	}{
+		{name: "Действующий токен", raw: raw, expectedName: "agent-1"},
+		{name: "Отозванный токен", raw: revokedRaw, expectedErr: ErrTokenRevoked},
+		{name: "Неверный секрет", raw: token.ID + ".wrong", expectedErr: ErrInvalidToken},
+		{name: "Неизвестный идентификатор", raw: "deadbeef.secret", expectedErr: ErrInvalidToken},
+		{name: "Токен без разделителя", raw: "garbage", expectedErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := store.Authenticate(tt.raw)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedName, id.Name)
+			assert.Equal(t, identity.SourceToken, id.Source)
+		})
+	}
+}
+
+func TestTokenStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewTokenStore(path)
+	require.NoError(t, err)
+
+	_, raw, err := store.Create("agent-1", "", nil)
+	require.NoError(t, err)
+	revoked, _, err := store.Create("agent-2", "", nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Revoke(revoked.ID))
+
+	reloaded, err := NewTokenStore(path)
+	require.NoError(t, err)
+
+	id, err := reloaded.Authenticate(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", id.Name)
+
+	tokens := reloaded.List()
+	require.Len(t, tokens, 2)
+	for _, token := range tokens {
+		assert.Empty(t, token.Hash)
+		assert.Equal(t, token.ID == revoked.ID, token.Revoked())
+	}
+}
+
+func TestTokenStore_Roles(t *testing.T) {
+	store, err := NewTokenStore("")
+	require.NoError(t, err)
+
+	_, raw, err := store.Create("dashboard", identity.RoleReader, []string{"cpu."})
+	require.NoError(t, err)
+
+	id, err := store.Authenticate(raw)
+	require.NoError(t, err)
+	assert.Equal(t, identity.RoleReader, id.Role)
+	assert.True(t, id.HasRole(identity.RoleReader))
+	assert.False(t, id.HasRole(identity.RoleWriter))
+	assert.True(t, id.CanAccess("cpu.user"))
+	assert.False(t, id.CanAccess("Alloc"))
+
+	_, raw, err = store.Create("agent-1", "", nil)
+	require.NoError(t, err)
+	id, err = store.Authenticate(raw)
+	require.NoError(t, err)
+	assert.Equal(t, identity.RoleWriter, id.Role)
+}
+
+func TestTokenStore_Errors(t *testing.T) {
+	store, err := NewTokenStore("")
+	require.NoError(t, err)
+
+	_, _, err = store.Create("", "", nil)
+	assert.ErrorIs(t, err, ErrEmptyAgent)
+	_, _, err = store.Create("agent-1", "root", nil)
+	assert.ErrorIs(t, err, ErrInvalidRole)
+	assert.ErrorIs(t, store.Revoke("missing"), ErrTokenNotFound)
+}
+
+func TestAuthenticator(t *testing.T) {
+	store, err := NewTokenStore("")
+	require.NoError(t, err)
+	_, raw, err := store.Create("agent-1", "", nil)
+	require.NoError(t, err)
+
+	a := NewAuthenticator(store, "admin-secret", true)
+	assert.True(t, a.Required())
+
+	id, err := a.Authenticate("admin-secret")
+	require.NoError(t, err)
+	assert.Equal(t, identity.SourceAdmin, id.Source)
+
+	id, err = a.Authenticate(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "agent-1", id.Name)
+
+	_, err = NewAuthenticator(store, "", false).Authenticate("")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestParseBearer(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+		ok       bool
+	}{
+		{name: "Корректный заголовок", header: "Bearer abc.def", expected: "abc.def", ok: true},
+		{name: "Регистр схемы не важен", header: "bearer abc.def", expected: "abc.def", ok: true},
+		{name: "Пустой заголовок", header: ""},
+		{name: "Другая схема", header: "Basic dXNlcjpwYXNz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, ok := ParseBearer(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, token)
+		})
+	}
+}
@@ -5,26 +5,88 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
 	"github.com/caarlos0/env"
 )
 
 const (
+	DefaultMaxBodySize     = 4 << 20
+	DefaultMaxBatchSize    = 10000
+	DefaultCompressMinSize = 512
+	DefaultWALSync         = "interval"
+	DefaultSnapshotKeep    = 2
+	DefaultSnapshotFormat  = "json"
+	DefaultWALSyncInterval = 1000
+	// DefaultKVHistoryRetention сколько секунд хранится история в KV хранилище, неделя
+	DefaultKVHistoryRetention = 7 * 24 * 60 * 60
+	// DefaultDBHistoryRetention сколько секунд хранятся секции истории в PostgreSQL, неделя
+	DefaultDBHistoryRetention = 7 * 24 * 60 * 60
+	// DefaultRollupTiers сводки по минутам хранятся неделю, по часам год
+	DefaultRollupTiers = "1m:168h,1h:8760h"
+	// WALOff значение WAL_SYNC, отключающее журнал
+	WALOff                 = "off"
 	DefaultFileStoragePath = "/tmp/metrics-db.json"
-	DefaultDBConnect       = "user=nikolos password=abc123 dbname=metric sslmode=disable"
+	DefaultDBMaxOpenConns  = 10
+	DefaultDBMaxIdleConns  = 5
+	// DefaultDBConnLifetime в секундах
+	DefaultDBConnLifetime = 300
+	// DefaultDBStatementTimeout в миллисекундах
+	DefaultDBStatementTimeout = 5000
+	// DefaultDBHealthInterval в миллисекундах
+	DefaultDBHealthInterval = 5000
+	// SQLiteScheme схема DATABASE_DSN для встроенной базы SQLite: sqlite:///var/lib/metric.db
+	SQLiteScheme = "sqlite:"
 )
 
 type config struct {
-	Address         string `env:"ADDRESS" json:"address,omitempty"`
-	LogLevel        string `env:"LOG_LEVEL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH" json:"store_file,omitempty"`
-	DBConnect       string `env:"DATABASE_DSN" json:"database_dsn,omitempty"`
-	Key             string `env:"KEY"`
-	CryptoKey       string `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
-	ConfigPath      string `env:"CONFIG"`
-	TrustedSubnet   string `env:"TRUSTED_SUBNET" json:"trusted_subnet,omitempty"`
-	StoreInterval   int    `env:"STORE_INTERVAL" json:"store_interval,omitempty"`
-	Restore         bool   `env:"RESTORE" json:"restore,omitempty"`
+	Address         string  `env:"ADDRESS" json:"address,omitempty"`
+	LogLevel        string  `env:"LOG_LEVEL"`
+	FileStoragePath string  `env:"FILE_STORAGE_PATH" json:"store_file,omitempty"`
+	DBConnect       string  `env:"DATABASE_DSN" json:"database_dsn,omitempty"`
+	Key             string  `env:"KEY"`
+	CryptoKey       string  `env:"CRYPTO_KEY" json:"crypto_key,omitempty"`
+	ConfigPath      string  `env:"CONFIG"`
+	TrustedSubnet   string  `env:"TRUSTED_SUBNET" json:"trusted_subnet,omitempty"`
+	DeniedSubnets   string  `env:"DENIED_SUBNETS" json:"denied_subnets,omitempty"`
+	TrustedProxies  string  `env:"TRUSTED_PROXIES" json:"trusted_proxies,omitempty"`
+	HTTPAddress     string  `env:"HTTP_ADDRESS" json:"http_address,omitempty"`
+	TLSCert         string  `env:"TLS_CERT" json:"tls_cert,omitempty"`
+	TLSKey          string  `env:"TLS_KEY" json:"tls_key,omitempty"`
+	TLSClientCA     string  `env:"TLS_CLIENT_CA" json:"tls_client_ca,omitempty"`
+	TLSMinVersion   string  `env:"TLS_MIN_VERSION" json:"tls_min_version,omitempty"`
+	TLSClients      string  `env:"TLS_ALLOWED_CLIENTS" json:"tls_allowed_clients,omitempty"`
+	AuthTokensFile  string  `env:"AUTH_TOKENS_FILE" json:"auth_tokens_file,omitempty"`
+	AdminToken      string  `env:"ADMIN_TOKEN"`
+	WALSync         string  `env:"WAL_SYNC" json:"wal_sync,omitempty"`
+	KVPath          string  `env:"KV_STORAGE_PATH" json:"kv_storage_path,omitempty"`
+	SnapshotFormat  string  `env:"SNAPSHOT_FORMAT" json:"snapshot_format,omitempty"`
+	StoreInterval   int     `env:"STORE_INTERVAL" json:"store_interval,omitempty"`
+	SignatureWindow int     `env:"SIGNATURE_WINDOW" json:"signature_window,omitempty"`
+	RateBurst       int     `env:"RATE_BURST" json:"rate_burst,omitempty"`
+	MaxBatchSize    int     `env:"MAX_BATCH_SIZE" json:"max_batch_size,omitempty"`
+	CompressMinSize int     `env:"COMPRESS_MIN_SIZE" json:"compress_min_size,omitempty"`
+	WALSyncInterval int     `env:"WAL_SYNC_INTERVAL" json:"wal_sync_interval,omitempty"`
+	SnapshotKeep    int     `env:"SNAPSHOT_KEEP" json:"snapshot_keep,omitempty"`
+	KVHistory       int     `env:"KV_HISTORY_BUCKET" json:"kv_history_bucket,omitempty"`
+	KVRetention     int     `env:"KV_HISTORY_RETENTION" json:"kv_history_retention,omitempty"`
+	RollupTiers     string  `env:"ROLLUP_TIERS" json:"rollup_tiers,omitempty"`
+	MetricTTLRules  string  `env:"METRIC_TTL_RULES" json:"metric_ttl_rules,omitempty"`
+	MetricTTL       int     `env:"METRIC_TTL" json:"metric_ttl,omitempty"`
+	DBRetention     int     `env:"DB_HISTORY_RETENTION" json:"db_history_retention,omitempty"`
+	DBMaxOpenConns  int     `env:"DB_MAX_OPEN_CONNS" json:"db_max_open_conns,omitempty"`
+	DBMaxIdleConns  int     `env:"DB_MAX_IDLE_CONNS" json:"db_max_idle_conns,omitempty"`
+	DBConnLifetime  int     `env:"DB_CONN_MAX_LIFETIME" json:"db_conn_max_lifetime,omitempty"`
+	DBStmtTimeout   int     `env:"DB_STATEMENT_TIMEOUT" json:"db_statement_timeout,omitempty"`
+	DBHealthPeriod  int     `env:"DB_HEALTH_INTERVAL" json:"db_health_interval,omitempty"`
+	MaxBodySize     int64   `env:"MAX_BODY_SIZE" json:"max_body_size,omitempty"`
+	RateLimit       float64 `env:"RATE_LIMIT" json:"rate_limit,omitempty"`
+	Restore         bool    `env:"RESTORE" json:"restore,omitempty"`
+	AuthRequired    bool    `env:"AUTH_REQUIRED" json:"auth_required,omitempty"`
+	DBHistory       bool    `env:"DB_HISTORY" json:"db_history,omitempty"`
 }
 
 func (c *config) InitEnv() {
@@ -40,11 +102,45 @@ func (c *config) parseFlags() {
 	flag.IntVar(&c.StoreInterval, "i", 300, "store metrics to file seconds interval")
 	flag.StringVar(&c.FileStoragePath, "f", DefaultFileStoragePath, "path where store metrics")
 	flag.BoolVar(&c.Restore, "r", true, "need load from file")
-	flag.StringVar(&c.DBConnect, "d", DefaultDBConnect, "data source name for connection")
+	flag.StringVar(&c.SnapshotFormat, "snapshot-format", DefaultSnapshotFormat, "format of new snapshots: json or binary, existing snapshots of either format are read")
+	flag.IntVar(&c.SnapshotKeep, "snapshot-keep", DefaultSnapshotKeep, "number of previous snapshots kept for recovery from a corrupt one")
+	flag.StringVar(&c.WALSync, "wal-sync", DefaultWALSync, "write-ahead log fsync policy: always, interval, never or off to disable the log")
+	flag.IntVar(&c.WALSyncInterval, "wal-sync-interval", DefaultWALSyncInterval, "write-ahead log fsync interval in milliseconds for the interval policy")
+	flag.StringVar(&c.KVPath, "kv-path", "", "path to embedded key-value storage file, used instead of the database")
+	flag.IntVar(&c.KVHistory, "kv-history-bucket", 0, "width in seconds of history intervals in key-value storage, 0 to disable history")
+	flag.IntVar(&c.KVRetention, "kv-history-retention", DefaultKVHistoryRetention, "seconds to keep history in key-value storage")
+	flag.StringVar(&c.DBConnect, "d", "", "data source name for connection, sqlite:path for embedded SQLite, empty to keep metrics in memory")
+	flag.StringVar(&c.RollupTiers, "rollup-tiers", DefaultRollupTiers, "history rollup tiers as step:retention pairs, e.g. 1m:168h,1h:8760h, empty to disable")
+	flag.IntVar(&c.MetricTTL, "metric-ttl", 0, "seconds after the last write a metric is deleted, 0 to keep metrics forever")
+	flag.StringVar(&c.MetricTTLRules, "metric-ttl-rules", "", "per-name metric TTL as pattern=ttl pairs, e.g. CPU*=1h,PollCount=0, first match wins")
+	flag.BoolVar(&c.DBHistory, "db-history", false, "keep history of metric values in time-partitioned PostgreSQL tables")
+	flag.IntVar(&c.DBRetention, "db-history-retention", DefaultDBHistoryRetention, "seconds to keep history partitions in PostgreSQL, 0 to keep forever")
+	flag.IntVar(&c.DBMaxOpenConns, "db-max-open", DefaultDBMaxOpenConns, "max open connections to the database")
+	flag.IntVar(&c.DBMaxIdleConns, "db-max-idle", DefaultDBMaxIdleConns, "max idle connections to the database")
+	flag.IntVar(&c.DBConnLifetime, "db-conn-lifetime", DefaultDBConnLifetime, "max lifetime of a database connection in seconds")
+	flag.IntVar(&c.DBStmtTimeout, "db-statement-timeout", DefaultDBStatementTimeout, "database query timeout in milliseconds, 0 to disable")
+	flag.IntVar(&c.DBHealthPeriod, "db-health-interval", DefaultDBHealthInterval, "database health check interval in milliseconds")
 	flag.StringVar(&c.Key, "k", "", "secret key for hash")
-	flag.StringVar(&c.CryptoKey, "crypto-key", "", "path to private crypto key")
+	flag.IntVar(&c.SignatureWindow, "sig-window", 300, "allowed clock skew in seconds for signed requests")
+	flag.Float64Var(&c.RateLimit, "rate-limit", 0, "requests per second allowed for each client, 0 to disable")
+	flag.IntVar(&c.RateBurst, "rate-burst", 0, "burst size for the per-client rate limit, defaults to rate-limit")
+	flag.Int64Var(&c.MaxBodySize, "max-body-size", DefaultMaxBodySize, "max request body size in bytes, 0 to disable")
+	flag.IntVar(&c.MaxBatchSize, "max-batch-size", DefaultMaxBatchSize, "max metrics in one batch update, 0 to disable")
+	flag.IntVar(&c.CompressMinSize, "compress-min-size", DefaultCompressMinSize, "min HTTP response size in bytes to compress")
+	flag.StringVar(&c.CryptoKey, "crypto-key", "", "comma-separated paths to private crypto keys or key directories")
 	flag.StringVar(&c.ConfigPath, "c", "", "path to config file")
-	flag.StringVar(&c.TrustedSubnet, "t", "", "trusted subnet CIDR")
+	flag.StringVar(&c.TrustedSubnet, "t", "", "comma-separated trusted subnet CIDRs")
+	flag.StringVar(&c.DeniedSubnets, "deny-subnets", "", "comma-separated denied subnet CIDRs")
+	flag.StringVar(&c.TrustedProxies, "trusted-proxies", "", "comma-separated CIDRs of proxies allowed to set X-Real-IP and X-Forwarded-For")
+	flag.StringVar(&c.HTTPAddress, "http-a", "", "net address host:port for HTTP API, empty to disable")
+	flag.StringVar(&c.TLSCert, "tls-cert", "", "path to server TLS certificate")
+	flag.StringVar(&c.TLSKey, "tls-key", "", "path to server TLS private key")
+	flag.StringVar(&c.TLSClientCA, "tls-client-ca", "", "path to CA bundle for client certificates, enables mTLS")
+	flag.StringVar(&c.TLSMinVersion, "tls-min-version", tlsconfig.DefaultMinVersion, "minimal TLS version: 1.2 or 1.3")
+	flag.StringVar(&c.TLSClients, "tls-allowed-clients", "", "comma-separated client certificate names allowed with mTLS")
+	flag.StringVar(&c.AuthTokensFile, "auth-tokens", "", "path to file with issued agent tokens")
+	flag.StringVar(&c.AdminToken, "admin-token", "", "token for the admin API")
+	flag.BoolVar(&c.AuthRequired, "auth-required", false, "reject requests without agent token or client certificate")
 	flag.Parse()
 }
 
@@ -74,29 +170,218 @@ func (c config) GetFileStoragePath() string {
 	return c.FileStoragePath
 }
 
+// GetSnapshotFormat геттер для формата снимка
+func (c config) GetSnapshotFormat() string {
+	return c.SnapshotFormat
+}
+
+// GetSnapshotKeep геттер для числа хранимых предыдущих снимков
+func (c config) GetSnapshotKeep() int {
+	return c.SnapshotKeep
+}
+
+// GetWALEnabled геттер для флага, нужно ли вести журнал упреждающей записи
+func (c config) GetWALEnabled() bool {
+	return c.FileStoragePath != "" && c.WALSync != WALOff
+}
+
+// GetWALPath геттер для пути к журналу, он лежит рядом со снимком
+func (c config) GetWALPath() string {
+	return c.FileStoragePath + ".wal"
+}
+
+// GetWALSync геттер для политики fsync журнала
+func (c config) GetWALSync() string {
+	return c.WALSync
+}
+
+// GetWALSyncInterval геттер для интервала fsync журнала
+func (c config) GetWALSyncInterval() time.Duration {
+	return time.Duration(c.WALSyncInterval) * time.Millisecond
+}
+
+// GetKVPath геттер для пути к файлу KV хранилища, пустая строка если оно не используется
+func (c config) GetKVPath() string {
+	return c.KVPath
+}
+
+// GetKVHistoryBucket геттер для ширины интервала истории в KV хранилище
+func (c config) GetKVHistoryBucket() time.Duration {
+	return time.Duration(c.KVHistory) * time.Second
+}
+
+// GetKVHistoryRetention геттер для срока хранения истории в KV хранилище
+func (c config) GetKVHistoryRetention() time.Duration {
+	return time.Duration(c.KVRetention) * time.Second
+}
+
+// GetDBHistory геттер для флага записи истории метрик в PostgreSQL
+func (c config) GetDBHistory() bool {
+	return c.DBHistory
+}
+
+// GetDBHistoryRetention геттер для срока хранения секций истории в PostgreSQL
+func (c config) GetDBHistoryRetention() time.Duration {
+	return time.Duration(c.DBRetention) * time.Second
+}
+
+// GetRollupTiers геттер для уровней сводок истории
+func (c config) GetRollupTiers() string {
+	return c.RollupTiers
+}
+
+// GetMetricTTL геттер для общего срока жизни метрик без записи
+func (c config) GetMetricTTL() time.Duration {
+	return time.Duration(c.MetricTTL) * time.Second
+}
+
+// GetMetricTTLRules геттер для сроков жизни метрик по шаблонам имён
+func (c config) GetMetricTTLRules() string {
+	return c.MetricTTLRules
+}
+
 // GetRestore геттер для флага нужно ли хранить метрики на диске
 func (c config) GetRestore() bool {
 	return c.Restore
 }
 
-// GetDBConnection геттер для подключения к бд
+// GetDBDriver геттер для драйвера бд, он выбирается по схеме DSN
+func (c config) GetDBDriver() string {
+	if strings.HasPrefix(c.DBConnect, SQLiteScheme) {
+		return db.DriverSQLite
+	}
+
+	return db.DriverPostgres
+}
+
+// GetDBConnection геттер для подключения к бд, для SQLite без схемы
 func (c config) GetDBConnection() string {
+	if c.GetDBDriver() == db.DriverSQLite {
+		return strings.TrimPrefix(strings.TrimPrefix(c.DBConnect, SQLiteScheme+"//"), SQLiteScheme)
+	}
+
 	return c.DBConnect
 }
 
+// GetDBPoolOptions геттер для настроек пула соединений с бд
+func (c config) GetDBPoolOptions() db.PoolOptions {
+	return db.PoolOptions{
+		MaxOpenConns:    c.DBMaxOpenConns,
+		MaxIdleConns:    c.DBMaxIdleConns,
+		ConnMaxLifetime: time.Duration(c.DBConnLifetime) * time.Second,
+	}
+}
+
+// GetDBStatementTimeout геттер для таймаута запроса к бд
+func (c config) GetDBStatementTimeout() time.Duration {
+	return time.Duration(c.DBStmtTimeout) * time.Millisecond
+}
+
+// GetDBHealthInterval геттер для интервала проверки доступности бд
+func (c config) GetDBHealthInterval() time.Duration {
+	return time.Duration(c.DBHealthPeriod) * time.Millisecond
+}
+
 // GetKey геттер для секретного ключа для хеширования
 func (c config) GetKey() string {
 	return c.Key
 }
 
-// GetCryptoKeyPath геттер для пути к приватному ключу шифрования
-func (c config) GetCryptoKeyPath() string {
-	return c.CryptoKey
+// GetSignatureWindow геттер для окна, в котором принимаются подписанные запросы
+func (c config) GetSignatureWindow() time.Duration {
+	return time.Duration(c.SignatureWindow) * time.Second
+}
+
+// GetRateLimit геттер для лимита запросов в секунду на клиента
+func (c config) GetRateLimit() float64 {
+	return c.RateLimit
+}
+
+// GetRateBurst геттер для размера всплеска запросов на клиента
+func (c config) GetRateBurst() int {
+	return c.RateBurst
 }
 
-// GetTrustedSubnet геттер для CIDR
-func (c config) GetTrustedSubnet() string {
-	return c.TrustedSubnet
+// GetMaxBodySize геттер для максимального размера тела запроса в байтах
+func (c config) GetMaxBodySize() int64 {
+	return c.MaxBodySize
+}
+
+// GetMaxBatchSize геттер для максимального числа метрик в пачке
+func (c config) GetMaxBatchSize() int {
+	return c.MaxBatchSize
+}
+
+// GetCompressMinSize геттер для минимального размера HTTP ответа, который сжимается
+func (c config) GetCompressMinSize() int {
+	return c.CompressMinSize
+}
+
+// GetCryptoKeyPaths геттер для путей к активным приватным ключам шифрования,
+// несколько ключей перечисляются через запятую на время ротации
+func (c config) GetCryptoKeyPaths() []string {
+	return splitList(c.CryptoKey)
+}
+
+// GetTrustedSubnets геттер для разрешённых подсетей
+func (c config) GetTrustedSubnets() []string {
+	return splitList(c.TrustedSubnet)
+}
+
+// GetDeniedSubnets геттер для запрещённых подсетей
+func (c config) GetDeniedSubnets() []string {
+	return splitList(c.DeniedSubnets)
+}
+
+// GetTrustedProxies геттер для подсетей доверенных прокси
+func (c config) GetTrustedProxies() []string {
+	return splitList(c.TrustedProxies)
+}
+
+// GetHTTPAddress геттер для адреса HTTP API, пустая строка если HTTP отключён
+func (c config) GetHTTPAddress() string {
+	return c.HTTPAddress
+}
+
+// GetTLSOptions геттер для настроек TLS слушателей
+func (c config) GetTLSOptions() tlsconfig.Options {
+	return tlsconfig.Options{
+		CertFile:   c.TLSCert,
+		KeyFile:    c.TLSKey,
+		CAFile:     c.TLSClientCA,
+		MinVersion: c.TLSMinVersion,
+	}
+}
+
+// GetTLSAllowedClients геттер для имён клиентских сертификатов, допущенных при mTLS
+func (c config) GetTLSAllowedClients() []string {
+	return splitList(c.TLSClients)
+}
+
+// GetAuthTokensFile геттер для пути к файлу с токенами агентов
+func (c config) GetAuthTokensFile() string {
+	return c.AuthTokensFile
+}
+
+// GetAdminToken геттер для токена административного API
+func (c config) GetAdminToken() string {
+	return c.AdminToken
+}
+
+// GetAuthRequired геттер для флага обязательной аутентификации
+func (c config) GetAuthRequired() bool {
+	return c.AuthRequired
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
 
 func (c *config) loadFromJSON() {
@@ -122,16 +407,108 @@ func (c *config) loadFromJSON() {
 		c.Restore = tempConfig.Restore
 	}
 
+	if c.SnapshotFormat == DefaultSnapshotFormat && tempConfig.SnapshotFormat != "" {
+		c.SnapshotFormat = tempConfig.SnapshotFormat
+	}
+
+	if c.SnapshotKeep == DefaultSnapshotKeep && tempConfig.SnapshotKeep != 0 {
+		c.SnapshotKeep = tempConfig.SnapshotKeep
+	}
+
+	if c.WALSync == DefaultWALSync && tempConfig.WALSync != "" {
+		c.WALSync = tempConfig.WALSync
+	}
+
+	if c.WALSyncInterval == DefaultWALSyncInterval && tempConfig.WALSyncInterval != 0 {
+		c.WALSyncInterval = tempConfig.WALSyncInterval
+	}
+
+	if c.KVPath == "" && tempConfig.KVPath != "" {
+		c.KVPath = tempConfig.KVPath
+	}
+
+	if c.KVHistory == 0 && tempConfig.KVHistory != 0 {
+		c.KVHistory = tempConfig.KVHistory
+	}
+
+	if c.KVRetention == DefaultKVHistoryRetention && tempConfig.KVRetention != 0 {
+		c.KVRetention = tempConfig.KVRetention
+	}
+
+	if c.RollupTiers == DefaultRollupTiers && tempConfig.RollupTiers != "" {
+		c.RollupTiers = tempConfig.RollupTiers
+	}
+
+	if c.MetricTTL == 0 && tempConfig.MetricTTL != 0 {
+		c.MetricTTL = tempConfig.MetricTTL
+	}
+
+	if c.MetricTTLRules == "" && tempConfig.MetricTTLRules != "" {
+		c.MetricTTLRules = tempConfig.MetricTTLRules
+	}
+
+	if !c.DBHistory && tempConfig.DBHistory {
+		c.DBHistory = tempConfig.DBHistory
+	}
+
+	if c.DBRetention == DefaultDBHistoryRetention && tempConfig.DBRetention != 0 {
+		c.DBRetention = tempConfig.DBRetention
+	}
+
+	if c.DBMaxOpenConns == DefaultDBMaxOpenConns && tempConfig.DBMaxOpenConns != 0 {
+		c.DBMaxOpenConns = tempConfig.DBMaxOpenConns
+	}
+
+	if c.DBMaxIdleConns == DefaultDBMaxIdleConns && tempConfig.DBMaxIdleConns != 0 {
+		c.DBMaxIdleConns = tempConfig.DBMaxIdleConns
+	}
+
+	if c.DBConnLifetime == DefaultDBConnLifetime && tempConfig.DBConnLifetime != 0 {
+		c.DBConnLifetime = tempConfig.DBConnLifetime
+	}
+
+	if c.DBStmtTimeout == DefaultDBStatementTimeout && tempConfig.DBStmtTimeout != 0 {
+		c.DBStmtTimeout = tempConfig.DBStmtTimeout
+	}
+
+	if c.DBHealthPeriod == DefaultDBHealthInterval && tempConfig.DBHealthPeriod != 0 {
+		c.DBHealthPeriod = tempConfig.DBHealthPeriod
+	}
+
 	if c.StoreInterval == 300 && tempConfig.StoreInterval != 300 {
 		c.StoreInterval = tempConfig.StoreInterval
 	}
 
+	if c.SignatureWindow == 300 && tempConfig.SignatureWindow != 0 {
+		c.SignatureWindow = tempConfig.SignatureWindow
+	}
+
+	if c.RateLimit == 0 && tempConfig.RateLimit != 0 {
+		c.RateLimit = tempConfig.RateLimit
+	}
+
+	if c.RateBurst == 0 && tempConfig.RateBurst != 0 {
+		c.RateBurst = tempConfig.RateBurst
+	}
+
+	if c.MaxBodySize == DefaultMaxBodySize && tempConfig.MaxBodySize != 0 {
+		c.MaxBodySize = tempConfig.MaxBodySize
+	}
+
+	if c.MaxBatchSize == DefaultMaxBatchSize && tempConfig.MaxBatchSize != 0 {
+		c.MaxBatchSize = tempConfig.MaxBatchSize
+	}
+
+	if c.CompressMinSize == DefaultCompressMinSize && tempConfig.CompressMinSize != 0 {
+		c.CompressMinSize = tempConfig.CompressMinSize
+	}
+
 	if c.FileStoragePath == DefaultFileStoragePath && tempConfig.FileStoragePath != DefaultFileStoragePath {
 		c.FileStoragePath = tempConfig.FileStoragePath
 	}
 
-	if c.DBConnect == DefaultDBConnect && tempConfig.FileStoragePath != DefaultDBConnect {
-		c.FileStoragePath = tempConfig.FileStoragePath
+	if c.DBConnect == "" && tempConfig.DBConnect != "" {
+		c.DBConnect = tempConfig.DBConnect
 	}
 
 	if c.CryptoKey == "" && tempConfig.CryptoKey != "" {
@@ -141,4 +518,44 @@ func (c *config) loadFromJSON() {
 	if c.TrustedSubnet == "" && tempConfig.TrustedSubnet != "" {
 		c.TrustedSubnet = tempConfig.TrustedSubnet
 	}
+
+	if c.DeniedSubnets == "" && tempConfig.DeniedSubnets != "" {
+		c.DeniedSubnets = tempConfig.DeniedSubnets
+	}
+
+	if c.TrustedProxies == "" && tempConfig.TrustedProxies != "" {
+		c.TrustedProxies = tempConfig.TrustedProxies
+	}
+
+	if c.HTTPAddress == "" && tempConfig.HTTPAddress != "" {
+		c.HTTPAddress = tempConfig.HTTPAddress
+	}
+
+	if c.TLSCert == "" && tempConfig.TLSCert != "" {
+		c.TLSCert = tempConfig.TLSCert
+	}
+
+	if c.TLSKey == "" && tempConfig.TLSKey != "" {
+		c.TLSKey = tempConfig.TLSKey
+	}
+
+	if c.TLSClientCA == "" && tempConfig.TLSClientCA != "" {
+		c.TLSClientCA = tempConfig.TLSClientCA
+	}
+
+	if c.TLSMinVersion == tlsconfig.DefaultMinVersion && tempConfig.TLSMinVersion != "" {
+		c.TLSMinVersion = tempConfig.TLSMinVersion
+	}
+
+	if c.TLSClients == "" && tempConfig.TLSClients != "" {
+		c.TLSClients = tempConfig.TLSClients
+	}
+
+	if c.AuthTokensFile == "" && tempConfig.AuthTokensFile != "" {
+		c.AuthTokensFile = tempConfig.AuthTokensFile
+	}
+
+	if !c.AuthRequired && tempConfig.AuthRequired {
+		c.AuthRequired = tempConfig.AuthRequired
+	}
 }
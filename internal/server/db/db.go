@@ -12,7 +12,7 @@ import (
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 func InitDB(dataSourceName string) (*sqlx.DB, error) {
@@ -78,18 +78,35 @@ func runMigrations(db *sqlx.DB) error {
 }
 
 func isRetriableError(err error) bool {
+	code, ok := pgCode(err)
+	if !ok {
+		return false
+	}
+
+	switch code {
+	case pgerrcode.SerializationFailure,
+		pgerrcode.DeadlockDetected,
+		pgerrcode.LockNotAvailable,
+		pgerrcode.UniqueViolation,
+		pgerrcode.ConnectionException,
+		pgerrcode.ConnectionDoesNotExist,
+		pgerrcode.ConnectionFailure:
+		return true
+	}
+	return false
+}
+
+// pgCode код ошибки Postgres как от lib/pq, через который работает сервер, так и от pgx
+func pgCode(err error) (string, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code), true
+	}
+
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
-		switch pgErr.Code {
-		case pgerrcode.SerializationFailure,
-			pgerrcode.DeadlockDetected,
-			pgerrcode.LockNotAvailable,
-			pgerrcode.UniqueViolation,
-			pgerrcode.ConnectionException,
-			pgerrcode.ConnectionDoesNotExist,
-			pgerrcode.ConnectionFailure:
-			return true
-		}
+		return pgErr.Code, true
 	}
-	return false
+
+	return "", false
 }
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// PoolOptions настройки пула соединений, нулевые значения оставляют умолчания database/sql
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// ConfigurePool применяет настройки пула к базе
+func ConfigurePool(db *sqlx.DB, opts PoolOptions) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+}
+
+type customLogger interface {
+	Info(string, ...zap.Field)
+}
+
+type pinger interface {
+	PingContext(context.Context) error
+	Stats() sql.DBStats
+}
+
+// HealthStats состояние базы и пула соединений на момент последней проверки
+type HealthStats struct {
+	LastCheck          time.Time `json:"last_check"`
+	LastError          string    `json:"last_error,omitempty"`
+	Healthy            bool      `json:"healthy"`
+	MaxOpenConnections int       `json:"max_open_connections"`
+	OpenConnections    int       `json:"open_connections"`
+	InUse              int       `json:"in_use"`
+	Idle               int       `json:"idle"`
+	WaitCount          int64     `json:"wait_count"`
+	WaitDuration       string    `json:"wait_duration"`
+	MaxIdleClosed      int64     `json:"max_idle_closed"`
+	MaxLifetimeClosed  int64     `json:"max_lifetime_closed"`
+}
+
+// HealthChecker в фоне проверяет доступность базы, чтобы /ping и запись
+// не ждали соединения с недоступной базой
+type HealthChecker struct {
+	db        pinger
+	log       customLogger
+	lastCheck time.Time
+	lastErr   error
+	interval  time.Duration
+	timeout   time.Duration
+	mu        sync.Mutex
+	healthy   atomic.Bool
+}
+
+// NewHealthChecker конструктор, база считается доступной до первой неудачной проверки
+func NewHealthChecker(db pinger, log customLogger, interval, timeout time.Duration) *HealthChecker {
+	h := &HealthChecker{
+		db:       db,
+		log:      log,
+		interval: interval,
+		timeout:  timeout,
+	}
+	h.healthy.Store(true)
+
+	return h
+}
+
+// Check пингует базу и запоминает результат
+func (h *HealthChecker) Check(ctx context.Context) bool {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	err := h.db.PingContext(ctx)
+	h.mu.Lock()
+	h.lastCheck = time.Now()
+	h.lastErr = err
+	h.mu.Unlock()
+	h.setHealthy(err == nil, err)
+
+	return err == nil
+}
+
+// MarkDown отмечает базу недоступной до следующей удачной проверки,
+// его вызывают те, кто получил ошибку соединения
+func (h *HealthChecker) MarkDown(err error) {
+	h.mu.Lock()
+	h.lastErr = err
+	h.mu.Unlock()
+	h.setHealthy(false, err)
+}
+
+func (h *HealthChecker) setHealthy(healthy bool, err error) {
+	if h.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		h.log.Info("database is available again")
+	} else {
+		h.log.Info("database is unavailable", zap.Error(err))
+	}
+}
+
+// Healthy результат последней проверки
+func (h *HealthChecker) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// Run проверяет базу раз в interval до отмены ctx
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.Check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Stats состояние базы и статистика пула соединений
+func (h *HealthChecker) Stats() HealthStats {
+	pool := h.db.Stats()
+	stats := HealthStats{
+		Healthy:            h.Healthy(),
+		MaxOpenConnections: pool.MaxOpenConnections,
+		OpenConnections:    pool.OpenConnections,
+		InUse:              pool.InUse,
+		Idle:               pool.Idle,
+		WaitCount:          pool.WaitCount,
+		WaitDuration:       pool.WaitDuration.String(),
+		MaxIdleClosed:      pool.MaxIdleClosed,
+		MaxLifetimeClosed:  pool.MaxLifetimeClosed,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats.LastCheck = h.lastCheck
+	if h.lastErr != nil {
+		stats.LastError = h.lastErr.Error()
+	}
+
+	return stats
+}
+
+// IsConnectionError сообщает, что запрос не выполнен из-за недоступности базы,
+// а не из-за самого запроса
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	if code, ok := pgCode(err); ok {
+		return pgerrcode.IsConnectionException(code) ||
+			code == pgerrcode.AdminShutdown ||
+			code == pgerrcode.CrashShutdown ||
+			code == pgerrcode.CannotConnectNow
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakePinger struct {
+	err error
+}
+
+func (fp *fakePinger) PingContext(context.Context) error {
+	return fp.err
+}
+
+func (fp *fakePinger) Stats() sql.DBStats {
+	return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}
+}
+
+func TestHealthChecker(t *testing.T) {
+	db := &fakePinger{}
+	h := NewHealthChecker(db, zap.NewNop(), time.Second, time.Second)
+	assert.True(t, h.Healthy())
+
+	db.err = errors.New("connection refused")
+	assert.False(t, h.Check(context.Background()))
+	stats := h.Stats()
+	assert.False(t, stats.Healthy)
+	assert.Equal(t, "connection refused", stats.LastError)
+	assert.Equal(t, 3, stats.OpenConnections)
+
+	db.err = nil
+	assert.True(t, h.Check(context.Background()))
+	assert.Empty(t, h.Stats().LastError)
+
+	h.MarkDown(driver.ErrBadConn)
+	assert.False(t, h.Healthy())
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "нет ошибки", err: nil, want: false},
+		{name: "битое соединение", err: fmt.Errorf("upsert: %w", driver.ErrBadConn), want: true},
+		{name: "таймаут запроса", err: context.DeadlineExceeded, want: true},
+		{name: "соединение потеряно", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "база останавливается", err: &pq.Error{Code: "57P01"}, want: true},
+		{name: "ошибка запроса", err: &pq.Error{Code: "42601"}, want: false},
+		{name: "нет строк", err: sql.ErrNoRows, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsConnectionError(tt.err))
+		})
+	}
+}
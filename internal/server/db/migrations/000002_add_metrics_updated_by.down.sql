@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE metrics DROP COLUMN IF EXISTS updated_by;
+
+COMMIT;
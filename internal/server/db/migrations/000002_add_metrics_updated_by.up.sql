@@ -0,0 +1,5 @@
+BEGIN TRANSACTION;
+
+ALTER TABLE metrics ADD COLUMN IF NOT EXISTS updated_by VARCHAR NULL;
+
+COMMIT;
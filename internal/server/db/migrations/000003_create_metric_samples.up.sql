@@ -0,0 +1,16 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS metric_samples(
+   id VARCHAR NOT NULL,
+   type VARCHAR (50) NOT NULL,
+   delta BIGINT NULL,
+   value DOUBLE PRECISION NULL,
+   updated_by VARCHAR NULL,
+   recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+) PARTITION BY RANGE (recorded_at);
+
+CREATE INDEX IF NOT EXISTS metric_samples_id_recorded_at ON metric_samples (id, recorded_at);
+
+CREATE TABLE IF NOT EXISTS metric_samples_default PARTITION OF metric_samples DEFAULT;
+
+COMMIT;
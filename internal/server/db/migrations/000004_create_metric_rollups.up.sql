@@ -0,0 +1,17 @@
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS metric_rollups(
+   step_seconds INTEGER NOT NULL,
+   id VARCHAR NOT NULL,
+   bucket_start TIMESTAMPTZ NOT NULL,
+   type VARCHAR (50) NOT NULL,
+   count BIGINT NOT NULL,
+   min DOUBLE PRECISION NOT NULL DEFAULT 0,
+   max DOUBLE PRECISION NOT NULL DEFAULT 0,
+   avg DOUBLE PRECISION NOT NULL DEFAULT 0,
+   delta BIGINT NOT NULL DEFAULT 0,
+   rate DOUBLE PRECISION NOT NULL DEFAULT 0,
+   PRIMARY KEY (step_seconds, id, bucket_start)
+);
+
+COMMIT;
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	// SamplesTable секционированная по времени таблица истории метрик
+	SamplesTable = "metric_samples"
+	// PartitionsAhead на сколько суток вперёд секции создаются заранее
+	PartitionsAhead = 3
+	// PartitionMaintenanceInterval как часто проверяются секции
+	PartitionMaintenanceInterval = time.Hour
+
+	partitionDay    = 24 * time.Hour
+	partitionLayout = "20060102"
+	defaultSuffix   = "default"
+)
+
+// Partitions создаёт суточные секции metric_samples заранее и удаляет секции
+// старше срока хранения. Записи вне секций попадают в metric_samples_default
+type Partitions struct {
+	db        *sqlx.DB
+	log       customLogger
+	retention time.Duration
+}
+
+// NewPartitions конструктор, retention 0 хранит историю бессрочно
+func NewPartitions(db *sqlx.DB, log customLogger, retention time.Duration) *Partitions {
+	return &Partitions{
+		db:        db,
+		log:       log,
+		retention: retention,
+	}
+}
+
+// Maintain создаёт секции с суток now на PartitionsAhead суток вперёд
+// и удаляет секции, целиком вышедшие за срок хранения
+func (p *Partitions) Maintain(ctx context.Context, now time.Time) error {
+	for _, day := range partitionDays(now, PartitionsAhead) {
+		if err := p.createPartition(ctx, day); err != nil {
+			return fmt.Errorf("create partition %s: %w", partitionName(day), err)
+		}
+	}
+
+	if p.retention <= 0 {
+		return nil
+	}
+	cutoff := now.Add(-p.retention)
+
+	var names []string
+	err := p.db.SelectContext(ctx, &names,
+		`SELECT child.relname FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = $1`,
+		SamplesTable,
+	)
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+
+	for _, name := range expiredPartitions(names, cutoff) {
+		if _, err := p.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+			return fmt.Errorf("drop partition %s: %w", name, err)
+		}
+		p.log.Info("history partition dropped", zap.String("partition", name))
+	}
+
+	_, err = p.db.ExecContext(ctx,
+		fmt.Sprintf("DELETE FROM %s_%s WHERE recorded_at < $1", SamplesTable, defaultSuffix),
+		cutoff,
+	)
+	if err != nil {
+		return fmt.Errorf("clean default partition: %w", err)
+	}
+
+	return nil
+}
+
+// createPartition создаёт секцию суток day. Если обслуживание секций прерывалось,
+// записи этих суток уже лежат в секции по умолчанию, и создать секцию поверх них
+// нельзя: они переносятся в новую таблицу, и она подключается как секция в той же транзакции
+func (p *Partitions) createPartition(ctx context.Context, day time.Time) error {
+	name := partitionName(day)
+	var exists bool
+	if err := p.db.GetContext(ctx, &exists, "SELECT to_regclass($1) IS NOT NULL", name); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	from, to := partitionBounds(day)
+	return RunInTx(ctx, p.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS)", name, SamplesTable,
+		))
+		if err != nil {
+			return err
+		}
+		moved, err := tx.ExecContext(ctx, fmt.Sprintf(
+			`WITH moved AS (
+				DELETE FROM %s_%s WHERE recorded_at >= $1 AND recorded_at < $2 RETURNING *
+			)
+			INSERT INTO %s SELECT * FROM moved`,
+			SamplesTable, defaultSuffix, name,
+		), from, to)
+		if err != nil {
+			return err
+		}
+		if rows, err := moved.RowsAffected(); err == nil && rows > 0 {
+			p.log.Info("history moved out of default partition", zap.String("partition", name), zap.Int64("rows", rows))
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			"ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+			SamplesTable, name, from.Format(time.RFC3339), to.Format(time.RFC3339),
+		))
+
+		return err
+	})
+}
+
+// Run раз в interval проверяет секции до отмены ctx
+func (p *Partitions) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Maintain(ctx, time.Now()); err != nil {
+				p.log.Info("cannot maintain history partitions", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// partitionDays начала суток (UTC) с now на ahead суток вперёд
+func partitionDays(now time.Time, ahead int) []time.Time {
+	first := now.UTC().Truncate(partitionDay)
+	days := make([]time.Time, 0, ahead+1)
+	for i := 0; i <= ahead; i++ {
+		days = append(days, first.Add(time.Duration(i)*partitionDay))
+	}
+
+	return days
+}
+
+func partitionBounds(day time.Time) (time.Time, time.Time) {
+	return day, day.Add(partitionDay)
+}
+
+func partitionName(day time.Time) string {
+	return SamplesTable + "_" + day.Format(partitionLayout)
+}
+
+// expiredPartitions секции, все записи которых старше cutoff. Секция по умолчанию
+// и таблицы с чужими именами не трогаются
+func expiredPartitions(names []string, cutoff time.Time) []string {
+	var expired []string
+	for _, name := range names {
+		suffix, ok := strings.CutPrefix(name, SamplesTable+"_")
+		if !ok || suffix == defaultSuffix {
+			continue
+		}
+		day, err := time.Parse(partitionLayout, suffix)
+		if err != nil {
+			continue
+		}
+		if _, to := partitionBounds(day); !to.After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+
+	return expired
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPartitionDays(t *testing.T) {
+	now := time.Date(2024, 12, 31, 23, 30, 0, 0, time.FixedZone("MSK", 3*60*60))
+	days := partitionDays(now, 2)
+
+	names := make([]string, 0, len(days))
+	for _, day := range days {
+		names = append(names, partitionName(day))
+	}
+	assert.Equal(t, []string{"metric_samples_20241231", "metric_samples_20250101", "metric_samples_20250102"}, names)
+
+	from, to := partitionBounds(days[0])
+	assert.Equal(t, time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), to)
+}
+
+func TestExpiredPartitions(t *testing.T) {
+	names := []string{
+		"metric_samples_default",
+		"metric_samples_20240101",
+		"metric_samples_20240102",
+		"metric_samples_20240103",
+		"metric_samples_manual",
+		"other_20230101",
+	}
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		want   []string
+	}{
+		{
+			name:   "секция удаляется, когда закончилась до cutoff",
+			cutoff: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			want:   []string{"metric_samples_20240101", "metric_samples_20240102"},
+		},
+		{
+			name:   "секция с записями новее cutoff остаётся",
+			cutoff: time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC),
+			want:   []string{"metric_samples_20240101"},
+		},
+		{
+			name:   "нечего удалять",
+			cutoff: time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, expiredPartitions(names, tt.cutoff))
+		})
+	}
+}
+
+func TestPartitions_MaintainMovesDefaultRows(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		// в CI база поднимается всегда, пропуск там означал бы непроверенные секции
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_DATABASE_DSN не задан")
+		}
+		t.Skip("TEST_DATABASE_DSN не задан")
+	}
+	database, err := InitDB(dsn)
+	require.NoError(t, err)
+	defer database.Close()
+
+	// сутки далеко впереди: их секции ещё нет, и запись попадает в секцию по умолчанию
+	day := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+	name := partitionName(day)
+	_, err = database.Exec("DROP TABLE IF EXISTS " + name)
+	require.NoError(t, err)
+	_, err = database.Exec(
+		"INSERT INTO metric_samples (id, type, delta, recorded_at) VALUES ('PollCount', 'counter', 1, $1)",
+		day.Add(time.Hour),
+	)
+	require.NoError(t, err)
+	defer func() {
+		for _, d := range partitionDays(day, PartitionsAhead) {
+			_, _ = database.Exec("DROP TABLE IF EXISTS " + partitionName(d))
+		}
+	}()
+
+	require.NoError(t, NewPartitions(database, zap.NewNop(), 0).Maintain(context.Background(), day))
+
+	var moved int
+	require.NoError(t, database.Get(&moved, "SELECT count(*) FROM "+name))
+	assert.Equal(t, 1, moved, "запись перенесена в новую секцию")
+	var left int
+	require.NoError(t, database.Get(&left, "SELECT count(*) FROM metric_samples_default WHERE recorded_at >= $1", day))
+	assert.Zero(t, left)
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Драйверы database/sql, которые умеет открывать Open
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
+
+// ErrSQLiteUnavailable сервер собран без cgo, а драйвер mattn/go-sqlite3 без него не работает
+var ErrSQLiteUnavailable = errors.New("sqlite storage requires a build with CGO_ENABLED=1")
+
+// Open подключается к базе драйвером driver и применяет миграции
+func Open(driver, dataSourceName string) (*sqlx.DB, error) {
+	switch driver {
+	case DriverSQLite:
+		return InitSQLite(dataSourceName)
+	case DriverPostgres, "":
+		return InitDB(dataSourceName)
+	}
+
+	return nil, fmt.Errorf("unknown database driver %q", driver)
+}
@@ -0,0 +1,60 @@
+//go:build cgo
+
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// InitSQLite открывает файл базы SQLite, при необходимости создавая его, и применяет миграции.
+// SQLite допускает одного писателя, поэтому соединение с базой одно, а запросы
+// выполняются по очереди; заодно ":memory:" остаётся одной базой, а не базой на соединение
+func InitSQLite(dataSourceName string) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(DriverSQLite, dataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := runSQLiteMigrations(db); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return db, nil
+}
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrationsDir embed.FS
+
+func runSQLiteMigrations(db *sqlx.DB) error {
+	d, err := iofs.New(sqliteMigrationsDir, "sqlite_migrations")
+	if err != nil {
+		return fmt.Errorf("failed to return an iofs driver: %w", err)
+	}
+
+	instance, err := sqlite3.WithInstance(db.DB, &sqlite3.Config{})
+	if err != nil {
+		return fmt.Errorf("failed to get instance: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs:sqlite_migrations", d, DriverSQLite, instance)
+	if err != nil {
+		return fmt.Errorf("failed to get a new migrate instance: %w", err)
+	}
+
+	if err := m.Up(); err != nil {
+		if !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("failed to apply migrations to the DB: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1 @@
+ALTER TABLE metrics ADD COLUMN updated_by TEXT NULL;
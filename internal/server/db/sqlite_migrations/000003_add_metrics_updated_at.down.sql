@@ -0,0 +1 @@
+ALTER TABLE metrics DROP COLUMN updated_at;
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package db
+
+import "github.com/jmoiron/sqlx"
+
+// InitSQLite в сборке без cgo сразу возвращает ErrSQLiteUnavailable, а не заглушку драйвера,
+// которая падает только на первом запросе
+func InitSQLite(string) (*sqlx.DB, error) {
+	return nil, ErrSQLiteUnavailable
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jmoiron/sqlx"
+)
+
+// TxRetryIntervals паузы перед повторами транзакции, к каждой добавляется
+// случайная добавка до половины паузы, чтобы повторы конкурентов не совпадали
+var TxRetryIntervals = []time.Duration{50 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond}
+
+type txBeginner interface {
+	BeginTxx(context.Context, *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// RunInTx выполняет fn в транзакции и повторяет её целиком при временных ошибках:
+// конфликте сериализации, взаимной блокировке, потере соединения.
+// fn может вызываться несколько раз и не должна менять ничего вне транзакции
+func RunInTx(ctx context.Context, db txBeginner, fn func(*sqlx.Tx) error) error {
+	return runInTx(ctx, db, TxRetryIntervals, fn)
+}
+
+func runInTx(ctx context.Context, db txBeginner, intervals []time.Duration, fn func(*sqlx.Tx) error) error {
+	for attempt := 0; ; attempt++ {
+		err := tryTx(ctx, db, fn)
+		if err == nil {
+			return nil
+		}
+
+		if IsCommitError(err) || attempt >= len(intervals) || !IsRetriableError(err) || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(jitter(intervals[attempt]))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		}
+	}
+}
+
+// commitError ошибка COMMIT: при потере соединения неизвестно, применилась ли
+// транзакция, поэтому такие ошибки не повторяются, чтобы не сложить counter дважды
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return fmt.Sprintf("commit transaction: %v", e.err)
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+// IsCommitError сообщает, что ошибка случилась на COMMIT. Такую транзакцию нельзя
+// повторять ни здесь, ни выше: при потере соединения она могла уже примениться
+func IsCommitError(err error) bool {
+	var commitErr *commitError
+
+	return errors.As(err, &commitErr)
+}
+
+func tryTx(ctx context.Context, db txBeginner, fn func(*sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &commitError{err: err}
+	}
+
+	return nil
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+
+	return d + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// IsRetriableError сообщает, что транзакцию стоит повторить: её отменила сама база
+// из-за конкурентов или соединение было потеряно. Истёкший или отменённый
+// контекст повторять бессмысленно
+func IsRetriableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if code, ok := pgCode(err); ok {
+		switch code {
+		case pgerrcode.SerializationFailure,
+			pgerrcode.DeadlockDetected,
+			pgerrcode.LockNotAvailable:
+			return true
+		}
+	}
+
+	return IsConnectionError(err)
+}
@@ -0,0 +1,236 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePostgres подставная база: каждый Exec возвращает очередную ошибку из execErrs,
+// а после них выполняется успешно
+type fakePostgres struct {
+	mu        sync.Mutex
+	execErrs  []error
+	commitErr error
+	execs     int
+	commits   int
+	rollbacks int
+}
+
+func (fp *fakePostgres) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: fp}, nil
+}
+
+func (fp *fakePostgres) Driver() driver.Driver {
+	return nil
+}
+
+func (fp *fakePostgres) exec() error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	fp.execs++
+	if len(fp.execErrs) == 0 {
+		return nil
+	}
+	err := fp.execErrs[0]
+	fp.execErrs = fp.execErrs[1:]
+
+	return err
+}
+
+type fakeConn struct {
+	db *fakePostgres
+}
+
+func (fc *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return &fakeStmt{db: fc.db}, nil
+}
+
+func (fc *fakeConn) Close() error {
+	return nil
+}
+
+func (fc *fakeConn) Begin() (driver.Tx, error) {
+	return &fakeTx{db: fc.db}, nil
+}
+
+type fakeStmt struct {
+	db *fakePostgres
+}
+
+func (fs *fakeStmt) Close() error {
+	return nil
+}
+
+func (fs *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (fs *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	if err := fs.db.exec(); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func (fs *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+type fakeTx struct {
+	db *fakePostgres
+}
+
+func (ft *fakeTx) Commit() error {
+	ft.db.mu.Lock()
+	defer ft.db.mu.Unlock()
+	ft.db.commits++
+
+	return ft.db.commitErr
+}
+
+func (ft *fakeTx) Rollback() error {
+	ft.db.mu.Lock()
+	defer ft.db.mu.Unlock()
+	ft.db.rollbacks++
+
+	return nil
+}
+
+func openFake(fp *fakePostgres) *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(fp), DriverPostgres)
+}
+
+func insert(tx *sqlx.Tx) error {
+	_, err := tx.Exec("INSERT INTO metrics (id) VALUES ($1)", "PollCount")
+	return err
+}
+
+func TestRunInTx(t *testing.T) {
+	intervals := []time.Duration{time.Millisecond, time.Millisecond}
+	tests := []struct {
+		name      string
+		execErrs  []error
+		commitErr error
+		wantErr   bool
+		wantExecs int
+	}{
+		{name: "без ошибок", wantExecs: 1},
+		{
+			name:      "конфликт сериализации повторяется",
+			execErrs:  []error{&pq.Error{Code: "40001"}},
+			wantExecs: 2,
+		},
+		{
+			name:      "взаимная блокировка и обрыв соединения",
+			execErrs:  []error{&pq.Error{Code: "40P01"}, &pq.Error{Code: "08006"}},
+			wantExecs: 3,
+		},
+		{
+			name:      "повторы исчерпаны",
+			execErrs:  []error{&pq.Error{Code: "40001"}, &pq.Error{Code: "40001"}, &pq.Error{Code: "40001"}},
+			wantErr:   true,
+			wantExecs: 3,
+		},
+		{
+			name:      "ошибка запроса не повторяется",
+			execErrs:  []error{&pq.Error{Code: "42601"}},
+			wantErr:   true,
+			wantExecs: 1,
+		},
+		{
+			name:      "обрыв на commit не повторяется",
+			commitErr: &pq.Error{Code: "08006"},
+			wantErr:   true,
+			wantExecs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := &fakePostgres{execErrs: tt.execErrs, commitErr: tt.commitErr}
+			database := openFake(fp)
+			defer database.Close()
+
+			err := runInTx(context.Background(), database, intervals, insert)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantExecs, fp.execs)
+		})
+	}
+}
+
+func TestRunInTx_RollbackOnError(t *testing.T) {
+	fp := &fakePostgres{execErrs: []error{&pq.Error{Code: "40001"}}}
+	database := openFake(fp)
+	defer database.Close()
+
+	require.NoError(t, runInTx(context.Background(), database, []time.Duration{time.Millisecond}, insert))
+	assert.Equal(t, 1, fp.rollbacks)
+	assert.Equal(t, 1, fp.commits)
+}
+
+func TestRunInTx_ContextCancel(t *testing.T) {
+	fp := &fakePostgres{execErrs: []error{&pq.Error{Code: "40001"}}}
+	database := openFake(fp)
+	defer database.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := runInTx(ctx, database, []time.Duration{time.Minute}, insert)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, fp.execs, "пауза прервана отменой контекста")
+}
+
+func TestIsCommitError(t *testing.T) {
+	fp := &fakePostgres{commitErr: driver.ErrBadConn}
+	database := openFake(fp)
+	defer database.Close()
+
+	err := runInTx(context.Background(), database, []time.Duration{time.Millisecond}, insert)
+	assert.True(t, IsCommitError(err))
+	assert.True(t, IsConnectionError(err), "обрыв на commit выглядит как недоступность базы, поэтому вызывающему нужен IsCommitError")
+	assert.Equal(t, 1, fp.commits)
+
+	fp = &fakePostgres{execErrs: []error{driver.ErrBadConn, driver.ErrBadConn}}
+	database = openFake(fp)
+	defer database.Close()
+
+	err = runInTx(context.Background(), database, []time.Duration{time.Millisecond}, insert)
+	assert.True(t, IsConnectionError(err))
+	assert.False(t, IsCommitError(err), "обрыв до commit")
+}
+
+func TestIsRetriableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "нет ошибки", err: nil, want: false},
+		{name: "конфликт сериализации", err: &pq.Error{Code: "40001"}, want: true},
+		{name: "строка заблокирована", err: &pq.Error{Code: "55P03"}, want: true},
+		{name: "битое соединение", err: driver.ErrBadConn, want: true},
+		{name: "истёк контекст", err: context.DeadlineExceeded, want: false},
+		{name: "нарушение уникальности", err: &pq.Error{Code: "23505"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetriableError(tt.err))
+		})
+	}
+}
@@ -2,12 +2,23 @@ package grpcserver
 
 import (
 	"context"
+	"errors"
 
 	"github.com/NikolosHGW/metric/internal/models"
 	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/server/services"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// MethodRoles минимальная роль клиента для каждого RPC
+var MethodRoles = map[string]string{
+	proto.MetricService_GetMetric_FullMethodName:     identity.RoleReader,
+	proto.MetricService_UpsertMetrics_FullMethodName: identity.RoleWriter,
+}
+
 type metricService interface {
 	GetMetricByName(context.Context, string) (models.Metrics, error)
 	UpsertMetrics(context.Context, models.MetricCollection) (models.MetricCollection, error)
@@ -32,6 +43,9 @@ func NewMetricServiceServer(ms metricService, logger customLogger) *MetricServic
 
 func (s *MetricServiceServer) GetMetric(ctx context.Context, req *proto.MetricRequest) (*proto.MetricResponse, error) {
 	metric, err := s.metricService.GetMetricByName(ctx, req.Id)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
 	if err != nil {
 		s.logger.Info("metric not found", zap.Error(err))
 		return nil, err
@@ -40,8 +54,8 @@ func (s *MetricServiceServer) GetMetric(ctx context.Context, req *proto.MetricRe
 	return &proto.MetricResponse{
 		Id:    metric.ID,
 		Type:  metric.MType,
-		Value: *metric.Value,
-		Delta: *metric.Delta,
+		Value: valueOrZero(metric.Value),
+		Delta: valueOrZero(metric.Delta),
 	}, nil
 }
 
@@ -58,6 +72,12 @@ func (s *MetricServiceServer) UpsertMetrics(ctx context.Context, req *proto.Upse
 	}
 
 	metrics, err := s.metricService.UpsertMetrics(ctx, metricCollection)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, services.ErrBatchTooLarge) {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
 	if err != nil {
 		s.logger.Info("cannot upsert metrics", zap.Error(err))
 		return nil, err
@@ -68,8 +88,8 @@ func (s *MetricServiceServer) UpsertMetrics(ctx context.Context, req *proto.Upse
 		responseMetrics = append(responseMetrics, &proto.Metric{
 			Id:    m.ID,
 			Type:  m.MType,
-			Value: *m.Value,
-			Delta: *m.Delta,
+			Value: valueOrZero(m.Value),
+			Delta: valueOrZero(m.Delta),
 		})
 	}
 
@@ -77,3 +97,12 @@ func (s *MetricServiceServer) UpsertMetrics(ctx context.Context, req *proto.Upse
 		Metrics: responseMetrics,
 	}, nil
 }
+
+// valueOrZero разыменовывает значение метрики: у gauge нет delta, у counter нет value
+func valueOrZero[T int64 | float64](v *T) T {
+	if v == nil {
+		return 0
+	}
+
+	return *v
+}
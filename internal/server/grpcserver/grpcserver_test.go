@@ -0,0 +1,76 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/server/services"
+	"github.com/NikolosHGW/metric/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(string, ...zap.Field) {}
+
+func TestMetricServiceServer_GetMetric(t *testing.T) {
+	strg := storage.NewMemStorage()
+	ctx := context.Background()
+	require.NoError(t, strg.SetGaugeMetric(ctx, "Alloc", 1.5))
+	require.NoError(t, strg.SetCounterMetric(ctx, "PollCount", 3))
+	server := NewMetricServiceServer(services.NewMetricService(strg), testLogger{})
+
+	tests := []struct {
+		name string
+		id   string
+		want *proto.MetricResponse
+	}{
+		{
+			name: "gauge без delta",
+			id:   "Alloc",
+			want: &proto.MetricResponse{Id: "Alloc", Type: models.GaugeType, Value: 1.5},
+		},
+		{
+			name: "counter без value",
+			id:   "PollCount",
+			want: &proto.MetricResponse{Id: "PollCount", Type: models.CounterType, Delta: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *proto.MetricResponse
+			var err error
+			require.NotPanics(t, func() {
+				resp, err = server.GetMetric(ctx, &proto.MetricRequest{Id: tt.id})
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.Id, resp.Id)
+			assert.Equal(t, tt.want.Type, resp.Type)
+			assert.Equal(t, tt.want.Value, resp.Value)
+			assert.Equal(t, tt.want.Delta, resp.Delta)
+		})
+	}
+}
+
+func TestMetricServiceServer_UpsertMetrics(t *testing.T) {
+	server := NewMetricServiceServer(services.NewMetricService(storage.NewMemStorage()), testLogger{})
+
+	var resp *proto.UpsertMetricResponse
+	var err error
+	require.NotPanics(t, func() {
+		resp, err = server.UpsertMetrics(context.Background(), &proto.UpsertMetricRequest{Metrics: []*proto.Metric{
+			{Id: "Alloc", Type: models.GaugeType, Value: 1.5},
+			{Id: "PollCount", Type: models.CounterType, Delta: 3},
+		}})
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.Metrics, 2)
+	assert.Equal(t, 1.5, resp.Metrics[0].Value)
+	assert.Equal(t, int64(0), resp.Metrics[0].Delta, "у gauge в ответе нулевой delta")
+	assert.Equal(t, int64(3), resp.Metrics[1].Delta)
+	assert.Equal(t, 0.0, resp.Metrics[1].Value, "у counter в ответе нулевой value")
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/NikolosHGW/metric/internal/server/db"
+)
+
+type dbHealth interface {
+	Stats() db.HealthStats
+}
+
+type writeBuffer interface {
+	Pending() int
+}
+
+type dbStatsResponse struct {
+	db.HealthStats
+	Buffered int `json:"buffered"`
+}
+
+type DBHandler struct {
+	health dbHealth
+	buffer writeBuffer
+	logger customLogger
+}
+
+// NewDBHandler конструктор административного хендлера состояния базы,
+// без базы health и buffer равны nil
+func NewDBHandler(health dbHealth, buffer writeBuffer, l customLogger) *DBHandler {
+	return &DBHandler{
+		health: health,
+		buffer: buffer,
+		logger: l,
+	}
+}
+
+// Stats хендлер, отдаёт доступность базы, статистику пула соединений
+// и число записей, ждущих в буфере восстановления базы
+func (h DBHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	if h.health == nil {
+		http.Error(w, "база данных не используется", http.StatusNotFound)
+		return
+	}
+
+	resp := dbStatsResponse{HealthStats: h.health.Stats()}
+	if h.buffer != nil {
+		resp.Buffered = h.buffer.Pending()
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, resp)
+}
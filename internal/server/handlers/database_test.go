@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type healthMock struct{}
+
+func (healthMock) Stats() db.HealthStats {
+	return db.HealthStats{Healthy: false, LastError: "connection refused", OpenConnections: 2}
+}
+
+type bufferMock struct{}
+
+func (bufferMock) Pending() int {
+	return 3
+}
+
+func TestDBHandler_Stats(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  *DBHandler
+		wantCode int
+		want     map[string]any
+	}{
+		{
+			name:     "база используется",
+			handler:  NewDBHandler(healthMock{}, bufferMock{}, &mockLogger{}),
+			wantCode: http.StatusOK,
+			want: map[string]any{
+				"healthy":          false,
+				"last_error":       "connection refused",
+				"open_connections": float64(2),
+				"buffered":         float64(3),
+			},
+		},
+		{
+			name:     "база не используется",
+			handler:  NewDBHandler(nil, nil, &mockLogger{}),
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler.Stats(rr, httptest.NewRequest(http.MethodGet, "/admin/db", nil))
+			require.Equal(t, tt.wantCode, rr.Code)
+			if tt.want == nil {
+				return
+			}
+
+			var got map[string]any
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+			for key, value := range tt.want {
+				assert.Equal(t, value, got[key], key)
+			}
+		})
+	}
+}
@@ -4,12 +4,14 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
 	"path/filepath"
 	"runtime"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/services"
 	"github.com/go-chi/chi"
 
 	"go.uber.org/zap"
@@ -48,6 +50,10 @@ func (h Handler) SetMetric(w http.ResponseWriter, r *http.Request) {
 	metricName := chi.URLParam(r, "metricName")
 	metricValue := chi.URLParam(r, "metricValue")
 	err := h.metricService.SetMetric(r.Context(), metricType, metricName, metricValue)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		h.logger.Info("cannot upsert metric", zap.Error(err))
 		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
@@ -64,6 +70,10 @@ func (h Handler) GetValueMetric(w http.ResponseWriter, r *http.Request) {
 	metricType := chi.URLParam(r, "metricType")
 	metricName := chi.URLParam(r, "metricName")
 	metricValue, err := h.metricService.GetMetricValue(r.Context(), metricType, metricName)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 
@@ -85,7 +95,7 @@ func (h Handler) SetJSONMetric(w http.ResponseWriter, r *http.Request) {
 	err := metricModel.DecodeMetricRequest(r.Body)
 	if err != nil {
 		h.logger.Info("cannot decode request JSON body", zap.Error(err))
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		http.Error(w, "неверный формат запроса", decodeErrorStatus(err))
 		return
 	}
 	defer func() {
@@ -96,6 +106,10 @@ func (h Handler) SetJSONMetric(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	err = h.metricService.SetJSONMetric(r.Context(), *metricModel)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		h.logger.Info("cannot upsert metric", zap.Error(err))
 		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
@@ -130,7 +144,7 @@ func (h Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	err := metricModel.DecodeMetricRequest(r.Body)
 	if err != nil {
 		h.logger.Info("cannot decode request JSON body", zap.Error(err))
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		http.Error(w, "неверный формат запроса", decodeErrorStatus(err))
 
 		return
 	}
@@ -142,6 +156,10 @@ func (h Handler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	metric, err := h.metricService.GetMetricByName(r.Context(), metricModel.ID)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		h.logger.Info("metric not found", zap.Error(err))
 		http.Error(w, "метрика не найдена", http.StatusNotFound)
@@ -183,6 +201,16 @@ func (h Handler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// decodeErrorStatus 413 если тело обрезано ограничением размера, иначе 400
+func decodeErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
 func BasePath() string {
 	_, b, _, _ := runtime.Caller(0)
 
@@ -203,7 +231,7 @@ func (h Handler) UpsertMetrics(w http.ResponseWriter, r *http.Request) {
 	err := metricCollection.DecodeMetricsRequest(r.Body)
 	if err != nil {
 		h.logger.Info("cannot decode request JSON body", zap.Error(err))
-		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		http.Error(w, "неверный формат запроса", decodeErrorStatus(err))
 
 		return
 	}
@@ -215,6 +243,14 @@ func (h Handler) UpsertMetrics(w http.ResponseWriter, r *http.Request) {
 	}()
 
 	metrics, err := h.metricService.UpsertMetrics(r.Context(), *metricCollection)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, services.ErrBatchTooLarge) {
+		http.Error(w, "слишком много метрик в запросе", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		h.logger.Info("cannot upsert metrics", zap.Error(err))
 		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
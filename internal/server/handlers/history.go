@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/services"
+)
+
+// DefaultHistoryRange период запроса истории, если from не задан
+const DefaultHistoryRange = time.Hour
+
+type historyQuerier interface {
+	Query(ctx context.Context, name string, from, to time.Time, step time.Duration) ([]models.Rollup, error)
+}
+
+// historyResponse значения метрики и шаг выбранного уровня сводок, 0s у сырых значений
+type historyResponse struct {
+	Step   string          `json:"step"`
+	Points []models.Rollup `json:"points"`
+}
+
+type HistoryHandler struct {
+	history historyQuerier
+	logger  customLogger
+}
+
+// NewHistoryHandler конструктор хендлера истории, без хранилища истории history равен nil
+func NewHistoryHandler(history historyQuerier, l customLogger) *HistoryHandler {
+	return &HistoryHandler{
+		history: history,
+		logger:  l,
+	}
+}
+
+// Query хендлер, отдаёт значения метрики за период from..to (RFC 3339, по умолчанию
+// последний час) с шагом не мельче step (например 5m, по умолчанию сырые значения)
+func (h HistoryHandler) Query(w http.ResponseWriter, r *http.Request) {
+	if h.history == nil {
+		http.Error(w, "история метрик не ведётся", http.StatusNotFound)
+		return
+	}
+
+	from, to, step, err := parseHistoryRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rollups, err := h.history.Query(r.Context(), chi.URLParam(r, "metricName"), from, to, step)
+	if errors.Is(err, services.ErrMetricForbidden) {
+		http.Error(w, "нет доступа к метрике", http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.logger.Info("cannot query history", zap.Error(err))
+		http.Error(w, "не удалось получить историю", http.StatusInternalServerError)
+		return
+	}
+	resp := historyResponse{Step: time.Duration(0).String(), Points: rollups}
+	if len(rollups) > 0 {
+		resp.Step = rollups[0].Step.String()
+	}
+	if resp.Points == nil {
+		resp.Points = []models.Rollup{}
+	}
+
+	writeJSON(w, h.logger, http.StatusOK, resp)
+}
+
+func parseHistoryRange(r *http.Request) (time.Time, time.Time, time.Duration, error) {
+	query := r.URL.Query()
+
+	to := time.Now()
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, errors.New("неверный формат to, ожидается RFC 3339")
+		}
+		to = t
+	}
+
+	from := to.Add(-DefaultHistoryRange)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, 0, errors.New("неверный формат from, ожидается RFC 3339")
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, 0, errors.New("from должен быть раньше to")
+	}
+
+	var step time.Duration
+	if v := query.Get("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return time.Time{}, time.Time{}, 0, errors.New("неверный шаг step")
+		}
+		step = d
+	}
+
+	return from, to, step, nil
+}
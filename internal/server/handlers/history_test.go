@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/services"
+)
+
+type historyMock struct {
+	step time.Duration
+}
+
+func (hm *historyMock) Query(_ context.Context, name string, from, _ time.Time, step time.Duration) ([]models.Rollup, error) {
+	if name == "secret" {
+		return nil, services.ErrMetricForbidden
+	}
+	hm.step = step
+
+	return []models.Rollup{{Start: from, Step: step, ID: name, MType: models.GaugeType, Count: 2, Min: 1, Max: 3, Avg: 2}}, nil
+}
+
+func TestHistoryHandler_Query(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  historyQuerier
+		url      string
+		wantCode int
+		wantStep time.Duration
+		wantBody string
+	}{
+		{
+			name:     "сводки с шагом",
+			history:  &historyMock{},
+			url:      "/history/Alloc?from=2024-01-01T00:00:00Z&to=2024-01-02T00:00:00Z&step=1h",
+			wantCode: http.StatusOK,
+			wantStep: time.Hour,
+			wantBody: `"step":"1h0m0s"`,
+		},
+		{
+			name:     "период по умолчанию",
+			history:  &historyMock{},
+			url:      "/history/Alloc",
+			wantCode: http.StatusOK,
+			wantBody: `"step":"0s"`,
+		},
+		{
+			name:     "неверный from",
+			history:  &historyMock{},
+			url:      "/history/Alloc?from=yesterday",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "from позже to",
+			history:  &historyMock{},
+			url:      "/history/Alloc?from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z",
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "нет доступа",
+			history:  &historyMock{},
+			url:      "/history/secret",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "история не ведётся",
+			url:      "/history/Alloc",
+			wantCode: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := chi.NewRouter()
+			r.Get("/history/{metricName}", NewHistoryHandler(tt.history, &mockLogger{}).Query)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if mock, ok := tt.history.(*historyMock); ok && tt.wantCode == http.StatusOK {
+				assert.Equal(t, tt.wantStep, mock.step)
+				assert.Contains(t, rr.Body.String(), `"avg":2`)
+				assert.Contains(t, rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
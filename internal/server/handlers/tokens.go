@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/NikolosHGW/metric/internal/server/auth"
+	"github.com/go-chi/chi"
+	"go.uber.org/zap"
+)
+
+type tokenStore interface {
+	Create(string, string, []string) (auth.Token, string, error)
+	Revoke(string) error
+	List() []auth.Token
+}
+
+type TokenHandler struct {
+	tokens tokenStore
+	logger customLogger
+}
+
+type createTokenRequest struct {
+	Agent  string   `json:"agent"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+}
+
+type createTokenResponse struct {
+	auth.Token
+	Secret string `json:"token"`
+}
+
+// NewTokenHandler конструктор административных хендлеров для токенов агентов
+func NewTokenHandler(tokens tokenStore, l customLogger) *TokenHandler {
+	return &TokenHandler{
+		tokens: tokens,
+		logger: l,
+	}
+}
+
+// CreateToken хендлер, выпускает токен для агента с ролью (по умолчанию writer) и
+// необязательными префиксами метрик. Токен возвращается только в этом ответе
+func (h TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Info("cannot decode request JSON body", zap.Error(err))
+		http.Error(w, "неверный формат запроса", http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.tokens.Create(req.Agent, req.Role, req.Scopes)
+	if errors.Is(err, auth.ErrEmptyAgent) {
+		http.Error(w, "не указан агент", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidRole) {
+		http.Error(w, "неизвестная роль", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Info("cannot create token", zap.Error(err))
+		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+	token.Hash = ""
+
+	h.writeJSON(w, http.StatusCreated, createTokenResponse{Token: token, Secret: secret})
+}
+
+// ListTokens хендлер, отдаёт список выпущенных токенов без секретов
+func (h TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, h.tokens.List())
+}
+
+// RevokeToken хендлер, отзывает токен по идентификатору
+func (h TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	err := h.tokens.Revoke(chi.URLParam(r, "id"))
+	if errors.Is(err, auth.ErrTokenNotFound) {
+		http.Error(w, "токен не найден", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Info("cannot revoke token", zap.Error(err))
+		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h TokenHandler) writeJSON(w http.ResponseWriter, status int, v any) {
+	writeJSON(w, h.logger, status, v)
+}
+
+func writeJSON(w http.ResponseWriter, logger customLogger, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		logger.Info("cannot encode to JSON", zap.Error(err))
+		http.Error(w, "ошибка сервера", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(resp)
+	if err != nil {
+		logger.Info("cannot write response", zap.Error(err))
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/server/auth"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenHandler(t *testing.T) {
+	store, err := auth.NewTokenStore("")
+	require.NoError(t, err)
+	handler := NewTokenHandler(store, &mockLogger{})
+
+	r := chi.NewRouter()
+	r.Post("/admin/tokens", handler.CreateToken)
+	r.Get("/admin/tokens", handler.ListTokens)
+	r.Delete("/admin/tokens/{id}", handler.RevokeToken)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/tokens", strings.NewReader(`{"agent":"agent-1"}`)))
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	var created createTokenResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, "agent-1", created.Agent)
+	assert.Empty(t, created.Hash)
+	assert.True(t, strings.HasPrefix(created.Secret, created.ID+"."))
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/admin/tokens", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/admin/tokens/"+created.ID, nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/admin/tokens/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/tokens", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var tokens []auth.Token
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+	require.Len(t, tokens, 1)
+	assert.True(t, tokens[0].Revoked())
+}
@@ -0,0 +1,92 @@
+// Пакет identity описывает вызывающую сторону запроса и хранит её в контексте
+package identity
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	SourceMTLS  = "mtls"
+	SourceToken = "token"
+	SourceAdmin = "admin"
+)
+
+// Роли упорядочены по возрастанию прав: writer может читать, admin может всё
+const (
+	RoleReader = "reader"
+	RoleWriter = "writer"
+	RoleAdmin  = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleReader: 1,
+	RoleWriter: 2,
+	RoleAdmin:  3,
+}
+
+// Identity идентификатор клиента, прошедшего аутентификацию.
+// Scopes ограничивают доступ метриками с указанными префиксами имени, пустой список снимает ограничение
+type Identity struct {
+	Name   string
+	Source string
+	Role   string
+	Scopes []string
+}
+
+// ValidRole возвращает true для известной роли
+func ValidRole(role string) bool {
+	_, ok := roleLevels[role]
+
+	return ok
+}
+
+// HasRole возвращает true, если роль клиента не ниже role
+func (id Identity) HasRole(role string) bool {
+	required, ok := roleLevels[role]
+
+	return ok && roleLevels[id.Role] >= required
+}
+
+// CanAccess возвращает true, если метрика name попадает в области доступа клиента
+func (id Identity) CanAccess(name string) bool {
+	if len(id.Scopes) == 0 || id.Role == RoleAdmin {
+		return true
+	}
+	for _, prefix := range id.Scopes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ctxKey struct{}
+
+// WithIdentity возвращает контекст с сохранённым идентификатором клиента
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// NameFromContext возвращает имя клиента из контекста или пустую строку
+func NameFromContext(ctx context.Context) string {
+	id, _ := FromContext(ctx)
+
+	return id.Name
+}
+
+// FromContext достаёт идентификатор клиента из контекста
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxKey{}).(Identity)
+
+	return id, ok
+}
+
+// CanAccessFromContext проверяет доступ к метрике для клиента из контекста.
+// Анонимный запрос ограничений по метрикам не имеет
+func CanAccessFromContext(ctx context.Context, name string) bool {
+	id, ok := FromContext(ctx)
+
+	return !ok || id.CanAccess(name)
+}
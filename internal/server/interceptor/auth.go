@@ -0,0 +1,94 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	"github.com/NikolosHGW/metric/internal/server/auth"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type authenticator interface {
+	Authenticate(string) (identity.Identity, error)
+	Required() bool
+	Authorize(context.Context, string) error
+}
+
+// Auth аутентифицирует вызов по токену из метаданных authorization и кладёт
+// идентификатор агента в контекст
+type Auth struct {
+	auth   authenticator
+	logger customLogger
+}
+
+func NewAuth(a authenticator, logger customLogger) *Auth {
+	return &Auth{
+		auth:   a,
+		logger: logger,
+	}
+}
+
+func (a *Auth) UnaryAuthInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	var token string
+	var ok bool
+	if md, hasMD := metadata.FromIncomingContext(ctx); hasMD {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token, ok = auth.ParseBearer(values[0])
+		}
+	}
+
+	if !ok {
+		if _, authenticated := identity.FromContext(ctx); authenticated || !a.auth.Required() {
+			return handler(ctx, req)
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
+
+	id, err := a.auth.Authenticate(token)
+	if err != nil {
+		a.logger.Info("authentication failed", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return handler(identity.WithIdentity(ctx, id), req)
+}
+
+// RoleInterceptor возвращает интерсептор, проверяющий роль клиента по таблице метод -> роль.
+// Методы, которых нет в таблице, доступны только администратору
+func (a *Auth) RoleInterceptor(roles map[string]string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		role, ok := roles[info.FullMethod]
+		if !ok {
+			role = identity.RoleAdmin
+		}
+
+		err := a.auth.Authorize(ctx, role)
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			return nil, status.Error(codes.Unauthenticated, "authentication required")
+		}
+		if err != nil {
+			a.logger.Info("access denied",
+				zap.String("client", identity.NameFromContext(ctx)),
+				zap.String("method", info.FullMethod),
+			)
+			return nil, status.Error(codes.PermissionDenied, "insufficient role")
+		}
+
+		return handler(ctx, req)
+	}
+}
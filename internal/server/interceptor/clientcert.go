@@ -0,0 +1,73 @@
+package interceptor
+
+import (
+	"context"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ClientCert достаёт имя клиента из проверенного при mTLS сертификата и кладёт его в контекст.
+// Если задан список allowed, клиенты с другими именами получают PermissionDenied.
+type ClientCert struct {
+	logger  customLogger
+	allowed map[string]struct{}
+}
+
+func NewClientCert(allowed []string, logger customLogger) *ClientCert {
+	m := &ClientCert{
+		logger:  logger,
+		allowed: make(map[string]struct{}, len(allowed)),
+	}
+	for _, name := range allowed {
+		m.allowed[name] = struct{}{}
+	}
+
+	return m
+}
+
+func (m *ClientCert) UnaryClientCertInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	name, ok := peerCertName(ctx)
+
+	if len(m.allowed) > 0 {
+		if _, allowed := m.allowed[name]; !ok || !allowed {
+			m.logger.Info("client certificate not allowed", zap.String("client", name))
+			return nil, status.Error(codes.PermissionDenied, "client certificate not allowed")
+		}
+	}
+
+	if ok {
+		ctx = identity.WithIdentity(ctx, identity.Identity{
+			Name:   name,
+			Source: identity.SourceMTLS,
+			Role:   identity.RoleWriter,
+		})
+	}
+
+	return handler(ctx, req)
+}
+
+func peerCertName(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return "", false
+	}
+
+	return tlsconfig.PeerName(tlsInfo.State)
+}
@@ -0,0 +1,102 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
+	"github.com/NikolosHGW/metric/internal/tlsconfig/tlstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(string, ...zap.Field) {}
+
+type identityServer struct {
+	proto.UnimplementedMetricServiceServer
+}
+
+// UpsertMetrics возвращает имя клиента из контекста в id первой метрики
+func (identityServer) UpsertMetrics(ctx context.Context, _ *proto.UpsertMetricRequest) (*proto.UpsertMetricResponse, error) {
+	id, _ := identity.FromContext(ctx)
+
+	return &proto.UpsertMetricResponse{Metrics: []*proto.Metric{{Id: id.Name}}}, nil
+}
+
+func startTLSServer(t *testing.T, files tlstest.Files, allowed []string) string {
+	t.Helper()
+
+	serverConfig, err := tlsconfig.NewServerConfig(tlsconfig.Options{
+		CertFile: files.ServerCert,
+		KeyFile:  files.ServerKey,
+		CAFile:   files.CA,
+	})
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(serverConfig)),
+		grpc.ChainUnaryInterceptor(NewClientCert(allowed, testLogger{}).UnaryClientCertInterceptor),
+	)
+	proto.RegisterMetricServiceServer(server, identityServer{})
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String()
+}
+
+func dialTLS(t *testing.T, addr string, opts tlsconfig.Options) proto.MetricServiceClient {
+	t.Helper()
+
+	clientConfig, err := tlsconfig.NewClientConfig(opts)
+	require.NoError(t, err)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(credentials.NewTLS(clientConfig)))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, conn.Close())
+	})
+
+	return proto.NewMetricServiceClient(conn)
+}
+
+func TestUnaryClientCertInterceptor_MutualTLS(t *testing.T) {
+	files := tlstest.Generate(t, t.TempDir(), "agent-1")
+	clientOpts := tlsconfig.Options{CertFile: files.ClientCert, KeyFile: files.ClientKey, CAFile: files.CA}
+
+	t.Run("Имя клиента из сертификата", func(t *testing.T) {
+		client := dialTLS(t, startTLSServer(t, files, nil), clientOpts)
+
+		resp, err := client.UpsertMetrics(context.Background(), &proto.UpsertMetricRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", resp.Metrics[0].Id)
+	})
+
+	t.Run("Клиент не в списке разрешённых", func(t *testing.T) {
+		client := dialTLS(t, startTLSServer(t, files, []string{"agent-2"}), clientOpts)
+
+		_, err := client.UpsertMetrics(context.Background(), &proto.UpsertMetricRequest{})
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("Клиент без сертификата", func(t *testing.T) {
+		client := dialTLS(t, startTLSServer(t, files, nil), tlsconfig.Options{CAFile: files.CA})
+
+		_, err := client.UpsertMetrics(context.Background(), &proto.UpsertMetricRequest{})
+		assert.Error(t, err)
+	})
+}
@@ -2,11 +2,6 @@ package interceptor
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"fmt"
 
 	"github.com/NikolosHGW/metric/internal/crypto"
@@ -19,75 +14,41 @@ type customLogger interface {
 	Info(string, ...zap.Field)
 }
 
+type keyRingProvider interface {
+	KeyRing() *crypto.KeyRing
+}
+
 type DecryptMiddleware struct {
-	logger         customLogger
-	privateKeyPath string
+	logger customLogger
+	keys   keyRingProvider
 }
 
-func NewDecryptMiddleware(privateKeyPath string, logger customLogger) *DecryptMiddleware {
+func NewDecryptMiddleware(keys keyRingProvider, logger customLogger) *DecryptMiddleware {
 	return &DecryptMiddleware{
-		privateKeyPath: privateKeyPath,
-		logger:         logger,
+		keys:   keys,
+		logger: logger,
 	}
 }
 
 func (dm *DecryptMiddleware) UnaryDecryptInterceptor(
 	ctx context.Context,
 	req interface{},
-	_ *grpc.UnaryServerInfo,
+	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	if dm.privateKeyPath == "" {
+	keyRing := dm.keys.KeyRing()
+	// набор пуст, только если пути к ключам не заданы: иначе KeyCache не стартует
+	if keyRing.Len() == 0 {
 		return handler(ctx, req)
 	}
 
-	privateKey, err := crypto.LoadPrivateKey(dm.privateKeyPath)
-	if err != nil {
-		dm.logger.Info("failed to load private key", zap.Error(err))
-		return nil, fmt.Errorf("failed to load private key: %w", err)
-	}
-
 	reqBytes, err := proto.Marshal(req.(proto.Message))
 	if err != nil {
 		dm.logger.Info("failed to marshal request", zap.Error(err))
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	encryptedKeySize := privateKey.Size()
-	if len(reqBytes) < encryptedKeySize {
-		dm.logger.Info("encrypted data is too short")
-		return nil, fmt.Errorf("encrypted data is too short")
-	}
-
-	encryptedKey := reqBytes[:encryptedKeySize]
-	ciphertext := reqBytes[encryptedKeySize:]
-
-	aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
-	if err != nil {
-		dm.logger.Info("failed to decrypt AES key", zap.Error(err))
-		return nil, fmt.Errorf("failed to decrypt AES key: %w", err)
-	}
-
-	block, err := aes.NewCipher(aesKey)
-	if err != nil {
-		dm.logger.Info("failed to create AES cipher", zap.Error(err))
-		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		dm.logger.Info("failed to create GCM", zap.Error(err))
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		dm.logger.Info("ciphertext too short")
-		return nil, fmt.Errorf("ciphertext too short")
-	}
-
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := crypto.DecryptData(keyRing, reqBytes, info.FullMethod)
 	if err != nil {
 		dm.logger.Info("failed to decrypt data", zap.Error(err))
 		return nil, fmt.Errorf("failed to decrypt data: %w", err)
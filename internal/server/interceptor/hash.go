@@ -6,20 +6,36 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
 
+	"github.com/NikolosHGW/metric/internal/signature"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 )
 
+var (
+	hashKey      = strings.ToLower(signature.HashHeader)
+	timestampKey = strings.ToLower(signature.TimestampHeader)
+	nonceKey     = strings.ToLower(signature.NonceHeader)
+)
+
+type signatureVerifier interface {
+	Verify([]byte, signature.Params) error
+}
+
 type HashMiddleware struct {
-	key string
+	verifier signatureVerifier
+	key      string
 }
 
-func NewHashMiddleware(key string) *HashMiddleware {
+// NewHashMiddleware конструктор, verifier проверяет подпись вместе с меткой времени и nonce
+func NewHashMiddleware(key string, verifier signatureVerifier) *HashMiddleware {
 	return &HashMiddleware{
-		key: key,
+		key:      key,
+		verifier: verifier,
 	}
 }
 
@@ -29,20 +45,26 @@ func (hm *HashMiddleware) UnaryHashInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return handler(ctx, req)
-	}
+	if hm.key != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		params := signature.Params{
+			Hash:      firstValue(md, hashKey),
+			Timestamp: firstValue(md, timestampKey),
+			Nonce:     firstValue(md, nonceKey),
+		}
+		// без подписи запрос не проверить на повтор, поэтому при заданном ключе он отклоняется
+		if params.Hash == "" || params.Timestamp == "" || params.Nonce == "" {
+			return nil, status.Error(codes.Unauthenticated, "request signature is required")
+		}
 
-	if hashValues := md.Get("hashsha256"); len(hashValues) > 0 && hm.key != "" {
 		reqBytes, err := serializeRequest(req)
 		if err != nil {
 			return nil, status.Errorf(status.Code(err), "failed to serialize request: %v", err)
 		}
 
-		requestHash := hashValues[0]
-		if !checkHash(reqBytes, hm.key, requestHash) {
-			return nil, status.Errorf(status.Code(nil), "hash mismatch")
+		err = hm.verifier.Verify(reqBytes, params)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
 	}
 
@@ -57,7 +79,7 @@ func (hm *HashMiddleware) UnaryHashInterceptor(
 			return nil, status.Errorf(status.Code(err), "failed to serialize response: %v", err)
 		}
 		respHash := getHash(respBytes, hm.key)
-		newMD := metadata.Pairs("hashsha256", respHash)
+		newMD := metadata.Pairs(hashKey, respHash)
 		err = grpc.SetTrailer(ctx, newMD)
 		if err != nil {
 			return nil, status.Errorf(status.Code(err), "failed to SetTrailer: %v", err)
@@ -67,8 +89,12 @@ func (hm *HashMiddleware) UnaryHashInterceptor(
 	return resp, nil
 }
 
-func checkHash(data []byte, key string, requestHash string) bool {
-	return hmac.Equal([]byte(getHash(data, key)), []byte(requestHash))
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
 }
 
 func getHash(data []byte, key string) string {
@@ -0,0 +1,61 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/proto"
+	"github.com/NikolosHGW/metric/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryHashInterceptor_Unsigned(t *testing.T) {
+	req := &proto.UpsertMetricRequest{Metrics: []*proto.Metric{{Id: "PollCount", Type: "counter", Delta: 1}}}
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricService_UpsertMetrics_FullMethodName}
+
+	tests := []struct {
+		name         string
+		key          string
+		md           metadata.MD
+		expectedCode codes.Code
+	}{
+		{
+			name:         "ключ задан, метаданных нет",
+			key:          "secret",
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "ключ задан, только хеш без метки времени и nonce",
+			key:          "secret",
+			md:           metadata.Pairs(hashKey, getHash([]byte("body"), "secret")),
+			expectedCode: codes.Unauthenticated,
+		},
+		{
+			name:         "ключ не задан, подпись не нужна",
+			expectedCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			handled := false
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				handled = true
+				return &proto.UpsertMetricResponse{}, nil
+			}
+			hm := NewHashMiddleware(tt.key, signature.NewVerifier(tt.key, signature.DefaultWindow))
+
+			_, err := hm.UnaryHashInterceptor(ctx, req, info, handler)
+
+			assert.Equal(t, tt.expectedCode, status.Code(err))
+			assert.Equal(t, tt.expectedCode == codes.OK, handled)
+		})
+	}
+}
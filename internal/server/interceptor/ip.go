@@ -2,23 +2,34 @@ package interceptor
 
 import (
 	"context"
-	"net"
+	"net/netip"
 
+	"github.com/NikolosHGW/metric/internal/netfilter"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
 
+type ipFilter interface {
+	Enabled() bool
+	Allowed(netip.Addr) bool
+	ClientIP(netip.Addr, func(string) string) netip.Addr
+}
+
+// CheckIP пропускает только клиентов из разрешённых подсетей. Адрес берётся из peer,
+// метаданным x-real-ip и x-forwarded-for верим только от доверенных прокси
 type CheckIP struct {
-	logger        customLogger
-	trustedSubnet string
+	logger customLogger
+	filter ipFilter
 }
 
-func NewCheckIP(trustedSubnet string, logger customLogger) *CheckIP {
+func NewCheckIP(filter ipFilter, logger customLogger) *CheckIP {
 	return &CheckIP{
-		trustedSubnet: trustedSubnet,
-		logger:        logger,
+		filter: filter,
+		logger: logger,
 	}
 }
 
@@ -28,42 +39,32 @@ func (m *CheckIP) UnaryCheckIPInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (interface{}, error) {
-	if m.trustedSubnet == "" {
+	if !m.filter.Enabled() {
 		return handler(ctx, req)
 	}
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		m.logger.Info("No metadata found in context")
-		return nil, status.Errorf(status.Code(nil), "No metadata found in context")
+	ip := resolveClientIP(ctx, m.filter)
+	if !m.filter.Allowed(ip) {
+		m.logger.Info("IP address not trusted", zap.String("clientIP", ip.String()))
+		return nil, status.Error(codes.PermissionDenied, "IP address not trusted")
 	}
 
-	var clientIP string
-	if xRealIP := md.Get("x-real-ip"); len(xRealIP) > 0 {
-		clientIP = xRealIP[0]
-	} else if xForwardedFor := md.Get("x-forwarded-for"); len(xForwardedFor) > 0 {
-		clientIP = xForwardedFor[0]
-	} else {
-		m.logger.Info("No client IP found in metadata")
-		return nil, status.Errorf(status.Code(nil), "No client IP found in metadata")
-	}
-
-	ip := net.ParseIP(clientIP)
-	if ip == nil {
-		m.logger.Info("Invalid IP address", zap.String("clientIP", clientIP))
-		return nil, status.Errorf(status.Code(nil), "Invalid IP address")
-	}
+	return handler(ctx, req)
+}
 
-	_, cidr, err := net.ParseCIDR(m.trustedSubnet)
-	if err != nil {
-		m.logger.Info("Invalid CIDR", zap.Error(err))
-		return nil, status.Errorf(status.Code(err), "Invalid CIDR: %v", err)
+// resolveClientIP адрес клиента из peer с учётом метаданных от доверенных прокси
+func resolveClientIP(ctx context.Context, resolver clientIPResolver) netip.Addr {
+	var peerIP netip.Addr
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerIP = netfilter.ParseAddr(p.Addr.String())
 	}
 
-	if !cidr.Contains(ip) {
-		m.logger.Info("IP address not trusted", zap.String("clientIP", clientIP))
-		return nil, status.Errorf(status.Code(nil), "IP address not trusted")
-	}
+	md, _ := metadata.FromIncomingContext(ctx)
 
-	return handler(ctx, req)
+	return resolver.ClientIP(peerIP, func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
 }
@@ -0,0 +1,61 @@
+package interceptor
+
+import (
+	"context"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/ratelimit"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type rateLimiter interface {
+	Allow(string) (bool, time.Duration)
+}
+
+type clientIPResolver interface {
+	ClientIP(netip.Addr, func(string) string) netip.Addr
+}
+
+// RateLimit ограничивает частоту вызовов каждого клиента
+type RateLimit struct {
+	limiter  rateLimiter
+	resolver clientIPResolver
+	logger   customLogger
+}
+
+func NewRateLimit(limiter rateLimiter, resolver clientIPResolver, logger customLogger) *RateLimit {
+	return &RateLimit{
+		limiter:  limiter,
+		resolver: resolver,
+		logger:   logger,
+	}
+}
+
+// UnaryRateLimitInterceptor отвечает ResourceExhausted с метаданными retry-after,
+// если клиент исчерпал лимит. Ставится после аутентификации
+func (rl *RateLimit) UnaryRateLimitInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	key := ratelimit.Key(identity.NameFromContext(ctx), resolveClientIP(ctx, rl.resolver))
+
+	if ok, wait := rl.limiter.Allow(key); !ok {
+		rl.logger.Info("rate limit exceeded", zap.String("client", key))
+		retryAfter := strconv.Itoa(ratelimit.RetryAfterSeconds(wait))
+		if err := grpc.SetHeader(ctx, metadata.Pairs("retry-after", retryAfter)); err != nil {
+			rl.logger.Info("cannot set retry-after header", zap.Error(err))
+		}
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s seconds", retryAfter)
+	}
+
+	return handler(ctx, req)
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/NikolosHGW/metric/internal/server/auth"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"go.uber.org/zap"
+)
+
+type authenticator interface {
+	Authenticate(string) (identity.Identity, error)
+	Required() bool
+	Authorize(context.Context, string) error
+}
+
+// Auth аутентифицирует запрос по токену из заголовка Authorization и кладёт
+// идентификатор агента в контекст
+type Auth struct {
+	auth   authenticator
+	logger customLogger
+}
+
+func NewAuth(a authenticator, logger customLogger) *Auth {
+	return &Auth{
+		auth:   a,
+		logger: logger,
+	}
+}
+
+func (a *Auth) WithAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := auth.ParseBearer(r.Header.Get("Authorization"))
+		if !ok {
+			if _, authenticated := identity.FromContext(r.Context()); authenticated || !a.auth.Required() {
+				next.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id, err := a.auth.Authenticate(token)
+		if err != nil {
+			a.logger.Info("authentication failed", zap.Error(err))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), id)))
+	})
+}
+
+// RequireRole пропускает только запросы клиентов с ролью не ниже role
+func (a *Auth) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := a.auth.Authorize(r.Context(), role)
+			if errors.Is(err, auth.ErrUnauthenticated) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				a.logger.Info("access denied",
+					zap.String("client", identity.NameFromContext(r.Context())),
+					zap.String("role", role),
+				)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/server/auth"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	store, err := auth.NewTokenStore("")
+	require.NoError(t, err)
+	_, raw, err := store.Create("agent-1", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		required       bool
+		header         string
+		preset         *identity.Identity
+		expectedStatus int
+		expectedName   string
+	}{
+		{
+			name:           "Без токена, аутентификация не обязательна",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Без токена, аутентификация обязательна",
+			required:       true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Без токена, но с клиентским сертификатом",
+			required:       true,
+			preset:         &identity.Identity{Name: "agent-cert", Source: identity.SourceMTLS},
+			expectedStatus: http.StatusOK,
+			expectedName:   "agent-cert",
+		},
+		{
+			name:           "Действующий токен",
+			required:       true,
+			header:         "Bearer " + raw,
+			expectedStatus: http.StatusOK,
+			expectedName:   "agent-1",
+		},
+		{
+			name:           "Неверный токен",
+			header:         "Bearer bad.token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotName string
+			handler := NewAuth(auth.NewAuthenticator(store, "", tt.required), &mockLogger{}).WithAuth(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotName = identity.NameFromContext(r.Context())
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.preset != nil {
+				req = req.WithContext(identity.WithIdentity(req.Context(), *tt.preset))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedName, gotName)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	reader := &identity.Identity{Name: "dashboard", Source: identity.SourceToken, Role: identity.RoleReader}
+	writer := &identity.Identity{Name: "agent-1", Source: identity.SourceToken, Role: identity.RoleWriter}
+	admin := &identity.Identity{Name: auth.AdminName, Source: identity.SourceAdmin, Role: identity.RoleAdmin}
+
+	tests := []struct {
+		name           string
+		role           string
+		required       bool
+		preset         *identity.Identity
+		expectedStatus int
+	}{
+		{name: "Анонимное чтение без обязательной аутентификации", role: identity.RoleReader, expectedStatus: http.StatusOK},
+		{name: "Анонимный запрос к админке", role: identity.RoleAdmin, expectedStatus: http.StatusUnauthorized},
+		{name: "Анонимная запись при обязательной аутентификации", role: identity.RoleWriter, required: true, expectedStatus: http.StatusUnauthorized},
+		{name: "Reader читает", role: identity.RoleReader, preset: reader, expectedStatus: http.StatusOK},
+		{name: "Reader не может писать", role: identity.RoleWriter, preset: reader, expectedStatus: http.StatusForbidden},
+		{name: "Writer читает", role: identity.RoleReader, preset: writer, expectedStatus: http.StatusOK},
+		{name: "Writer не администратор", role: identity.RoleAdmin, preset: writer, expectedStatus: http.StatusForbidden},
+		{name: "Admin пишет", role: identity.RoleWriter, preset: admin, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := auth.NewAuthenticator(nil, "", tt.required)
+			handler := NewAuth(a, &mockLogger{}).RequireRole(tt.role)(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.preset != nil {
+				req = req.WithContext(identity.WithIdentity(req.Context(), *tt.preset))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// ClientCert достаёт имя клиента из проверенного при mTLS сертификата и кладёт его в контекст.
+// Если задан список allowed, клиенты с другими именами получают 403.
+type ClientCert struct {
+	logger  customLogger
+	allowed map[string]struct{}
+}
+
+func NewClientCert(allowed []string, logger customLogger) *ClientCert {
+	m := &ClientCert{
+		logger:  logger,
+		allowed: make(map[string]struct{}, len(allowed)),
+	}
+	for _, name := range allowed {
+		m.allowed[name] = struct{}{}
+	}
+
+	return m
+}
+
+func (m *ClientCert) WithClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		var ok bool
+		if r.TLS != nil {
+			name, ok = tlsconfig.PeerName(*r.TLS)
+		}
+
+		if len(m.allowed) > 0 {
+			if _, allowed := m.allowed[name]; !ok || !allowed {
+				m.logger.Info("client certificate not allowed", zap.String("client", name))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		if ok {
+			r = r.WithContext(identity.WithIdentity(r.Context(), identity.Identity{
+				Name:   name,
+				Source: identity.SourceMTLS,
+				Role:   identity.RoleWriter,
+			}))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
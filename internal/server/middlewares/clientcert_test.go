@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/tlsconfig/tlstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientCertMiddleware(t *testing.T) {
+	cert := tlstest.Certificate(t, "agent-1")
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	tests := []struct {
+		name           string
+		allowed        []string
+		state          *tls.ConnectionState
+		expectedStatus int
+		expectedName   string
+	}{
+		{
+			name:           "Без TLS и без списка клиентов",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Имя из сертификата попадает в контекст",
+			state:          verified,
+			expectedStatus: http.StatusOK,
+			expectedName:   "agent-1",
+		},
+		{
+			name:           "Клиент в списке разрешённых",
+			allowed:        []string{"agent-1"},
+			state:          verified,
+			expectedStatus: http.StatusOK,
+			expectedName:   "agent-1",
+		},
+		{
+			name:           "Клиент не в списке разрешённых",
+			allowed:        []string{"agent-2"},
+			state:          verified,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Нет сертификата при заданном списке",
+			allowed:        []string{"agent-1"},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotName string
+			handler := NewClientCert(tt.allowed, &mockLogger{}).WithClientCert(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if id, ok := identity.FromContext(r.Context()); ok {
+						gotName = id.Name
+					}
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+			req.TLS = tt.state
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedName, gotName)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package middlewares
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/NikolosHGW/metric/internal/compress"
+	"go.uber.org/zap"
+)
+
+const applicationJSON = "application/json"
+
+// compressibleTypes типы ответов, которые имеет смысл сжимать
+var compressibleTypes = map[string]struct{}{
+	applicationJSON:          {},
+	"application/javascript": {},
+	"image/svg+xml":          {},
+	"text/css":               {},
+	"text/html":              {},
+	"text/plain":             {},
+}
+
+// Compression распаковывает тело запроса по Content-Encoding и сжимает ответ
+// кодировкой, выбранной по Accept-Encoding
+type Compression struct {
+	logger  customLogger
+	minSize int
+}
+
+// NewCompression конструктор, ответы короче minSize байт отдаются без сжатия
+func NewCompression(minSize int, logger customLogger) *Compression {
+	return &Compression{
+		logger:  logger,
+		minSize: minSize,
+	}
+}
+
+func (c *Compression) WithCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentEncoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if contentEncoding != "" && contentEncoding != compress.Identity {
+			zr, err := compress.NewReader(contentEncoding, r.Body)
+			if err != nil {
+				c.logger.Info("cannot decode request body", zap.String("encoding", contentEncoding), zap.Error(err))
+				http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+				return
+			}
+
+			r.Body = &compressReader{zr: zr, r: r.Body}
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+			defer func() {
+				if err := r.Body.Close(); err != nil {
+					c.logger.Info("err close compressReader", zap.Error(err))
+				}
+			}()
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := compress.Negotiate(strings.Join(r.Header.Values("Accept-Encoding"), ","), compress.HTTPEncodings)
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{
+			ResponseWriter: w,
+			encoding:       encoding,
+			minSize:        c.minSize,
+		}
+		defer func() {
+			if err := cw.Close(); err != nil {
+				c.logger.Info("err close compressWriter", zap.Error(err))
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter копит начало ответа, пока не станет ясно, стоит ли его сжимать:
+// решение зависит от статуса, Content-Type и размера тела
+type compressWriter struct {
+	http.ResponseWriter
+	zw       io.WriteCloser
+	encoding string
+	buf      []byte
+	status   int
+	minSize  int
+	decided  bool
+}
+
+func (c *compressWriter) WriteHeader(statusCode int) {
+	if c.status == 0 {
+		c.status = statusCode
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if c.decided {
+		if c.zw != nil {
+			return c.zw.Write(p)
+		}
+		return c.ResponseWriter.Write(p)
+	}
+
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= c.minSize {
+		if err := c.decide(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+func (c *compressWriter) Close() error {
+	if !c.decided && (c.status != 0 || len(c.buf) > 0) {
+		if err := c.decide(); err != nil {
+			return err
+		}
+	}
+	if c.zw != nil {
+		return c.zw.Close()
+	}
+
+	return nil
+}
+
+func (c *compressWriter) decide() error {
+	c.decided = true
+
+	if c.shouldCompress() {
+		zw, err := compress.NewWriter(c.encoding, c.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		c.zw = zw
+		c.Header().Set("Content-Encoding", c.encoding)
+		c.Header().Del("Content-Length")
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.zw != nil {
+		_, err := c.zw.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+
+	return err
+}
+
+func (c *compressWriter) shouldCompress() bool {
+	if len(c.buf) == 0 || len(c.buf) < c.minSize {
+		return false
+	}
+	if c.status == http.StatusNoContent || c.status == http.StatusNotModified || c.status < http.StatusOK {
+		return false
+	}
+	if c.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+
+	contentType := c.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(c.buf)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	_, ok := compressibleTypes[mediaType]
+
+	return ok
+}
+
+type compressReader struct {
+	zr io.ReadCloser
+	r  io.ReadCloser
+}
+
+func (c *compressReader) Read(p []byte) (int, error) {
+	return c.zr.Read(p)
+}
+
+func (c *compressReader) Close() error {
+	if err := c.zr.Close(); err != nil {
+		return err
+	}
+	return c.r.Close()
+}
@@ -0,0 +1,263 @@
+package middlewares
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/compress"
+	"github.com/NikolosHGW/metric/internal/server/handlers"
+	"github.com/NikolosHGW/metric/internal/server/services"
+	"github.com/NikolosHGW/metric/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type mockLogger struct{}
+
+func (m *mockLogger) Info(msg string, fields ...zap.Field) {}
+
+func TestWithCompression(t *testing.T) {
+	strg := storage.NewMemStorage()
+	metricService := services.NewMetricService(strg)
+	handler := handlers.NewHandler(metricService, &mockLogger{})
+
+	h := NewCompression(0, &mockLogger{}).WithCompression(http.HandlerFunc(handler.SetJSONMetric))
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	requestBody := `{"id":"foo","type":"gauge","value":42.1}`
+	successBody := requestBody
+
+	t.Run("положительный тест: application/json запрос без сжатия", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		buf.Write([]byte(requestBody))
+
+		r := httptest.NewRequest("POST", srv.URL, buf)
+		r.RequestURI = ""
+		r.Header.Set("Content-Type", applicationJSON)
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		defer func() {
+			err := resp.Body.Close()
+			if err != nil {
+				t.Errorf("failed body close: %v", err)
+			}
+		}()
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, successBody, string(b))
+	})
+
+	t.Run("положительный тест: application/json запрос, в котором сжатый JSON", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		zb := gzip.NewWriter(buf)
+		_, err := zb.Write([]byte(requestBody))
+		require.NoError(t, err)
+		err = zb.Close()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest("POST", srv.URL, buf)
+		r.RequestURI = ""
+		r.Header.Set("Content-Type", applicationJSON)
+		r.Header.Set("Content-Encoding", "gzip")
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		defer func() {
+			err := resp.Body.Close()
+			if err != nil {
+				t.Errorf("failed body close: %v", err)
+			}
+		}()
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, successBody, string(b))
+	})
+
+	t.Run("положительный тест: application/json запрос без сжатия, ждущий в ответе сжатый JSON", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		buf.Write([]byte(requestBody))
+
+		r := httptest.NewRequest("POST", srv.URL, buf)
+		r.RequestURI = ""
+		r.Header.Set("Content-Type", applicationJSON)
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		defer func() {
+			err := resp.Body.Close()
+			if err != nil {
+				t.Errorf("failed body close: %v", err)
+			}
+		}()
+
+		gz, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		defer func() {
+			err := gz.Close()
+			if err != nil {
+				t.Errorf("failed gzip close: %v", err)
+			}
+		}()
+
+		b, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.JSONEq(t, successBody, string(b))
+	})
+
+	t.Run("положительный тест: application/json запрос, в котором сжатый JSON, ждущий в ответе сжатый JSON", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		zb := gzip.NewWriter(buf)
+		_, err := zb.Write([]byte(requestBody))
+		require.NoError(t, err)
+		err = zb.Close()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest("POST", srv.URL, buf)
+		r.RequestURI = ""
+		r.Header.Set("Content-Type", applicationJSON)
+		r.Header.Set("Content-Encoding", "gzip")
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		resp, err := http.DefaultClient.Do(r)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		defer func() {
+			err := resp.Body.Close()
+			if err != nil {
+				t.Errorf("failed body close: %v", err)
+			}
+		}()
+
+		gz, err := gzip.NewReader(resp.Body)
+		require.NoError(t, err)
+		defer func() {
+			err := gz.Close()
+			if err != nil {
+				t.Errorf("failed gzip close: %v", err)
+			}
+		}()
+
+		b, err := io.ReadAll(gz)
+		require.NoError(t, err)
+		require.JSONEq(t, successBody, string(b))
+	})
+}
+
+func TestWithCompression_Negotiation(t *testing.T) {
+	body := strings.Repeat(`{"id":"foo","type":"gauge","value":42.1}`, 10)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		status         int
+		minSize        int
+		wantEncoding   string
+	}{
+		{name: "zstd", acceptEncoding: "zstd", contentType: applicationJSON, status: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "brotli", acceptEncoding: "br", contentType: applicationJSON, status: http.StatusOK, wantEncoding: compress.Brotli},
+		{name: "выбор по q-значениям", acceptEncoding: "gzip;q=1, zstd;q=0.5, br;q=0.8", contentType: applicationJSON, status: http.StatusOK, wantEncoding: compress.Gzip},
+		{name: "при равных весах порядок сервера", acceptEncoding: "gzip, br, zstd", contentType: applicationJSON, status: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "запрет через q=0", acceptEncoding: "zstd;q=0, gzip", contentType: applicationJSON, status: http.StatusOK, wantEncoding: compress.Gzip},
+		{name: "звёздочка", acceptEncoding: "*", contentType: "text/plain; charset=utf-8", status: http.StatusOK, wantEncoding: compress.Zstd},
+		{name: "неизвестная кодировка", acceptEncoding: "deflate", contentType: applicationJSON, status: http.StatusOK},
+		{name: "несжимаемый тип", acceptEncoding: "gzip", contentType: "application/octet-stream", status: http.StatusOK},
+		{name: "ответ меньше порога", acceptEncoding: "gzip", contentType: applicationJSON, status: http.StatusOK, minSize: len(body) + 1},
+		{name: "ответ без тела", acceptEncoding: "gzip", contentType: applicationJSON, status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCompression(tt.minSize, &mockLogger{}).WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusNoContent {
+					_, _ = io.WriteString(w, body)
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+			if tt.status == http.StatusNoContent {
+				assert.Empty(t, w.Body.Bytes())
+				return
+			}
+
+			var reader io.Reader = w.Body
+			if tt.wantEncoding != "" {
+				zr, err := compress.NewReader(tt.wantEncoding, w.Body)
+				require.NoError(t, err)
+				defer zr.Close()
+				reader = zr
+			}
+			b, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(b))
+		})
+	}
+}
+
+func TestWithCompression_RequestBody(t *testing.T) {
+	requestBody := `{"id":"foo","type":"gauge","value":42.1}`
+
+	tests := []struct {
+		name       string
+		encoding   string
+		wantStatus int
+	}{
+		{name: "zstd", encoding: compress.Zstd, wantStatus: http.StatusOK},
+		{name: "brotli", encoding: compress.Brotli, wantStatus: http.StatusOK},
+		{name: "неподдерживаемая кодировка", encoding: "deflate", wantStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewCompression(0, &mockLogger{}).WithCompression(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				assert.Equal(t, requestBody, string(b))
+			}))
+
+			buf := bytes.NewBuffer(nil)
+			if zw, err := compress.NewWriter(tt.encoding, buf); err == nil {
+				_, err = io.WriteString(zw, requestBody)
+				require.NoError(t, err)
+				require.NoError(t, zw.Close())
+			} else {
+				buf.WriteString(requestBody)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", buf)
+			r.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -2,11 +2,6 @@ package middlewares
 
 import (
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
 	"io"
 	"net/http"
 
@@ -18,34 +13,34 @@ type customLogger interface {
 	Info(string, ...zap.Field)
 }
 
+type keyRingProvider interface {
+	KeyRing() *crypto.KeyRing
+}
+
 type DecryptMiddleware struct {
-	logger         customLogger
-	privateKeyPath string
+	logger customLogger
+	keys   keyRingProvider
 }
 
-func NewDecryptMiddleware(privateKeyPath string, logger customLogger) *DecryptMiddleware {
+func NewDecryptMiddleware(keys keyRingProvider, logger customLogger) *DecryptMiddleware {
 	return &DecryptMiddleware{
-		privateKeyPath: privateKeyPath,
-		logger:         logger,
+		keys:   keys,
+		logger: logger,
 	}
 }
 
 func (dm *DecryptMiddleware) DecryptHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if dm.privateKeyPath == "" {
+		keyRing := dm.keys.KeyRing()
+		// набор пуст, только если пути к ключам не заданы: иначе KeyCache не стартует
+		if keyRing.Len() == 0 {
 			next.ServeHTTP(w, r)
 			return
 		}
-		privateKey, err := crypto.LoadPrivateKey(dm.privateKeyPath)
-		if err != nil {
-			dm.logger.Info("failed LoadPrivateKey", zap.Error(err))
-			http.Error(w, "cannot load private key", http.StatusInternalServerError)
-			return
-		}
 		encryptedData, err := io.ReadAll(r.Body)
 		if err != nil {
 			dm.logger.Info("failed to read request body", zap.Error(err))
-			http.Error(w, "failed to read request body", http.StatusInternalServerError)
+			http.Error(w, "failed to read request body", readErrorStatus(err))
 			return
 		}
 		defer func() {
@@ -55,54 +50,7 @@ func (dm *DecryptMiddleware) DecryptHandler(next http.Handler) http.Handler {
 			}
 		}()
 
-		if len(encryptedData) == 0 {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Извлекаем зашифрованный симметричный ключ
-		encryptedKeySize := privateKey.Size()
-		if len(encryptedData) < encryptedKeySize {
-			dm.logger.Info("encrypted data is too short")
-			http.Error(w, "encrypted data is too short", http.StatusInternalServerError)
-			return
-		}
-
-		encryptedKey := encryptedData[:encryptedKeySize]
-		ciphertext := encryptedData[encryptedKeySize:]
-
-		// Расшифровка симметричного ключа с использованием RSA
-		aesKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, encryptedKey, nil)
-		if err != nil {
-			dm.logger.Info("failed to decrypt AES key", zap.Error(err))
-			http.Error(w, "failed to decrypt AES key", http.StatusInternalServerError)
-			return
-		}
-
-		// Расшифровка данных с использованием AES
-		block, err := aes.NewCipher(aesKey)
-		if err != nil {
-			dm.logger.Info("failed to create AES cipher", zap.Error(err))
-			http.Error(w, "failed to create AES cipher", http.StatusInternalServerError)
-			return
-		}
-
-		gcm, err := cipher.NewGCM(block)
-		if err != nil {
-			dm.logger.Info("failed to create GCM", zap.Error(err))
-			http.Error(w, "failed to create GCM", http.StatusInternalServerError)
-			return
-		}
-
-		nonceSize := gcm.NonceSize()
-		if len(ciphertext) < nonceSize {
-			dm.logger.Info("ciphertext too short")
-			http.Error(w, "ciphertext too short", http.StatusInternalServerError)
-			return
-		}
-
-		nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-		plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+		plaintext, err := crypto.DecryptData(keyRing, encryptedData, r.URL.Path)
 		if err != nil {
 			dm.logger.Info("failed to decrypt data", zap.Error(err))
 			http.Error(w, "failed to decrypt data", http.StatusInternalServerError)
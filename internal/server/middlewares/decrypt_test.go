@@ -52,7 +52,9 @@ func TestDecryptMiddleware(t *testing.T) {
 	}()
 
 	logger := &mockLogger{}
-	middleware := NewDecryptMiddleware(privateKeyPath, logger)
+	keys, err := crypto.NewKeyCache([]string{privateKeyPath}, logger)
+	assert.NoError(t, err)
+	middleware := NewDecryptMiddleware(keys, logger)
 
 	tests := []struct {
 		name             string
@@ -65,9 +67,9 @@ func TestDecryptMiddleware(t *testing.T) {
 			name: "Successful decryption",
 			prepareRequest: func() *http.Request {
 				message := []byte("hello, world")
-				encryptedMessage, err := crypto.EncryptData(publicKey, message)
+				encryptedMessage, err := crypto.EncryptData(publicKey, message, "/updates/")
 				assert.NoError(t, err)
-				return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encryptedMessage))
+				return httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encryptedMessage))
 			},
 			expectedResponse: http.StatusOK,
 			expectedBody:     []byte("hello, world"),
@@ -76,7 +78,7 @@ func TestDecryptMiddleware(t *testing.T) {
 		{
 			name: "Invalid data",
 			prepareRequest: func() *http.Request {
-				return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte("invalid data")))
+				return httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader([]byte("invalid data")))
 			},
 			expectedResponse: http.StatusInternalServerError,
 			expectedBody:     nil,
@@ -85,9 +87,9 @@ func TestDecryptMiddleware(t *testing.T) {
 		{
 			name: "Empty data",
 			prepareRequest: func() *http.Request {
-				encryptedMessage, err := crypto.EncryptData(publicKey, []byte{})
+				encryptedMessage, err := crypto.EncryptData(publicKey, []byte{}, "/updates/")
 				assert.NoError(t, err)
-				return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(encryptedMessage))
+				return httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encryptedMessage))
 			},
 			expectedResponse: http.StatusOK,
 			expectedBody:     []byte{},
@@ -96,7 +98,7 @@ func TestDecryptMiddleware(t *testing.T) {
 		{
 			name: "Too short data",
 			prepareRequest: func() *http.Request {
-				return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(make([]byte, 10)))
+				return httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(make([]byte, 10)))
 			},
 			expectedResponse: http.StatusInternalServerError,
 			expectedBody:     nil,
@@ -128,3 +130,51 @@ func TestDecryptMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestDecryptMiddleware_KeyRotation(t *testing.T) {
+	oldPrivateKey, oldPublicKey := generateTestKeys(t)
+	newPrivateKey, _ := generateTestKeys(t)
+
+	var paths []string
+	for _, key := range []*rsa.PrivateKey{oldPrivateKey, newPrivateKey} {
+		path := createTempKeyFile(t, pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		}))
+		defer func() {
+			err := os.Remove(path)
+			if err != nil {
+				t.Fatalf("Failed to remove temp file for server private key: %v", err)
+			}
+		}()
+		paths = append(paths, path)
+	}
+
+	keys, err := crypto.NewKeyCache(paths, &mockLogger{})
+	assert.NoError(t, err)
+	middleware := NewDecryptMiddleware(keys, &mockLogger{})
+
+	message := []byte("hello, world")
+	encryptedMessage, err := crypto.EncryptData(oldPublicKey, message, "/updates/")
+	assert.NoError(t, err)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, message, body)
+	})
+
+	t.Run("Старый ключ принимается после добавления нового", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(encryptedMessage))
+		middleware.DecryptHandler(nextHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Конверт привязан к маршруту", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(encryptedMessage))
+		middleware.DecryptHandler(nextHandler).ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
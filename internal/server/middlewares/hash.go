@@ -5,42 +5,67 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
 	"net/http"
+
+	"github.com/NikolosHGW/metric/internal/signature"
 )
 
-func NewHashMiddleware(key string) *HashMiddleware {
+type signatureVerifier interface {
+	Verify([]byte, signature.Params) error
+}
+
+// NewHashMiddleware конструктор, verifier проверяет подпись вместе с меткой времени и nonce
+func NewHashMiddleware(key string, verifier signatureVerifier) *HashMiddleware {
 	return &HashMiddleware{
-		key: key,
+		key:      key,
+		verifier: verifier,
 	}
 }
 
 type HashMiddleware struct {
-	key string
+	verifier signatureVerifier
+	key      string
 }
 
 func (hm HashMiddleware) WithHash(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("HashSHA256") != "" && hm.key != "" {
+		if hm.key != "" {
+			params := signature.Params{
+				Hash:      r.Header.Get(signature.HashHeader),
+				Timestamp: r.Header.Get(signature.TimestampHeader),
+				Nonce:     r.Header.Get(signature.NonceHeader),
+			}
+			// без подписи запрос не проверить на повтор, поэтому при заданном ключе он отклоняется
+			if params.Hash == "" || params.Timestamp == "" || params.Nonce == "" {
+				http.Error(w, "request signature is required", http.StatusUnauthorized)
+				return
+			}
+
 			bodyBytes, err := io.ReadAll(r.Body)
 			if err != nil {
-				http.Error(w, "error reading request body", http.StatusInternalServerError)
+				http.Error(w, "error reading request body", readErrorStatus(err))
 				return
 			}
 
 			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
-			requestHash := r.Header.Get("HashSHA256")
-			if !checkHash(bodyBytes, hm.key, requestHash) {
+			err = hm.verifier.Verify(bodyBytes, params)
+			if errors.Is(err, signature.ErrHashMismatch) {
 				http.Error(w, "хэш не совпадает", http.StatusBadRequest)
 				return
 			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 
 		hw := &hashWriter{
 			ResponseWriter: w,
 			key:            hm.key,
-			rHash:          r.Header.Get("HashSHA256"),
+			rHash:          r.Header.Get(signature.HashHeader),
 		}
 
 		h.ServeHTTP(hw, r)
@@ -55,15 +80,11 @@ type hashWriter struct {
 
 func (hw hashWriter) Write(b []byte) (int, error) {
 	if hw.rHash != "" && hw.key != "" {
-		hw.Header().Set("HashSHA256", string(getHash(b, hw.key)))
+		hw.Header().Set(signature.HashHeader, getHash(b, hw.key))
 	}
 	return hw.ResponseWriter.Write(b)
 }
 
-func checkHash(data []byte, key string, requestHash string) bool {
-	return hmac.Equal([]byte(getHash(data, key)), []byte(requestHash))
-}
-
 func getHash(data []byte, key string) string {
 	h := hmac.New(sha256.New, []byte(key))
 	h.Write(data)
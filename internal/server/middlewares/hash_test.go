@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashMiddleware_Replay(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	params, err := signature.Sign(key, body)
+	require.NoError(t, err)
+
+	hm := NewHashMiddleware(key, signature.NewVerifier(key, signature.DefaultWindow))
+	handler := hm.WithHash(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+
+	send := func(p signature.Params) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+		req.Header.Set(signature.HashHeader, p.Hash)
+		req.Header.Set(signature.TimestampHeader, p.Timestamp)
+		req.Header.Set(signature.NonceHeader, p.Nonce)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send(params)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.NotEmpty(t, first.Header().Get(signature.HashHeader))
+
+	assert.Equal(t, http.StatusBadRequest, send(params).Code, "повтор запроса должен отклоняться")
+
+	legacy := signature.Params{Hash: getHash(body, key)}
+	assert.Equal(t, http.StatusUnauthorized, send(legacy).Code, "подпись без метки времени и nonce не принимается")
+}
+
+func TestHashMiddleware_Unsigned(t *testing.T) {
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	tests := []struct {
+		name         string
+		key          string
+		expectedCode int
+	}{
+		{
+			name:         "ключ задан, запрос без подписи отклоняется",
+			key:          "secret",
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:         "ключ не задан, подпись не нужна",
+			expectedCode: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hm := NewHashMiddleware(tt.key, signature.NewVerifier(tt.key, signature.DefaultWindow))
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+
+			hm.WithHash(next).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+		})
+	}
+}
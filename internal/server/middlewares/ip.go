@@ -1,47 +1,43 @@
 package middlewares
 
 import (
-	"net"
 	"net/http"
+	"net/netip"
 
+	"github.com/NikolosHGW/metric/internal/netfilter"
 	"go.uber.org/zap"
 )
 
-type CheckIP struct {
-	logger        customLogger
-	trustedSubnet string
+type ipFilter interface {
+	Enabled() bool
+	Allowed(netip.Addr) bool
+	ClientIP(netip.Addr, func(string) string) netip.Addr
 }
 
-func NewCheckIP(trustedSubnet string, logger customLogger) *CheckIP {
-	return &CheckIP{
-		trustedSubnet: trustedSubnet,
-		logger:        logger,
-	}
+// CheckIP пропускает только клиентов из разрешённых подсетей. Адрес берётся из соединения,
+// заголовкам X-Real-IP и X-Forwarded-For верим только от доверенных прокси
+type CheckIP struct {
+	logger customLogger
+	filter ipFilter
 }
 
-func (m *CheckIP) isIPTrusted(r *http.Request) bool {
-	if m.trustedSubnet == "" {
-		return true
-	}
-
-	xRealIP := r.Header.Get("X-Real-IP")
-	if xRealIP == "" {
-		return false
-	}
-
-	ip := net.ParseIP(xRealIP)
-	_, cidr, err := net.ParseCIDR(m.trustedSubnet)
-	if err != nil {
-		m.logger.Info("Invalid CIDR", zap.Error(err))
-		return false
+func NewCheckIP(filter ipFilter, logger customLogger) *CheckIP {
+	return &CheckIP{
+		filter: filter,
+		logger: logger,
 	}
-
-	return cidr.Contains(ip)
 }
 
 func (m *CheckIP) WithCheckIP(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !m.isIPTrusted(r) {
+		if !m.filter.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := m.filter.ClientIP(netfilter.ParseAddr(r.RemoteAddr), r.Header.Get)
+		if !m.filter.Allowed(ip) {
+			m.logger.Info("IP address not trusted", zap.String("clientIP", ip.String()))
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
@@ -4,68 +4,87 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/NikolosHGW/metric/internal/netfilter"
 )
 
 func TestCheckIPMiddleware(t *testing.T) {
 	tests := []struct {
 		name           string
-		trustedSubnet  string
+		allow          []string
+		deny           []string
+		proxies        []string
+		remoteAddr     string
 		xRealIP        string
 		expectedStatus int
 	}{
 		{
 			name:           "No trusted subnet, any IP allowed",
-			trustedSubnet:  "",
-			xRealIP:        "192.168.1.1",
+			remoteAddr:     "192.168.1.1:1234",
 			expectedStatus: http.StatusOK,
 		},
 		{
 			name:           "Valid IP in trusted subnet",
-			trustedSubnet:  "192.168.1.0/24",
-			xRealIP:        "192.168.1.10",
+			allow:          []string{"192.168.1.0/24"},
+			remoteAddr:     "192.168.1.10:1234",
 			expectedStatus: http.StatusOK,
 		},
 		{
 			name:           "Invalid IP outside trusted subnet",
-			trustedSubnet:  "192.168.1.0/24",
-			xRealIP:        "192.168.2.10",
+			allow:          []string{"192.168.1.0/24"},
+			remoteAddr:     "192.168.2.10:1234",
 			expectedStatus: http.StatusForbidden,
 		},
 		{
-			name:           "Invalid CIDR format",
-			trustedSubnet:  "invalid-cidr",
-			xRealIP:        "192.168.1.10",
-			expectedStatus: http.StatusForbidden,
+			name:           "IP in one of several subnets",
+			allow:          []string{"10.0.0.0/8", "192.168.1.0/24"},
+			remoteAddr:     "10.1.2.3:1234",
+			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "Empty X-Real-IP header",
-			trustedSubnet:  "192.168.1.0/24",
-			xRealIP:        "",
-			expectedStatus: http.StatusForbidden,
+			name:           "IPv6 client in trusted subnet",
+			allow:          []string{"2001:db8::/32"},
+			remoteAddr:     "[2001:db8::1]:1234",
+			expectedStatus: http.StatusOK,
 		},
 		{
-			name:           "IP is within the subnet boundary",
-			trustedSubnet:  "192.168.1.0/24",
-			xRealIP:        "192.168.1.255",
-			expectedStatus: http.StatusOK,
+			name:           "Denied subnet wins over allowed",
+			allow:          []string{"192.168.0.0/16"},
+			deny:           []string{"192.168.1.0/24"},
+			remoteAddr:     "192.168.1.10:1234",
+			expectedStatus: http.StatusForbidden,
 		},
 		{
-			name:           "IP is outside the subnet boundary",
-			trustedSubnet:  "192.168.1.0/25",
-			xRealIP:        "192.168.1.128",
+			name:           "X-Real-IP from untrusted peer is ignored",
+			allow:          []string{"192.168.1.0/24"},
+			remoteAddr:     "203.0.113.5:1234",
+			xRealIP:        "192.168.1.10",
 			expectedStatus: http.StatusForbidden,
 		},
+		{
+			name:           "X-Real-IP from trusted proxy is honored",
+			allow:          []string{"192.168.1.0/24"},
+			proxies:        []string{"10.0.0.1"},
+			remoteAddr:     "10.0.0.1:1234",
+			xRealIP:        "192.168.1.10",
+			expectedStatus: http.StatusOK,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middleware := NewCheckIP(tt.trustedSubnet, &mockLogger{})
+			filter, err := netfilter.New(tt.allow, tt.deny, tt.proxies)
+			if err != nil {
+				t.Fatalf("failed to parse filter: %v", err)
+			}
+			middleware := NewCheckIP(filter, &mockLogger{})
 
 			handler := middleware.WithCheckIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			}))
 
 			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			req.RemoteAddr = tt.remoteAddr
 			if tt.xRealIP != "" {
 				req.Header.Set("X-Real-IP", tt.xRealIP)
 			}
@@ -0,0 +1,86 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/netfilter"
+	"github.com/NikolosHGW/metric/internal/ratelimit"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"go.uber.org/zap"
+)
+
+type rateLimiter interface {
+	Allow(string) (bool, time.Duration)
+}
+
+type clientIPResolver interface {
+	ClientIP(netip.Addr, func(string) string) netip.Addr
+}
+
+// Limits ограничивает частоту запросов каждого клиента и размер тела запроса
+type Limits struct {
+	limiter     rateLimiter
+	resolver    clientIPResolver
+	logger      customLogger
+	maxBodySize int64
+}
+
+// NewLimits конструктор, maxBodySize <= 0 снимает ограничение на размер тела
+func NewLimits(limiter rateLimiter, resolver clientIPResolver, maxBodySize int64, logger customLogger) *Limits {
+	return &Limits{
+		limiter:     limiter,
+		resolver:    resolver,
+		logger:      logger,
+		maxBodySize: maxBodySize,
+	}
+}
+
+// WithRateLimit отвечает 429 с заголовком Retry-After, если клиент исчерпал лимит запросов.
+// Клиент определяется по identity из контекста, поэтому middleware ставится после аутентификации
+func (l *Limits) WithRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.resolver.ClientIP(netfilter.ParseAddr(r.RemoteAddr), r.Header.Get)
+		key := ratelimit.Key(identity.NameFromContext(r.Context()), ip)
+
+		if ok, wait := l.limiter.Allow(key); !ok {
+			l.logger.Info("rate limit exceeded", zap.String("client", key))
+			w.Header().Set("Retry-After", strconv.Itoa(ratelimit.RetryAfterSeconds(wait)))
+			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithBodyLimit отвечает 413 на запросы с телом больше maxBodySize.
+// Ставится после распаковки gzip, чтобы ограничивать и распакованный размер
+func (l *Limits) WithBodyLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.maxBodySize <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > l.maxBodySize {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, l.maxBodySize)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readErrorStatus 413 если тело обрезано WithBodyLimit, иначе 500
+func readErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusInternalServerError
+}
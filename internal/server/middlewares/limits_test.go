@@ -0,0 +1,75 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/netfilter"
+	"github.com/NikolosHGW/metric/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits_WithRateLimit(t *testing.T) {
+	filter, err := netfilter.New(nil, nil, nil)
+	require.NoError(t, err)
+	limits := NewLimits(ratelimit.New(1, 1), filter, 0, &mockLogger{})
+	handler := limits.WithRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.1:1000").Code)
+
+	limited := send("10.0.0.1:1001")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+
+	assert.Equal(t, http.StatusOK, send("10.0.0.2:1000").Code, "другой клиент не ограничен")
+}
+
+func TestLimits_WithBodyLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		unknownLength  bool
+		expectedStatus int
+	}{
+		{name: "Тело в пределах лимита", body: "small", expectedStatus: http.StatusOK},
+		{name: "Content-Length больше лимита", body: strings.Repeat("x", 32), expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "Тело без Content-Length больше лимита", body: strings.Repeat("x", 32), unknownLength: true, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewLimits(nil, nil, 16, &mockLogger{}).WithBodyLimit(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if _, err := io.ReadAll(r.Body); err != nil {
+						http.Error(w, err.Error(), readErrorStatus(err))
+						return
+					}
+					w.WriteHeader(http.StatusOK)
+				}),
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
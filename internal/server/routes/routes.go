@@ -3,6 +3,7 @@ package routes
 import (
 	"net/http"
 
+	"github.com/NikolosHGW/metric/internal/server/identity"
 	"github.com/NikolosHGW/metric/internal/server/middlewares"
 	"github.com/NikolosHGW/metric/internal/server/routes/update"
 	"github.com/NikolosHGW/metric/internal/server/routes/value"
@@ -20,6 +21,25 @@ type Handler interface {
 	UpsertMetrics(http.ResponseWriter, *http.Request)
 }
 
+type TokenHandler interface {
+	CreateToken(http.ResponseWriter, *http.Request)
+	ListTokens(http.ResponseWriter, *http.Request)
+	RevokeToken(http.ResponseWriter, *http.Request)
+}
+
+type DBHandler interface {
+	Stats(http.ResponseWriter, *http.Request)
+}
+
+type HistoryHandler interface {
+	Query(http.ResponseWriter, *http.Request)
+}
+
+type AuthMiddleware interface {
+	WithAuth(next http.Handler) http.Handler
+	RequireRole(role string) func(http.Handler) http.Handler
+}
+
 type Middleware interface {
 	WithHash(http.Handler) http.Handler
 }
@@ -28,26 +48,69 @@ type DecryptMiddleware interface {
 	DecryptHandler(next http.Handler) http.Handler
 }
 
-type CheckIPMiddleware interface {
-	WithCheckIP(next http.Handler) http.Handler
+type CompressionMiddleware interface {
+	WithCompression(next http.Handler) http.Handler
 }
 
-func InitRouter(handler Handler, myMiddleware Middleware, decryptMiddleware DecryptMiddleware, checkIP CheckIPMiddleware) *chi.Mux {
+type LimitsMiddleware interface {
+	WithRateLimit(next http.Handler) http.Handler
+	WithBodyLimit(next http.Handler) http.Handler
+}
+
+func InitRouter(
+	handler Handler,
+	tokenHandler TokenHandler,
+	dbHandler DBHandler,
+	historyHandler HistoryHandler,
+	myMiddleware Middleware,
+	decryptMiddleware DecryptMiddleware,
+	auth AuthMiddleware,
+	limits LimitsMiddleware,
+	compression CompressionMiddleware,
+) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middlewares.WithLogging)
-	r.Use(middlewares.WithGzip)
+	r.Use(compression.WithCompression)
+	r.Use(limits.WithBodyLimit)
 
 	r.Route("/", func(r chi.Router) {
-		r.Get("/", handler.GetMetrics)
+		r.Use(auth.WithAuth)
+		r.Use(limits.WithRateLimit)
+
 		r.Get("/ping", handler.PingDB)
-		r.With(myMiddleware.WithHash, decryptMiddleware.DecryptHandler, checkIP.WithCheckIP).Post("/updates/", handler.UpsertMetrics)
 
-		update.InitUpdateRoutes(r, handler.SetMetric, handler.SetJSONMetric)
-		value.InitValueRoutes(r, handler.GetValueMetric, handler.GetMetric)
-	})
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireRole(identity.RoleReader))
+			r.Get("/", handler.GetMetrics)
+			value.InitValueRoutes(r, handler.GetValueMetric, handler.GetMetric)
+			r.Get("/history/{metricName}", historyHandler.Query)
+		})
 
-	r.Mount("/debug", middleware.Profiler())
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireRole(identity.RoleWriter))
+			r.With(myMiddleware.WithHash, decryptMiddleware.DecryptHandler).Post("/updates/", handler.UpsertMetrics)
+			update.InitUpdateRoutes(r, handler.SetMetric, handler.SetJSONMetric)
+		})
+
+		r.Route("/admin/tokens", func(r chi.Router) {
+			r.Use(auth.RequireRole(identity.RoleAdmin))
+			r.Get("/", tokenHandler.ListTokens)
+			r.Post("/", tokenHandler.CreateToken)
+			r.Delete("/{id}", tokenHandler.RevokeToken)
+		})
+
+		r.Route("/admin/db", func(r chi.Router) {
+			r.Use(auth.RequireRole(identity.RoleAdmin))
+			r.Get("/", dbHandler.Stats)
+		})
+
+		// профили и дампы памяти раскрывают внутреннее состояние сервера, поэтому только для admin
+		r.Route("/debug", func(r chi.Router) {
+			r.Use(auth.RequireRole(identity.RoleAdmin))
+			r.Mount("/", middleware.Profiler())
+		})
+	})
 
 	return r
 }
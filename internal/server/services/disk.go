@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"time"
 )
 
@@ -11,8 +12,14 @@ type DiskStorage interface {
 	CanWriteToDisk() bool
 }
 
+// WAL журнал упреждающей записи, проигрываемый поверх снимка при старте
+type WAL interface {
+	Recover(replay bool) error
+}
+
 type DiskService struct {
 	diskStrg      DiskStorage
+	wal           WAL
 	storeInterval int
 	restore       bool
 }
@@ -42,8 +49,22 @@ func (dService *DiskService) CollectMetrics(ctx context.Context) {
 	}
 }
 
-func (dService DiskService) FillMetricStorage() {
+// SetWAL подключает журнал, который восстанавливается в FillMetricStorage
+func (dService *DiskService) SetWAL(wal WAL) {
+	dService.wal = wal
+}
+
+// FillMetricStorage загружает снимок и проигрывает поверх него журнал.
+// Без restore журнал очищается, чтобы старые записи не попали в новый снимок
+func (dService DiskService) FillMetricStorage() error {
 	if dService.restore {
 		dService.diskStrg.WriteToStorage()
 	}
+	if dService.wal != nil {
+		if err := dService.wal.Recover(dService.restore); err != nil {
+			return fmt.Errorf("cannot recover wal: %w", err)
+		}
+	}
+
+	return nil
 }
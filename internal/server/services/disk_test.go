@@ -2,10 +2,13 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockDiskStorage struct {
@@ -44,7 +47,54 @@ func TestDiskService_FillMetricStorage(t *testing.T) {
 
 	diskService := NewDiskService(mockDiskStorage, 1, true)
 
-	diskService.FillMetricStorage()
+	require.NoError(t, diskService.FillMetricStorage())
 
 	mockDiskStorage.AssertCalled(t, "WriteToStorage")
 }
+
+type MockWAL struct {
+	mock.Mock
+}
+
+func (m *MockWAL) Recover(replay bool) error {
+	args := m.Called(replay)
+	return args.Error(0)
+}
+
+func TestDiskService_FillMetricStorage_WAL(t *testing.T) {
+	tests := []struct {
+		name       string
+		restore    bool
+		recoverErr error
+		wantErr    bool
+	}{
+		{name: "журнал проигрывается после снимка", restore: true},
+		{name: "без restore журнал очищается", restore: false},
+		{name: "ошибка восстановления журнала", restore: true, recoverErr: errors.New("broken"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDiskStorage := new(MockDiskStorage)
+			mockDiskStorage.On("WriteToStorage").Return()
+			mockWAL := new(MockWAL)
+			mockWAL.On("Recover", tt.restore).Return(tt.recoverErr)
+
+			diskService := NewDiskService(mockDiskStorage, 1, tt.restore)
+			diskService.SetWAL(mockWAL)
+
+			err := diskService.FillMetricStorage()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockWAL.AssertExpectations(t)
+			if tt.restore {
+				mockDiskStorage.AssertCalled(t, "WriteToStorage")
+			} else {
+				mockDiskStorage.AssertNotCalled(t, "WriteToStorage")
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+)
+
+const (
+	// ExpiredSeriesMetric counter сервера с числом удалённых по TTL метрик
+	ExpiredSeriesMetric = "ServerExpiredSeries"
+	// JanitorInterval как часто ищутся устаревшие метрики
+	JanitorInterval = time.Minute
+)
+
+// SeriesStore хранилище, которое помнит время последней записи метрик
+type SeriesStore interface {
+	LastUpdated(context.Context) (map[string]time.Time, error)
+	ExpireMetrics(ctx context.Context, names []string, before time.Time) ([]string, error)
+}
+
+type counterWriter interface {
+	SetCounterMetric(context.Context, string, models.Counter) error
+}
+
+// TTLRule срок жизни метрик, имя которых подходит под шаблон path.Match.
+// TTL 0 означает, что такие метрики не устаревают
+type TTLRule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// ParseTTLRules разбирает правила вида "CPU*=1h,PollCount=0"
+func ParseTTLRules(spec string) ([]TTLRule, error) {
+	var rules []TTLRule
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, ttlSpec, ok := strings.Cut(part, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("ttl rule %q: want pattern=ttl", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("ttl rule %q: %w", part, err)
+		}
+		ttl, err := time.ParseDuration(ttlSpec)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("ttl rule %q: invalid ttl", part)
+		}
+		rules = append(rules, TTLRule{Pattern: pattern, TTL: ttl})
+	}
+
+	return rules, nil
+}
+
+// Janitor удаляет метрики, которые не записывались дольше своего TTL: срок берётся
+// из первого подходящего правила, иначе общий. Число удалённых метрик копится
+// в counter ExpiredSeriesMetric, сам он не устаревает
+type Janitor struct {
+	store   SeriesStore
+	repo    counterWriter
+	log     customLogger
+	rules   []TTLRule
+	ttl     time.Duration
+	now     func() time.Time
+	expired atomic.Int64
+}
+
+// NewJanitor конструктор, self-метрика пишется через repo, чтобы пройти тот же путь, что и записи агентов
+func NewJanitor(store SeriesStore, repo counterWriter, ttl time.Duration, rules []TTLRule, log customLogger) *Janitor {
+	return &Janitor{
+		store: store,
+		repo:  repo,
+		log:   log,
+		rules: rules,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Enabled есть ли метрики, которые могут устареть
+func (j *Janitor) Enabled() bool {
+	if j.ttl > 0 {
+		return true
+	}
+	for _, rule := range j.rules {
+		if rule.TTL > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (j *Janitor) ttlFor(name string) time.Duration {
+	if name == ExpiredSeriesMetric {
+		return 0
+	}
+	for _, rule := range j.rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.TTL
+		}
+	}
+
+	return j.ttl
+}
+
+// Expire удаляет устаревшие метрики и возвращает их число
+func (j *Janitor) Expire(ctx context.Context) (int, error) {
+	updated, err := j.store.LastUpdated(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// метрики с одинаковым TTL удаляются одним запросом
+	now := j.now()
+	byTTL := make(map[time.Duration][]string)
+	for name, at := range updated {
+		ttl := j.ttlFor(name)
+		if ttl > 0 && at.Before(now.Add(-ttl)) {
+			byTTL[ttl] = append(byTTL[ttl], name)
+		}
+	}
+
+	var expired []string
+	for ttl, names := range byTTL {
+		removed, err := j.store.ExpireMetrics(ctx, names, now.Add(-ttl))
+		if err != nil {
+			return len(expired), err
+		}
+		expired = append(expired, removed...)
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	j.expired.Add(int64(len(expired)))
+	j.log.Info("stale metrics expired", zap.Strings("metrics", expired))
+	if err := j.repo.SetCounterMetric(ctx, ExpiredSeriesMetric, models.Counter(len(expired))); err != nil {
+		return len(expired), fmt.Errorf("cannot write %s: %w", ExpiredSeriesMetric, err)
+	}
+
+	return len(expired), nil
+}
+
+// Expired сколько метрик удалено с запуска сервера
+func (j *Janitor) Expired() int64 {
+	return j.expired.Load()
+}
+
+// Run раз в JanitorInterval удаляет устаревшие метрики до отмены ctx
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(JanitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := j.Expire(ctx); err != nil {
+				j.log.Info("cannot expire stale metrics", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
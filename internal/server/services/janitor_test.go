@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+)
+
+type seriesStoreMock struct {
+	updated  map[string]time.Time
+	counters map[string]models.Counter
+}
+
+func (ss *seriesStoreMock) LastUpdated(context.Context) (map[string]time.Time, error) {
+	return ss.updated, nil
+}
+
+func (ss *seriesStoreMock) ExpireMetrics(_ context.Context, names []string, before time.Time) ([]string, error) {
+	var expired []string
+	for _, name := range names {
+		if at, ok := ss.updated[name]; ok && at.Before(before) {
+			delete(ss.updated, name)
+			expired = append(expired, name)
+		}
+	}
+	return expired, nil
+}
+
+func (ss *seriesStoreMock) SetCounterMetric(_ context.Context, name string, value models.Counter) error {
+	ss.counters[name] += value
+	return nil
+}
+
+func TestParseTTLRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []TTLRule
+		wantErr bool
+	}{
+		{
+			name: "шаблоны и бессрочные метрики",
+			spec: "CPU*=1h, PollCount=0",
+			want: []TTLRule{{Pattern: "CPU*", TTL: time.Hour}, {Pattern: "PollCount", TTL: 0}},
+		},
+		{name: "пусто", spec: ""},
+		{name: "нет срока", spec: "CPU*", wantErr: true},
+		{name: "неверный шаблон", spec: "CPU[=1h", wantErr: true},
+		{name: "отрицательный срок", spec: "CPU*=-1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTTLRules(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestJanitor_Expire(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := &seriesStoreMock{
+		updated: map[string]time.Time{
+			"Alloc":             now.Add(-2 * time.Hour),
+			"Fresh":             now.Add(-time.Minute),
+			"CPUutilization1":   now.Add(-10 * time.Minute),
+			"PollCount":         now.Add(-48 * time.Hour),
+			ExpiredSeriesMetric: now.Add(-48 * time.Hour),
+		},
+		counters: map[string]models.Counter{},
+	}
+	rules := []TTLRule{{Pattern: "CPU*", TTL: 5 * time.Minute}, {Pattern: "PollCount", TTL: 0}}
+	j := NewJanitor(store, store, time.Hour, rules, zap.NewNop())
+	j.now = func() time.Time { return now }
+
+	removed, err := j.Expire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Contains(t, store.updated, "Fresh")
+	assert.Contains(t, store.updated, "PollCount", "правило с TTL 0 не даёт метрике устареть")
+	assert.Contains(t, store.updated, ExpiredSeriesMetric, "self-метрика не устаревает")
+	assert.NotContains(t, store.updated, "Alloc")
+	assert.NotContains(t, store.updated, "CPUutilization1")
+	assert.Equal(t, models.Counter(2), store.counters[ExpiredSeriesMetric])
+	assert.Equal(t, int64(2), j.Expired())
+
+	removed, err = j.Expire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, models.Counter(2), store.counters[ExpiredSeriesMetric])
+}
+
+func TestJanitor_Enabled(t *testing.T) {
+	assert.False(t, NewJanitor(nil, nil, 0, nil, zap.NewNop()).Enabled())
+	assert.False(t, NewJanitor(nil, nil, 0, []TTLRule{{Pattern: "*", TTL: 0}}, zap.NewNop()).Enabled())
+	assert.True(t, NewJanitor(nil, nil, 0, []TTLRule{{Pattern: "CPU*", TTL: time.Hour}}, zap.NewNop()).Enabled())
+	assert.True(t, NewJanitor(nil, nil, time.Hour, nil, zap.NewNop()).Enabled())
+}
@@ -2,10 +2,20 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+)
+
+var (
+	// ErrMetricForbidden метрика вне областей доступа клиента
+	ErrMetricForbidden = errors.New("metric is outside of client scopes")
+	// ErrBatchTooLarge в пачке больше метрик, чем разрешено конфигом
+	ErrBatchTooLarge = errors.New("too many metrics in batch")
 )
 
 type Repository interface {
@@ -21,7 +31,8 @@ type Repository interface {
 }
 
 type MetricService struct {
-	strg Repository
+	strg         Repository
+	maxBatchSize int
 }
 
 func NewMetricService(repo Repository) *MetricService {
@@ -30,7 +41,16 @@ func NewMetricService(repo Repository) *MetricService {
 	}
 }
 
+// SetMaxBatchSize ограничивает число метрик в одной пачке UpsertMetrics, 0 снимает ограничение
+func (ms *MetricService) SetMaxBatchSize(n int) {
+	ms.maxBatchSize = n
+}
+
 func (ms MetricService) SetMetric(ctx context.Context, metricType, metricName, metricValue string) error {
+	if !identity.CanAccessFromContext(ctx, metricName) {
+		return ErrMetricForbidden
+	}
+
 	var err error
 	if metricType == models.CounterType {
 		value, _ := strconv.ParseInt(metricValue, 10, 64)
@@ -46,6 +66,10 @@ func (ms MetricService) SetMetric(ctx context.Context, metricType, metricName, m
 }
 
 func (ms MetricService) GetMetricValue(ctx context.Context, metricType, metricName string) (string, error) {
+	if !identity.CanAccessFromContext(ctx, metricName) {
+		return "", ErrMetricForbidden
+	}
+
 	if metricType == models.GaugeType {
 		metricValue, err := ms.strg.GetGaugeMetric(ctx, metricName)
 
@@ -58,15 +82,38 @@ func (ms MetricService) GetMetricValue(ctx context.Context, metricType, metricNa
 }
 
 func (ms *MetricService) SetJSONMetric(ctx context.Context, m models.Metrics) error {
+	if !identity.CanAccessFromContext(ctx, m.ID) {
+		return ErrMetricForbidden
+	}
+	m.UpdatedBy = identity.NameFromContext(ctx)
+
 	return ms.strg.SetMetric(ctx, m)
 }
 
 func (ms MetricService) GetMetricByName(ctx context.Context, name string) (models.Metrics, error) {
+	if !identity.CanAccessFromContext(ctx, name) {
+		return models.Metrics{}, ErrMetricForbidden
+	}
+
 	return ms.strg.GetMetric(ctx, name)
 }
 
+// GetAllMetrics возвращает строки вида "имя: значение" только для метрик из областей доступа клиента
 func (ms MetricService) GetAllMetrics(ctx context.Context) []string {
-	return ms.strg.GetAllMetrics(ctx)
+	metrics := ms.strg.GetAllMetrics(ctx)
+	if id, ok := identity.FromContext(ctx); !ok || len(id.Scopes) == 0 {
+		return metrics
+	}
+
+	allowed := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		name, _, _ := strings.Cut(metric, ": ")
+		if identity.CanAccessFromContext(ctx, name) {
+			allowed = append(allowed, metric)
+		}
+	}
+
+	return allowed
 }
 
 func (ms MetricService) GetIsDBConnected() bool {
@@ -74,5 +121,26 @@ func (ms MetricService) GetIsDBConnected() bool {
 }
 
 func (ms MetricService) UpsertMetrics(ctx context.Context, mc models.MetricCollection) (models.MetricCollection, error) {
-	return ms.strg.UpsertMetrics(ctx, mc)
+	if ms.maxBatchSize > 0 && len(mc.Metrics) > ms.maxBatchSize {
+		return models.MetricCollection{}, fmt.Errorf("%w: %d > %d", ErrBatchTooLarge, len(mc.Metrics), ms.maxBatchSize)
+	}
+	for _, m := range mc.Metrics {
+		if !identity.CanAccessFromContext(ctx, m.ID) {
+			return models.MetricCollection{}, fmt.Errorf("%w: %s", ErrMetricForbidden, m.ID)
+		}
+	}
+
+	return ms.strg.UpsertMetrics(ctx, withUpdatedBy(ctx, mc))
+}
+
+// withUpdatedBy проставляет автора записи из контекста, не доверяя значению из тела запроса
+func withUpdatedBy(ctx context.Context, mc models.MetricCollection) models.MetricCollection {
+	updatedBy := identity.NameFromContext(ctx)
+	metrics := make([]models.Metrics, len(mc.Metrics))
+	for i, m := range mc.Metrics {
+		m.UpdatedBy = updatedBy
+		metrics[i] = m
+	}
+
+	return models.MetricCollection{Metrics: metrics}
 }
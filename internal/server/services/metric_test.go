@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -140,3 +141,44 @@ func TestUpsertMetrics(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, mc, upsertedMc)
 }
+
+func TestMetricScopes(t *testing.T) {
+	service := NewMetricService(&mockRepo{})
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{
+		Name:   "dashboard",
+		Role:   identity.RoleReader,
+		Scopes: []string{"test"},
+	})
+
+	_, err := service.GetMetricByName(ctx, "testGauge")
+	assert.NoError(t, err)
+
+	_, err = service.GetMetricByName(ctx, "Alloc")
+	assert.ErrorIs(t, err, ErrMetricForbidden)
+
+	_, err = service.GetMetricValue(ctx, models.GaugeType, "Alloc")
+	assert.ErrorIs(t, err, ErrMetricForbidden)
+
+	assert.ErrorIs(t, service.SetMetric(ctx, models.GaugeType, "Alloc", "1"), ErrMetricForbidden)
+
+	_, err = service.UpsertMetrics(ctx, models.MetricCollection{
+		Metrics: []models.Metrics{
+			{ID: "testGauge", MType: models.GaugeType, Value: f(1)},
+			{ID: "Alloc", MType: models.GaugeType, Value: f(1)},
+		},
+	})
+	assert.ErrorIs(t, err, ErrMetricForbidden)
+}
+
+func TestUpsertMetrics_MaxBatchSize(t *testing.T) {
+	service := NewMetricService(&mockRepo{})
+	service.SetMaxBatchSize(1)
+
+	_, err := service.UpsertMetrics(context.Background(), models.MetricCollection{
+		Metrics: []models.Metrics{
+			{ID: "testGauge", MType: models.GaugeType, Value: f(1)},
+			{ID: "testCounter", MType: models.CounterType, Delta: i(1)},
+		},
+	})
+	assert.ErrorIs(t, err, ErrBatchTooLarge)
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+)
+
+type customLogger interface {
+	Info(string, ...zap.Field)
+}
+
+// HistoryStore хранилище сырой истории метрик и сводок по уровням
+type HistoryStore interface {
+	ExportMetrics(context.Context) ([]models.Metrics, error)
+	History(ctx context.Context, name string, from, to time.Time) ([]models.HistoryPoint, error)
+	SaveRollups(ctx context.Context, step time.Duration, rollups []models.Rollup) error
+	Rollups(ctx context.Context, name string, step time.Duration, from, to time.Time) ([]models.Rollup, error)
+	DeleteRollups(ctx context.Context, step time.Duration, before time.Time) (int, error)
+}
+
+// RollupTier уровень прореживания: сводки по интервалам Step хранятся Retention
+type RollupTier struct {
+	Step      time.Duration
+	Retention time.Duration
+}
+
+// ParseRollupTiers разбирает уровни вида "1m:168h,1h:8760h", шаг и срок хранения
+// в формате time.ParseDuration. Уровни возвращаются от мелкого к крупному
+func ParseRollupTiers(spec string) ([]RollupTier, error) {
+	var tiers []RollupTier
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		stepSpec, retentionSpec, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("rollup tier %q: want step:retention", part)
+		}
+		step, err := time.ParseDuration(stepSpec)
+		if err != nil {
+			return nil, fmt.Errorf("rollup tier %q: %w", part, err)
+		}
+		retention, err := time.ParseDuration(retentionSpec)
+		if err != nil {
+			return nil, fmt.Errorf("rollup tier %q: %w", part, err)
+		}
+		if step < time.Second || step%time.Second != 0 || retention < step {
+			return nil, fmt.Errorf("rollup tier %q: step must be whole seconds and not longer than retention", part)
+		}
+		tiers = append(tiers, RollupTier{Step: step, Retention: retention})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Step < tiers[j].Step
+	})
+	for i := 1; i < len(tiers); i++ {
+		if tiers[i].Step == tiers[i-1].Step {
+			return nil, fmt.Errorf("rollup tier %v: duplicate step", tiers[i].Step)
+		}
+	}
+
+	return tiers, nil
+}
+
+// RollupService сводит сырую историю в уровни прореживания и отвечает на запросы
+// за период, выбирая подходящий уровень
+type RollupService struct {
+	store HistoryStore
+	tiers []RollupTier
+	// raw сколько хранится сырая история
+	raw time.Duration
+	log customLogger
+	now func() time.Time
+	// done по каждому уровню конец последнего сведённого интервала
+	done map[time.Duration]time.Time
+	mu   sync.Mutex
+}
+
+// NewRollupService конструктор, raw срок хранения сырой истории в хранилище
+func NewRollupService(store HistoryStore, tiers []RollupTier, raw time.Duration, log customLogger) *RollupService {
+	return &RollupService{
+		store: store,
+		tiers: tiers,
+		raw:   raw,
+		log:   log,
+		now:   time.Now,
+		done:  make(map[time.Duration]time.Time, len(tiers)),
+	}
+}
+
+// Rollup сводит завершившиеся интервалы каждого уровня и удаляет устаревшие сводки.
+// После перезапуска заново сводится вся доступная сырая история: сводки перезаписываются
+func (rs *RollupService) Rollup(ctx context.Context) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	now := rs.now()
+	metrics, err := rs.store.ExportMetrics(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot list metrics for rollup: %w", err)
+	}
+
+	for _, tier := range rs.tiers {
+		from, ok := rs.done[tier.Step]
+		if !ok {
+			from = now.Add(-rs.raw).Truncate(tier.Step)
+		}
+		to := now.Truncate(tier.Step)
+		if to.After(from) {
+			var rollups []models.Rollup
+			for _, m := range metrics {
+				// интервал раньше from нужен counter как точка отсчёта прироста
+				points, err := rs.store.History(ctx, m.ID, from.Add(-tier.Step), to)
+				if err != nil {
+					return fmt.Errorf("cannot read history of %s: %w", m.ID, err)
+				}
+				rollups = append(rollups, rollupPoints(points, from, tier.Step)...)
+			}
+			if err := rs.store.SaveRollups(ctx, tier.Step, rollups); err != nil {
+				return fmt.Errorf("cannot save %v rollups: %w", tier.Step, err)
+			}
+			rs.done[tier.Step] = to
+		}
+
+		if _, err := rs.store.DeleteRollups(ctx, tier.Step, now.Add(-tier.Retention)); err != nil {
+			return fmt.Errorf("cannot delete %v rollups: %w", tier.Step, err)
+		}
+	}
+
+	return nil
+}
+
+// Run сводит историю сразу и затем раз в шаг самого мелкого уровня до отмены ctx
+func (rs *RollupService) Run(ctx context.Context) {
+	if len(rs.tiers) == 0 {
+		return
+	}
+	ticker := time.NewTicker(rs.tiers[0].Step)
+	defer ticker.Stop()
+
+	for {
+		if err := rs.Rollup(ctx); err != nil {
+			rs.log.Info("cannot roll up history", zap.Error(err))
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Query значения метрики за [from, to) с шагом не мельче step. Берётся самый крупный
+// уровень, шаг которого не больше step и который ещё хранит from, иначе сырая история
+func (rs *RollupService) Query(ctx context.Context, name string, from, to time.Time, step time.Duration) ([]models.Rollup, error) {
+	if !identity.CanAccessFromContext(ctx, name) {
+		return nil, ErrMetricForbidden
+	}
+
+	if tier, ok := rs.pickTier(from, step); ok {
+		rollups, err := rs.store.Rollups(ctx, name, tier.Step, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %v rollups: %w", tier.Step, err)
+		}
+		return rollups, nil
+	}
+
+	points, err := rs.store.History(ctx, name, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history: %w", err)
+	}
+
+	return rawRollups(points), nil
+}
+
+func (rs *RollupService) pickTier(from time.Time, step time.Duration) (RollupTier, bool) {
+	oldest := rs.now()
+	for i := len(rs.tiers) - 1; i >= 0; i-- {
+		tier := rs.tiers[i]
+		if tier.Step <= step && !from.Before(oldest.Add(-tier.Retention)) {
+			return tier, true
+		}
+	}
+
+	return RollupTier{}, false
+}
+
+// rollupPoints сводит упорядоченные по времени точки в интервалы step, начиная с from.
+// Точки до from служат только отсчётом прироста counter. Уменьшение накопленного
+// counter считается сбросом, и прирост берётся от нуля
+func rollupPoints(points []models.HistoryPoint, from time.Time, step time.Duration) []models.Rollup {
+	var rollups []models.Rollup
+	var prev *int64
+	for _, p := range points {
+		m := p.Metric
+		if m.MType != models.CounterType {
+			prev = nil
+		}
+		if p.Time.Before(from) {
+			if m.MType == models.CounterType && m.Delta != nil {
+				prev = copyInt(*m.Delta)
+			}
+			continue
+		}
+
+		start := p.Time.Truncate(step)
+		last := len(rollups) - 1
+		if last < 0 || !rollups[last].Start.Equal(start) {
+			rollups = append(rollups, models.Rollup{Start: start, Step: step, ID: m.ID, MType: m.MType})
+			last++
+		} else if rollups[last].MType != m.MType {
+			// тип метрики сменился внутри интервала: учитываются значения после смены
+			rollups[last] = models.Rollup{Start: start, Step: step, ID: m.ID, MType: m.MType}
+		}
+
+		r := &rollups[last]
+		r.Count++
+		switch {
+		case m.MType == models.CounterType && m.Delta != nil:
+			if prev != nil {
+				r.Delta += increase(*prev, *m.Delta)
+			}
+			prev = copyInt(*m.Delta)
+		case m.MType == models.GaugeType && m.Value != nil:
+			addGauge(r, *m.Value)
+		}
+	}
+
+	for i := range rollups {
+		if rollups[i].MType == models.CounterType {
+			rollups[i].Rate = float64(rollups[i].Delta) / step.Seconds()
+		}
+	}
+
+	return rollups
+}
+
+// rawRollups сырые точки в виде сводок по одному значению. Прирост counter считается
+// от предыдущей точки, скорость по времени между ними
+func rawRollups(points []models.HistoryPoint) []models.Rollup {
+	rollups := make([]models.Rollup, 0, len(points))
+	var prev *models.HistoryPoint
+	for i, p := range points {
+		m := p.Metric
+		r := models.Rollup{Start: p.Time, ID: m.ID, MType: m.MType, Count: 1}
+		switch {
+		case m.MType == models.CounterType && m.Delta != nil:
+			if prev != nil && prev.Metric.MType == models.CounterType && prev.Metric.Delta != nil {
+				r.Delta = increase(*prev.Metric.Delta, *m.Delta)
+				if dt := p.Time.Sub(prev.Time).Seconds(); dt > 0 {
+					r.Rate = float64(r.Delta) / dt
+				}
+			}
+		case m.MType == models.GaugeType && m.Value != nil:
+			addGauge(&r, *m.Value)
+		}
+		rollups = append(rollups, r)
+		prev = &points[i]
+	}
+
+	return rollups
+}
+
+func addGauge(r *models.Rollup, v float64) {
+	if r.Count == 1 {
+		r.Min, r.Max, r.Avg = v, v, v
+		return
+	}
+	r.Min = min(r.Min, v)
+	r.Max = max(r.Max, v)
+	r.Avg += (v - r.Avg) / float64(r.Count)
+}
+
+func increase(prev, cur int64) int64 {
+	if cur < prev {
+		return cur
+	}
+
+	return cur - prev
+}
+
+func copyInt(v int64) *int64 {
+	return &v
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+)
+
+type historyStoreMock struct {
+	points  map[string][]models.HistoryPoint
+	rollups map[time.Duration][]models.Rollup
+	deleted map[time.Duration]time.Time
+	queried time.Duration
+}
+
+func newHistoryStoreMock() *historyStoreMock {
+	return &historyStoreMock{
+		points:  map[string][]models.HistoryPoint{},
+		rollups: map[time.Duration][]models.Rollup{},
+		deleted: map[time.Duration]time.Time{},
+	}
+}
+
+func (hs *historyStoreMock) ExportMetrics(context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	for name := range hs.points {
+		metrics = append(metrics, models.Metrics{ID: name})
+	}
+	return metrics, nil
+}
+
+func (hs *historyStoreMock) History(_ context.Context, name string, from, to time.Time) ([]models.HistoryPoint, error) {
+	var points []models.HistoryPoint
+	for _, p := range hs.points[name] {
+		if !p.Time.Before(from) && p.Time.Before(to) {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+func (hs *historyStoreMock) SaveRollups(_ context.Context, step time.Duration, rollups []models.Rollup) error {
+	hs.rollups[step] = append(hs.rollups[step], rollups...)
+	return nil
+}
+
+func (hs *historyStoreMock) Rollups(_ context.Context, _ string, step time.Duration, _, _ time.Time) ([]models.Rollup, error) {
+	hs.queried = step
+	return hs.rollups[step], nil
+}
+
+func (hs *historyStoreMock) DeleteRollups(_ context.Context, step time.Duration, before time.Time) (int, error) {
+	hs.deleted[step] = before
+	return 0, nil
+}
+
+func gaugePoint(at time.Time, v float64) models.HistoryPoint {
+	return models.HistoryPoint{Time: at, Metric: models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: f(v)}}
+}
+
+func counterPoint(at time.Time, v int64) models.HistoryPoint {
+	return models.HistoryPoint{Time: at, Metric: models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: i(v)}}
+}
+
+func TestParseRollupTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []RollupTier
+		wantErr bool
+	}{
+		{
+			name: "уровни сортируются по шагу",
+			spec: "1h:8760h, 1m:168h",
+			want: []RollupTier{{Step: time.Minute, Retention: 168 * time.Hour}, {Step: time.Hour, Retention: 8760 * time.Hour}},
+		},
+		{name: "пусто", spec: "", want: nil},
+		{name: "нет срока хранения", spec: "1m", wantErr: true},
+		{name: "шаг дольше срока", spec: "1h:1m", wantErr: true},
+		{name: "шаг не в целых секундах", spec: "1500ms:1h", wantErr: true},
+		{name: "повтор шага", spec: "1m:1h,60s:2h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRollupTiers(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRollupPoints(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	step := time.Minute
+
+	gauges := rollupPoints([]models.HistoryPoint{
+		gaugePoint(base.Add(-30*time.Second), 100),
+		gaugePoint(base.Add(10*time.Second), 1),
+		gaugePoint(base.Add(20*time.Second), 5),
+		gaugePoint(base.Add(30*time.Second), 3),
+		gaugePoint(base.Add(70*time.Second), 7),
+	}, base, step)
+	require.Len(t, gauges, 2)
+	assert.Equal(t, models.Rollup{Start: base, Step: step, ID: "Alloc", MType: models.GaugeType, Count: 3, Min: 1, Max: 5, Avg: 3}, gauges[0])
+	assert.Equal(t, int64(1), gauges[1].Count)
+	assert.Equal(t, 7.0, gauges[1].Avg)
+
+	counters := rollupPoints([]models.HistoryPoint{
+		counterPoint(base.Add(-10*time.Second), 10),
+		counterPoint(base.Add(10*time.Second), 40),
+		counterPoint(base.Add(50*time.Second), 70),
+		counterPoint(base.Add(80*time.Second), 5),
+	}, base, step)
+	require.Len(t, counters, 2)
+	assert.Equal(t, int64(60), counters[0].Delta, "прирост от точки до начала интервала")
+	assert.Equal(t, 1.0, counters[0].Rate)
+	assert.Equal(t, int64(5), counters[1].Delta, "сброс counter считается от нуля")
+}
+
+func TestRollupService_Rollup(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	store := newHistoryStoreMock()
+	store.points["Alloc"] = []models.HistoryPoint{
+		gaugePoint(now.Add(-3*time.Minute), 1),
+		gaugePoint(now.Add(-2*time.Minute), 2),
+		gaugePoint(now.Add(-10*time.Second), 9),
+	}
+	tiers := []RollupTier{{Step: time.Minute, Retention: time.Hour}, {Step: time.Hour, Retention: 24 * time.Hour}}
+	rs := NewRollupService(store, tiers, 24*time.Hour, zap.NewNop())
+	rs.now = func() time.Time { return now }
+
+	require.NoError(t, rs.Rollup(context.Background()))
+	assert.Len(t, store.rollups[time.Minute], 2, "незавершённый интервал не сводится")
+	assert.Len(t, store.rollups[time.Hour], 1)
+	assert.Equal(t, now.Add(-time.Hour), store.deleted[time.Minute])
+
+	rs.now = func() time.Time { return now.Add(time.Minute) }
+	require.NoError(t, rs.Rollup(context.Background()))
+	assert.Len(t, store.rollups[time.Minute], 3, "сводится только новый интервал")
+	assert.Equal(t, 9.0, store.rollups[time.Minute][2].Avg)
+}
+
+func TestRollupService_Query(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tiers := []RollupTier{{Step: time.Minute, Retention: 7 * 24 * time.Hour}, {Step: time.Hour, Retention: 365 * 24 * time.Hour}}
+	tests := []struct {
+		name     string
+		from     time.Time
+		step     time.Duration
+		wantTier time.Duration
+	}{
+		{name: "крупный шаг берёт часовой уровень", from: now.Add(-time.Hour), step: 6 * time.Hour, wantTier: time.Hour},
+		{name: "шаг меньше часа берёт минутный уровень", from: now.Add(-time.Hour), step: 5 * time.Minute, wantTier: time.Minute},
+		{name: "минутный уровень уже не хранит from", from: now.Add(-30 * 24 * time.Hour), step: 5 * time.Minute, wantTier: 0},
+		{name: "шаг мельче уровней берёт сырые значения", from: now.Add(-time.Hour), step: 10 * time.Second, wantTier: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newHistoryStoreMock()
+			store.points["Alloc"] = []models.HistoryPoint{gaugePoint(now.Add(-time.Minute), 1)}
+			rs := NewRollupService(store, tiers, 24*time.Hour, zap.NewNop())
+			rs.now = func() time.Time { return now }
+
+			got, err := rs.Query(context.Background(), "Alloc", tt.from, now, tt.step)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTier, store.queried)
+			if tt.wantTier == 0 {
+				require.Len(t, got, 1)
+				assert.Equal(t, 1.0, got[0].Avg)
+			}
+		})
+	}
+}
@@ -0,0 +1,609 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+)
+
+// BoltCompactInterval как часто удаляется устаревшая история и сжимается файл базы
+const BoltCompactInterval = time.Hour
+
+var (
+	// latestBucket последнее значение каждой метрики, ключ имя метрики
+	latestBucket = []byte("latest")
+	// historyBucket значения по интервалам времени, ключ имя метрики, ноль и начало интервала
+	historyBucket = []byte("history")
+	// rollupsBucket сводки истории, ключ шаг в секундах, имя метрики, ноль и начало интервала
+	rollupsBucket = []byte("rollups")
+	// updatedBucket время последней записи метрики в наносекундах, ключ имя метрики
+	updatedBucket = []byte("updated")
+)
+
+// ErrBoltClosed база уже закрыта
+var ErrBoltClosed = errors.New("kv storage is closed")
+
+// BoltStorage хранилище во встроенной базе ключ-значение bbolt без SQL.
+// Пачка метрик записывается одной транзакцией; если задан интервал истории,
+// рядом сохраняется последнее значение метрики в каждом интервале
+type BoltStorage struct {
+	db   *bolt.DB
+	log  customLogger
+	now  func() time.Time
+	path string
+	// history ширина интервала истории, 0 история не ведётся
+	history time.Duration
+	// mu защищает db, пока Compact пересоздаёт файл базы
+	mu sync.RWMutex
+}
+
+// NewBoltStorage открывает или создаёт файл базы path
+func NewBoltStorage(path string, log customLogger, history time.Duration) (*BoltStorage, error) {
+	bs := &BoltStorage{
+		log:     log,
+		now:     time.Now,
+		path:    path,
+		history: history,
+	}
+	if err := bs.open(); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func (bs *BoltStorage) open() error {
+	db, err := bolt.Open(bs.path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("cannot open kv storage: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{latestBucket, historyBucket, rollupsBucket, updatedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// метрики, записанные до появления времени записи, считаются обновлёнными при открытии
+		updated, now := tx.Bucket(updatedBucket), encodeTime(bs.now())
+		return tx.Bucket(latestBucket).ForEach(func(k, _ []byte) error {
+			if updated.Get(k) != nil {
+				return nil
+			}
+			return updated.Put(k, now)
+		})
+	})
+	if err != nil {
+		return errors.Join(fmt.Errorf("cannot create kv buckets: %w", err), db.Close())
+	}
+	bs.db = db
+
+	return nil
+}
+
+func (bs *BoltStorage) view(fn func(tx *bolt.Tx) error) error {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	if bs.db == nil {
+		return ErrBoltClosed
+	}
+
+	return bs.db.View(fn)
+}
+
+func (bs *BoltStorage) update(fn func(tx *bolt.Tx) error) error {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	if bs.db == nil {
+		return ErrBoltClosed
+	}
+
+	return bs.db.Update(fn)
+}
+
+// SetMetric записывает метрику, автором считается m.UpdatedBy, а если он пуст, клиент из контекста
+func (bs *BoltStorage) SetMetric(ctx context.Context, m models.Metrics) error {
+	_, err := bs.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{m}})
+
+	return err
+}
+
+func (bs *BoltStorage) SetGaugeMetric(ctx context.Context, name string, value models.Gauge) error {
+	return bs.SetMetric(ctx, models.Metrics{ID: name, MType: models.GaugeType, Value: (*float64)(&value)})
+}
+
+func (bs *BoltStorage) SetCounterMetric(ctx context.Context, name string, value models.Counter) error {
+	return bs.SetMetric(ctx, models.Metrics{ID: name, MType: models.CounterType, Delta: (*int64)(&value)})
+}
+
+// UpsertMetrics записывает пачку одной транзакцией: counter прибавляется к накопленному,
+// gauge заменяется. Повторы сводятся, как в DBStorage, и возвращаются накопленные значения
+// по одной метрике в порядке первого появления
+func (bs *BoltStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
+	batch := make([]models.Metrics, 0, len(metricCollection.Metrics))
+	for _, m := range metricCollection.Metrics {
+		if err := validateMetric(m); err != nil {
+			return *models.NewMetricCollection(), err
+		}
+		m.UpdatedBy = updatedBy(ctx, m)
+		batch = append(batch, m)
+	}
+	aggregated := aggregateMetrics(batch)
+
+	now := bs.now()
+	var bucketStart time.Time
+	if bs.history > 0 {
+		bucketStart = now.Truncate(bs.history)
+	}
+
+	upserted := make([]models.Metrics, 0, len(aggregated))
+	err := bs.update(func(tx *bolt.Tx) error {
+		latest := tx.Bucket(latestBucket)
+		for _, m := range aggregated {
+			if m.MType == models.CounterType {
+				prev, ok, err := decodeMetric(latest.Get([]byte(m.ID)))
+				if err != nil {
+					return err
+				}
+				delta := *m.Delta
+				if ok && prev.Delta != nil {
+					delta += *prev.Delta
+				}
+				m.Delta, m.Value = &delta, nil
+			} else {
+				value := *m.Value
+				m.Delta, m.Value = nil, &value
+			}
+
+			data, err := json.Marshal(&m)
+			if err != nil {
+				return fmt.Errorf("cannot encode metric %s: %w", m.ID, err)
+			}
+			if err := latest.Put([]byte(m.ID), data); err != nil {
+				return err
+			}
+			if err := tx.Bucket(updatedBucket).Put([]byte(m.ID), encodeTime(now)); err != nil {
+				return err
+			}
+			if bs.history > 0 {
+				if err := tx.Bucket(historyBucket).Put(historyKey(m.ID, bucketStart), data); err != nil {
+					return err
+				}
+			}
+			upserted = append(upserted, m)
+		}
+		return nil
+	})
+	if err != nil {
+		bs.log.Info("cannot UpsertMetrics", zap.Error(err))
+		return *models.NewMetricCollection(), err
+	}
+
+	return models.MetricCollection{Metrics: upserted}, nil
+}
+
+func (bs *BoltStorage) GetMetric(_ context.Context, name string) (models.Metrics, error) {
+	var metric models.Metrics
+	err := bs.view(func(tx *bolt.Tx) error {
+		m, ok, err := decodeMetric(tx.Bucket(latestBucket).Get([]byte(name)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%s metric not found", name)
+		}
+		metric = m
+		return nil
+	})
+
+	return metric, err
+}
+
+func (bs *BoltStorage) GetGaugeMetric(ctx context.Context, name string) (models.Gauge, error) {
+	metric, err := bs.GetMetric(ctx, name)
+	if err != nil || metric.Value == nil {
+		return 0, fmt.Errorf("gauge metric %s not found", name)
+	}
+
+	return models.Gauge(*metric.Value), nil
+}
+
+func (bs *BoltStorage) GetCounterMetric(ctx context.Context, name string) (models.Counter, error) {
+	metric, err := bs.GetMetric(ctx, name)
+	if err != nil || metric.Delta == nil {
+		return 0, fmt.Errorf("counter metric %s not found", name)
+	}
+
+	return models.Counter(*metric.Delta), nil
+}
+
+func (bs *BoltStorage) GetAllMetrics(ctx context.Context) []string {
+	var metricStrings []string
+
+	metrics, err := bs.ExportMetrics(ctx)
+	if err != nil {
+		bs.log.Info("cannot get all metric", zap.Error(err))
+		return metricStrings
+	}
+
+	for _, m := range metrics {
+		if m.Delta != nil {
+			metricStrings = append(metricStrings, fmt.Sprintf("%v: %v", m.ID, *m.Delta))
+		} else {
+			metricStrings = append(metricStrings, fmt.Sprintf("%v: %v", m.ID, *m.Value))
+		}
+	}
+
+	return metricStrings
+}
+
+// GetIsDBConnected сообщает, открыт ли файл базы
+func (bs *BoltStorage) GetIsDBConnected() bool {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+
+	return bs.db != nil
+}
+
+// ExportMetrics выгружает все метрики для снимка в порядке имён
+func (bs *BoltStorage) ExportMetrics(context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	err := bs.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(latestBucket).ForEach(func(_, v []byte) error {
+			m, _, err := decodeMetric(v)
+			if err != nil {
+				return err
+			}
+			metrics = append(metrics, m)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot export metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// ImportMetrics заменяет значения метрик значениями из снимка одной транзакцией,
+// counter не суммируется с текущим, история не пишется
+func (bs *BoltStorage) ImportMetrics(_ context.Context, metrics []models.Metrics) error {
+	for _, m := range metrics {
+		if err := validateMetric(m); err != nil {
+			return err
+		}
+	}
+
+	// в снимке нет времени записи, восстановленные метрики считаются обновлёнными сейчас
+	now := encodeTime(bs.now())
+	return bs.update(func(tx *bolt.Tx) error {
+		latest := tx.Bucket(latestBucket)
+		for _, m := range metrics {
+			data, err := json.Marshal(&m)
+			if err != nil {
+				return fmt.Errorf("cannot encode metric %s: %w", m.ID, err)
+			}
+			if err := latest.Put([]byte(m.ID), data); err != nil {
+				return fmt.Errorf("cannot import metric %s: %w", m.ID, err)
+			}
+			if err := tx.Bucket(updatedBucket).Put([]byte(m.ID), now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// LastUpdated время последней записи каждой метрики
+func (bs *BoltStorage) LastUpdated(context.Context) (map[string]time.Time, error) {
+	updated := make(map[string]time.Time)
+	err := bs.view(func(tx *bolt.Tx) error {
+		return tx.Bucket(latestBucket).ForEach(func(k, _ []byte) error {
+			updated[string(k)] = decodeTime(tx.Bucket(updatedBucket).Get(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read last updated: %w", err)
+	}
+
+	return updated, nil
+}
+
+// ExpireMetrics удаляет из names метрики, не обновлявшиеся с before, и возвращает удалённые.
+// История удалённых метрик остаётся до сжатия базы
+func (bs *BoltStorage) ExpireMetrics(_ context.Context, names []string, before time.Time) ([]string, error) {
+	var expired []string
+	err := bs.update(func(tx *bolt.Tx) error {
+		latest, updated := tx.Bucket(latestBucket), tx.Bucket(updatedBucket)
+		for _, name := range names {
+			key := []byte(name)
+			if latest.Get(key) == nil || !decodeTime(updated.Get(key)).Before(before) {
+				continue
+			}
+			if err := latest.Delete(key); err != nil {
+				return err
+			}
+			if err := updated.Delete(key); err != nil {
+				return err
+			}
+			expired = append(expired, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot expire kv metrics: %w", err)
+	}
+
+	return expired, nil
+}
+
+// History возвращает историю метрики name за интервалы, начинающиеся в [from, to),
+// перебирая ключи истории с префиксом имени метрики
+func (bs *BoltStorage) History(_ context.Context, name string, from, to time.Time) ([]models.HistoryPoint, error) {
+	var points []models.HistoryPoint
+	err := bs.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		prefix := historyPrefix(name)
+		for k, v := c.Seek(historyKey(name, from)); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			start := historyTime(k)
+			if !start.Before(to) {
+				break
+			}
+			m, _, err := decodeMetric(v)
+			if err != nil {
+				return err
+			}
+			points = append(points, models.HistoryPoint{Time: start, Metric: m})
+		}
+		return nil
+	})
+
+	return points, err
+}
+
+// SaveRollups записывает сводки уровня step, сводки за те же интервалы заменяются
+func (bs *BoltStorage) SaveRollups(_ context.Context, step time.Duration, rollups []models.Rollup) error {
+	err := bs.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(rollupsBucket)
+		for _, r := range rollups {
+			data, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(rollupKey(step, r.ID, r.Start), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("cannot save kv rollups: %w", err)
+	}
+
+	return nil
+}
+
+// Rollups сводки уровня step по интервалам, начавшимся в [from, to)
+func (bs *BoltStorage) Rollups(_ context.Context, name string, step time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	var rollups []models.Rollup
+	err := bs.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(rollupsBucket).Cursor()
+		prefix := rollupPrefix(step, name)
+		for k, v := c.Seek(rollupKey(step, name, from)); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if !historyTime(k).Before(to) {
+				break
+			}
+			var r models.Rollup
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("cannot decode rollup: %w", err)
+			}
+			r.Step = step
+			rollups = append(rollups, r)
+		}
+		return nil
+	})
+
+	return rollups, err
+}
+
+// DeleteRollups удаляет сводки уровня step по интервалам, начавшимся до before
+func (bs *BoltStorage) DeleteRollups(_ context.Context, step time.Duration, before time.Time) (int, error) {
+	removed := 0
+	err := bs.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(rollupsBucket)
+		c := bucket.Cursor()
+		prefix := rollupStepPrefix(step)
+		var expired [][]byte
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if historyTime(k).Before(before) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("cannot remove kv rollups: %w", err)
+	}
+
+	return removed, nil
+}
+
+// Compact удаляет историю старше before и, если больше половины файла базы занято
+// освободившимися страницами, переписывает базу в новый файл. Возвращает число удалённых записей
+func (bs *BoltStorage) Compact(before time.Time) (int, error) {
+	removed := 0
+	err := bs.update(func(tx *bolt.Tx) error {
+		history := tx.Bucket(historyBucket)
+		// ключи собираются заранее: удаление во время обхода сдвигает курсор
+		var expired [][]byte
+		err := history.ForEach(func(k, _ []byte) error {
+			if historyTime(k).Before(before) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := history.Delete(k); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("cannot remove kv history: %w", err)
+	}
+
+	return removed, bs.shrink()
+}
+
+// shrink переписывает базу в новый файл, если в старом слишком много свободных страниц.
+// На время переписывания запросы к хранилищу ждут
+func (bs *BoltStorage) shrink() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.db == nil {
+		return ErrBoltClosed
+	}
+	stats := bs.db.Stats()
+	info, err := os.Stat(bs.path)
+	if err != nil {
+		return err
+	}
+	free := int64(stats.FreePageN+stats.PendingPageN) * int64(bs.db.Info().PageSize)
+	if free*2 < info.Size() {
+		return nil
+	}
+
+	tmp := bs.path + ".compact"
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("cannot open compacted kv storage: %w", err)
+	}
+	if err := bolt.Compact(dst, bs.db, 0); err != nil {
+		return errors.Join(fmt.Errorf("cannot compact kv storage: %w", err), dst.Close(), os.Remove(tmp))
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+	if err := bs.db.Close(); err != nil {
+		return err
+	}
+	bs.db = nil
+	if err := os.Rename(tmp, bs.path); err != nil {
+		return errors.Join(fmt.Errorf("cannot replace kv storage: %w", err), bs.open())
+	}
+
+	return bs.open()
+}
+
+// Run раз в BoltCompactInterval удаляет историю старше retention и сжимает базу
+func (bs *BoltStorage) Run(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(BoltCompactInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			removed, err := bs.Compact(bs.now().Add(-retention))
+			if err != nil {
+				bs.log.Info("cannot compact kv storage", zap.Error(err))
+				continue
+			}
+			bs.log.Info("kv storage compacted", zap.Int("removed", removed))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close закрывает файл базы
+func (bs *BoltStorage) Close() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.db == nil {
+		return nil
+	}
+	err := bs.db.Close()
+	bs.db = nil
+
+	return err
+}
+
+func decodeMetric(data []byte) (models.Metrics, bool, error) {
+	if data == nil {
+		return models.Metrics{}, false, nil
+	}
+
+	var m models.Metrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		return models.Metrics{}, false, fmt.Errorf("cannot decode metric: %w", err)
+	}
+
+	return m, true, nil
+}
+
+func encodeTime(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+func decodeTime(data []byte) time.Time {
+	if len(data) != 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+}
+
+func historyPrefix(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+func historyKey(name string, start time.Time) []byte {
+	return binary.BigEndian.AppendUint64(historyPrefix(name), uint64(max(start.Unix(), 0)))
+}
+
+func rollupStepPrefix(step time.Duration) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(step/time.Second))
+}
+
+func rollupPrefix(step time.Duration, name string) []byte {
+	return append(rollupStepPrefix(step), historyPrefix(name)...)
+}
+
+func rollupKey(step time.Duration, name string, start time.Time) []byte {
+	return binary.BigEndian.AppendUint64(rollupPrefix(step, name), uint64(max(start.Unix(), 0)))
+}
+
+func historyTime(key []byte) time.Time {
+	if len(key) < 8 {
+		return time.Time{}
+	}
+
+	return time.Unix(int64(binary.BigEndian.Uint64(key[len(key)-8:])), 0)
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openBolt(t *testing.T, path string, history time.Duration) *BoltStorage {
+	t.Helper()
+
+	bs, err := NewBoltStorage(path, testLogger{}, history)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = bs.Close()
+	})
+
+	return bs
+}
+
+func TestBoltStorage_UpsertMetrics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.bolt")
+	ctx := context.Background()
+	bs := openBolt(t, path, 0)
+
+	upserted, err := bs.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(5))},
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.5)},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(5))},
+	}})
+	require.NoError(t, err)
+	require.Len(t, upserted.Metrics, 2, "по одному значению на метрику")
+	assert.Equal(t, int64(10), *upserted.Metrics[0].Delta, "counter в пачке накапливается")
+
+	_, err = bs.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+		{ID: "Broken", MType: models.GaugeType},
+	}})
+	assert.Error(t, err, "пачка с некорректной метрикой отклоняется целиком")
+
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 1))
+	require.NoError(t, bs.SetGaugeMetric(ctx, "Alloc", 2.5))
+	require.NoError(t, bs.Close())
+
+	reopened := openBolt(t, path, 0)
+	tests := []struct {
+		name string
+		id   string
+		want models.Metrics
+	}{
+		{
+			name: "counter прибавляется к накопленному",
+			id:   "PollCount",
+			want: models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(11))},
+		},
+		{
+			name: "gauge заменяется",
+			id:   "Alloc",
+			want: models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: ptr(2.5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reopened.GetMetric(ctx, tt.id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = reopened.GetMetric(ctx, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"Alloc: 2.5", "PollCount: 11"}, reopened.GetAllMetrics(ctx))
+}
+
+func TestBoltStorage_History(t *testing.T) {
+	ctx := context.Background()
+	bs := openBolt(t, filepath.Join(t.TempDir(), "metrics.bolt"), time.Minute)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, value := range []float64{1, 2, 3} {
+		bs.now = func() time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		require.NoError(t, bs.SetGaugeMetric(ctx, "Alloc", models.Gauge(value)))
+		// соседняя метрика с общим префиксом имени не попадает в историю Alloc
+		require.NoError(t, bs.SetGaugeMetric(ctx, "AllocBytes", models.Gauge(value)))
+	}
+	bs.now = func() time.Time { return start.Add(2*time.Minute + 30*time.Second) }
+	require.NoError(t, bs.SetGaugeMetric(ctx, "Alloc", 4))
+
+	points, err := bs.History(ctx, "Alloc", time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, 4.0, *points[2].Metric.Value, "в интервале хранится последнее значение")
+	assert.True(t, start.Add(2*time.Minute).Equal(points[2].Time))
+
+	removed, err := bs.Compact(start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "удаляется первый интервал обеих метрик")
+
+	points, err = bs.History(ctx, "Alloc", time.Time{}, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, 2.0, *points[0].Metric.Value)
+
+	value, err := bs.GetGaugeMetric(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, models.Gauge(4), value, "сжатие не трогает последние значения")
+}
+
+func TestBoltStorage_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	bs := openBolt(t, filepath.Join(t.TempDir(), "metrics.bolt"), 0)
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 3))
+
+	require.NoError(t, bs.ImportMetrics(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(7.0), UpdatedBy: "agent-1"},
+	}))
+
+	metrics, err := bs.ExportMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(7.0), UpdatedBy: "agent-1"},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+	}, metrics, "импорт заменяет counter, а не суммирует")
+}
+
+func TestBoltStorage_CompactShrinksFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.bolt")
+	bs := openBolt(t, path, time.Second)
+	// fsync каждой из тысяч транзакций здесь не нужен
+	bs.db.NoSync = true
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 2000; i++ {
+		bs.now = func() time.Time { return start.Add(time.Duration(i) * time.Second) }
+		require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 1))
+	}
+	before, err := os.Stat(path)
+	require.NoError(t, err)
+
+	removed, err := bs.Compact(start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2000, removed)
+
+	after, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size(), "файл базы переписан без свободных страниц")
+
+	counter, err := bs.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(2000), counter)
+}
+
+func TestBoltStorage_Rollups(t *testing.T) {
+	bs := openBolt(t, filepath.Join(t.TempDir(), "metrics.db"), 0)
+	ctx := context.Background()
+	base := time.Unix(1700000000, 0).Truncate(time.Minute)
+
+	require.NoError(t, bs.SaveRollups(ctx, time.Minute, []models.Rollup{
+		{Start: base, Step: time.Minute, ID: "Alloc", MType: models.GaugeType, Count: 2, Min: 1, Max: 3, Avg: 2},
+		{Start: base.Add(time.Minute), Step: time.Minute, ID: "Alloc", MType: models.GaugeType, Count: 1, Min: 4, Max: 4, Avg: 4},
+		{Start: base, Step: time.Minute, ID: "PollCount", MType: models.CounterType, Count: 3, Delta: 60, Rate: 1},
+	}))
+	require.NoError(t, bs.SaveRollups(ctx, time.Hour, []models.Rollup{
+		{Start: base.Truncate(time.Hour), Step: time.Hour, ID: "Alloc", MType: models.GaugeType, Count: 3},
+	}))
+	require.NoError(t, bs.SaveRollups(ctx, time.Minute, []models.Rollup{
+		{Start: base, Step: time.Minute, ID: "Alloc", MType: models.GaugeType, Count: 5, Min: 1, Max: 3, Avg: 2},
+	}), "сводка за тот же интервал заменяется")
+
+	rollups, err := bs.Rollups(ctx, "Alloc", time.Minute, base, base.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rollups, 2)
+	assert.Equal(t, int64(5), rollups[0].Count)
+	assert.True(t, base.Equal(rollups[0].Start))
+	assert.Equal(t, 4.0, rollups[1].Avg)
+
+	removed, err := bs.DeleteRollups(ctx, time.Minute, base.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "удаляются сводки только этого уровня")
+
+	rollups, err = bs.Rollups(ctx, "Alloc", time.Hour, base.Truncate(time.Hour), base.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, rollups, 1)
+}
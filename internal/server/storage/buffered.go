@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/db"
+)
+
+// bufferedBackend хранилище в базе, запись в которое буферизуется
+type bufferedBackend interface {
+	SetMetric(context.Context, models.Metrics) error
+	GetMetric(context.Context, string) (models.Metrics, error)
+	SetGaugeMetric(context.Context, string, models.Gauge) error
+	SetCounterMetric(context.Context, string, models.Counter) error
+	GetGaugeMetric(context.Context, string) (models.Gauge, error)
+	GetCounterMetric(context.Context, string) (models.Counter, error)
+	GetAllMetrics(context.Context) []string
+	GetIsDBConnected() bool
+	UpsertMetrics(context.Context, models.MetricCollection) (models.MetricCollection, error)
+	ExportMetrics(context.Context) ([]models.Metrics, error)
+	ImportMetrics(context.Context, []models.Metrics) error
+}
+
+type dbHealth interface {
+	Healthy() bool
+	MarkDown(error)
+}
+
+// BufferedStorage пишет в базу, а пока база недоступна, копит записи в памяти:
+// counter суммируются, у gauge остаётся последнее значение. После восстановления
+// базы Run дописывает накопленное. Чтение всегда идёт в базу
+type BufferedStorage struct {
+	bufferedBackend
+	health  dbHealth
+	log     customLogger
+	pending []models.Metrics
+	mu      sync.Mutex
+	// flushing накопленное уже отправлено в базу, новые записи ждут в буфере,
+	// чтобы не обогнать его
+	flushing bool
+}
+
+func NewBufferedStorage(backend bufferedBackend, health dbHealth, log customLogger) *BufferedStorage {
+	return &BufferedStorage{
+		bufferedBackend: backend,
+		health:          health,
+		log:             log,
+	}
+}
+
+// SetMetric записывает метрику, автором считается m.UpdatedBy, а если он пуст, клиент из контекста
+func (bs *BufferedStorage) SetMetric(ctx context.Context, m models.Metrics) error {
+	_, err := bs.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{m}})
+
+	return err
+}
+
+func (bs *BufferedStorage) SetGaugeMetric(ctx context.Context, name string, value models.Gauge) error {
+	return bs.SetMetric(ctx, models.Metrics{ID: name, MType: models.GaugeType, Value: (*float64)(&value)})
+}
+
+func (bs *BufferedStorage) SetCounterMetric(ctx context.Context, name string, value models.Counter) error {
+	return bs.SetMetric(ctx, models.Metrics{ID: name, MType: models.CounterType, Delta: (*int64)(&value)})
+}
+
+// UpsertMetrics пишет пачку в базу, если она доступна и буфер пуст, иначе в буфер.
+// Для пачки из буфера возвращаются принятые метрики, сведённые по одной на метрику
+// так же, как в DBStorage: накопленных значений без базы не узнать
+func (bs *BufferedStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
+	for _, m := range metricCollection.Metrics {
+		if err := validateMetric(m); err != nil {
+			return *models.NewMetricCollection(), err
+		}
+	}
+
+	bs.mu.Lock()
+	direct := bs.health.Healthy() && len(bs.pending) == 0 && !bs.flushing
+	bs.mu.Unlock()
+
+	if direct {
+		upserted, err := bs.bufferedBackend.UpsertMetrics(ctx, metricCollection)
+		if !unavailable(err) || ctx.Err() != nil {
+			return upserted, err
+		}
+		bs.health.MarkDown(err)
+		// COMMIT мог примениться до обрыва: повтор из буфера сложил бы counter дважды
+		if db.IsCommitError(err) {
+			return upserted, err
+		}
+	}
+
+	bs.buffer(ctx, metricCollection.Metrics)
+
+	return models.MetricCollection{Metrics: aggregateMetrics(metricCollection.Metrics)}, nil
+}
+
+// unavailable ошибка из-за недоступности базы. Истёкший таймаут говорит о медленном
+// запросе, а не о недоступной базе, и отдаётся клиенту
+func unavailable(err error) bool {
+	return db.IsConnectionError(err) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (bs *BufferedStorage) buffer(ctx context.Context, metrics []models.Metrics) {
+	batch := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		m.UpdatedBy = updatedBy(ctx, m)
+		batch = append(batch, m)
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.pending = aggregateMetrics(append(bs.pending, batch...))
+}
+
+// GetIsDBConnected результат последней проверки базы, без запроса к ней
+func (bs *BufferedStorage) GetIsDBConnected() bool {
+	return bs.health.Healthy()
+}
+
+// Pending сколько метрик ждёт записи в базу
+func (bs *BufferedStorage) Pending() int {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	return len(bs.pending)
+}
+
+// Flush дописывает накопленные метрики в базу, пока буфер не опустеет.
+// Если база снова недоступна, метрики возвращаются в буфер перед более новыми.
+// Пачка с любой другой ошибкой отбрасывается: повторять её бесполезно, а пока она
+// в буфере, все новые записи тоже идут в буфер. Ошибка COMMIT тоже не повторяется,
+// пачка могла уже примениться
+func (bs *BufferedStorage) Flush(ctx context.Context) error {
+	for {
+		bs.mu.Lock()
+		if bs.flushing || len(bs.pending) == 0 {
+			bs.mu.Unlock()
+			return nil
+		}
+		batch := bs.pending
+		bs.pending = nil
+		bs.flushing = true
+		bs.mu.Unlock()
+
+		_, err := bs.bufferedBackend.UpsertMetrics(ctx, models.MetricCollection{Metrics: batch})
+
+		requeue := db.IsConnectionError(err) && !db.IsCommitError(err)
+		bs.mu.Lock()
+		bs.flushing = false
+		if requeue {
+			bs.pending = aggregateMetrics(append(batch, bs.pending...))
+		}
+		bs.mu.Unlock()
+
+		if err != nil {
+			if unavailable(err) {
+				bs.health.MarkDown(err)
+			}
+			if !requeue {
+				bs.log.Info("buffered metrics dropped", zap.Int("metrics", len(batch)), zap.Error(err))
+			}
+			return err
+		}
+		bs.log.Info("buffered metrics written to database", zap.Int("metrics", len(batch)))
+	}
+}
+
+// Run раз в interval дописывает буфер в базу, если она снова доступна
+func (bs *BufferedStorage) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !bs.health.Healthy() {
+				continue
+			}
+			if err := bs.Flush(ctx); err != nil {
+				bs.log.Info("cannot write buffered metrics", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingBackend MemStorage, запись в который падает с заданной ошибкой
+type failingBackend struct {
+	*MemStorage
+	err error
+}
+
+func (fb *failingBackend) UpsertMetrics(ctx context.Context, mc models.MetricCollection) (models.MetricCollection, error) {
+	if fb.err != nil {
+		return *models.NewMetricCollection(), fb.err
+	}
+
+	return fb.MemStorage.UpsertMetrics(ctx, mc)
+}
+
+// commitFailingBackend MemStorage, запись которого в базу теряет соединение на COMMIT
+type commitFailingBackend struct {
+	*MemStorage
+	sql *sqlx.DB
+}
+
+func (cb *commitFailingBackend) UpsertMetrics(ctx context.Context, _ models.MetricCollection) (models.MetricCollection, error) {
+	err := db.RunInTx(ctx, cb.sql, func(*sqlx.Tx) error {
+		return nil
+	})
+
+	return *models.NewMetricCollection(), err
+}
+
+// lostCommit драйвер, у которого транзакция обрывается на COMMIT
+type lostCommit struct{}
+
+func (lostCommit) Connect(context.Context) (driver.Conn, error) {
+	return lostCommit{}, nil
+}
+
+func (lostCommit) Driver() driver.Driver {
+	return nil
+}
+
+func (lostCommit) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (lostCommit) Close() error {
+	return nil
+}
+
+func (lostCommit) Begin() (driver.Tx, error) {
+	return lostCommit{}, nil
+}
+
+func (lostCommit) Commit() error {
+	return driver.ErrBadConn
+}
+
+func (lostCommit) Rollback() error {
+	return nil
+}
+
+type fakeHealth struct {
+	healthy bool
+}
+
+func (fh *fakeHealth) Healthy() bool {
+	return fh.healthy
+}
+
+func (fh *fakeHealth) MarkDown(error) {
+	fh.healthy = false
+}
+
+func TestBufferedStorage(t *testing.T) {
+	ctx := context.Background()
+	backend := &failingBackend{MemStorage: NewMemStorage()}
+	health := &fakeHealth{healthy: true}
+	bs := NewBufferedStorage(backend, health, testLogger{})
+
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 1))
+
+	backend.err = driver.ErrBadConn
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 2), "ошибка соединения не доходит до клиента")
+	assert.False(t, health.healthy, "база отмечена недоступной")
+
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 3))
+	require.NoError(t, bs.SetGaugeMetric(ctx, "Alloc", 1))
+	require.NoError(t, bs.SetGaugeMetric(ctx, "Alloc", 2))
+	assert.Equal(t, 2, bs.Pending(), "повторы метрик сведены в буфере")
+
+	health.healthy = true
+	assert.ErrorIs(t, bs.Flush(ctx), driver.ErrBadConn)
+	assert.Equal(t, 2, bs.Pending(), "при ошибке буфер сохраняется")
+
+	backend.err = nil
+	health.healthy = true
+	require.NoError(t, bs.Flush(ctx))
+	assert.Equal(t, 0, bs.Pending())
+
+	counter, err := backend.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(6), counter)
+	gauge, err := backend.GetGaugeMetric(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, models.Gauge(2), gauge)
+}
+
+func TestBufferedStorage_QueryError(t *testing.T) {
+	backend := &failingBackend{MemStorage: NewMemStorage(), err: errors.New("syntax error")}
+	health := &fakeHealth{healthy: true}
+	bs := NewBufferedStorage(backend, health, testLogger{})
+
+	assert.Error(t, bs.SetCounterMetric(context.Background(), "PollCount", 1), "ошибка запроса не буферизуется")
+	assert.True(t, health.healthy)
+	assert.Equal(t, 0, bs.Pending())
+}
+
+func TestBufferedStorage_CommitError(t *testing.T) {
+	database := sqlx.NewDb(sql.OpenDB(lostCommit{}), db.DriverPostgres)
+	defer database.Close()
+	health := &fakeHealth{healthy: true}
+	bs := NewBufferedStorage(&commitFailingBackend{MemStorage: NewMemStorage(), sql: database}, health, testLogger{})
+
+	err := bs.SetCounterMetric(context.Background(), "PollCount", 1)
+	assert.True(t, db.IsCommitError(err), "исход COMMIT неизвестен, ошибка отдаётся клиенту")
+	assert.Equal(t, 0, bs.Pending(), "пачка не попадает в буфер и не повторяется")
+	assert.False(t, health.healthy, "соединение потеряно")
+}
+
+func TestBufferedStorage_Timeout(t *testing.T) {
+	backend := &failingBackend{MemStorage: NewMemStorage(), err: fmt.Errorf("upsert: %w", context.DeadlineExceeded)}
+	health := &fakeHealth{healthy: true}
+	bs := NewBufferedStorage(backend, health, testLogger{})
+
+	assert.ErrorIs(t, bs.SetCounterMetric(context.Background(), "PollCount", 1), context.DeadlineExceeded)
+	assert.True(t, health.healthy, "медленный запрос не делает базу недоступной")
+	assert.Equal(t, 0, bs.Pending())
+}
+
+func TestBufferedStorage_FlushDropsFailedBatch(t *testing.T) {
+	ctx := context.Background()
+	backend := &failingBackend{MemStorage: NewMemStorage(), err: driver.ErrBadConn}
+	health := &fakeHealth{healthy: true}
+	bs := NewBufferedStorage(backend, health, testLogger{})
+
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 1))
+	require.Equal(t, 1, bs.Pending())
+
+	backend.err = errors.New("value out of range")
+	health.healthy = true
+	assert.Error(t, bs.Flush(ctx))
+	assert.Equal(t, 0, bs.Pending(), "пачка с ошибкой запроса не возвращается в буфер")
+	assert.True(t, health.healthy)
+
+	backend.err = nil
+	require.NoError(t, bs.SetCounterMetric(ctx, "PollCount", 2))
+	assert.Equal(t, 0, bs.Pending(), "новые записи снова идут сразу в базу")
+	counter, err := backend.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(2), counter)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"github.com/NikolosHGW/metric/internal/server/services"
+)
+
+// repositories по конструктору пустого хранилища на каждую реализацию services.Repository.
+// DBStorage проверяется на базе из TEST_DATABASE_DSN, которую можно очищать: локально без неё
+// пропускается, в CI (задан CI) падает
+func repositories() map[string]func(t *testing.T) services.Repository {
+	return map[string]func(t *testing.T) services.Repository{
+		"MemStorage": func(*testing.T) services.Repository {
+			return NewMemStorage()
+		},
+		"WALStorage": func(t *testing.T) services.Repository {
+			return openWAL(t, filepath.Join(t.TempDir(), "metrics.wal"), true)
+		},
+		"SQLiteStorage": func(t *testing.T) services.Repository {
+			return openSQLite(t, ":memory:")
+		},
+		"BoltStorage": func(t *testing.T) services.Repository {
+			return openBolt(t, filepath.Join(t.TempDir(), "metrics.bolt"), 0)
+		},
+		"BoltStorage с историей": func(t *testing.T) services.Repository {
+			return openBolt(t, filepath.Join(t.TempDir(), "metrics.bolt"), time.Minute)
+		},
+		"BufferedStorage": func(*testing.T) services.Repository {
+			return NewBufferedStorage(&failingBackend{MemStorage: NewMemStorage()}, &fakeHealth{healthy: true}, testLogger{})
+		},
+		"DBStorage": func(t *testing.T) services.Repository {
+			return openPostgres(t)
+		},
+	}
+}
+
+// TestRepositoryConformance поведение, одинаковое для всех хранилищ
+func TestRepositoryConformance(t *testing.T) {
+	for name, open := range repositories() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("gauge перезаписывается", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+
+				require.NoError(t, repo.SetGaugeMetric(ctx, "Alloc", 1.5))
+				require.NoError(t, repo.SetGaugeMetric(ctx, "Alloc", 2.5))
+
+				got, err := repo.GetGaugeMetric(ctx, "Alloc")
+				require.NoError(t, err)
+				assert.Equal(t, models.Gauge(2.5), got)
+			})
+
+			t.Run("counter накапливается", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+
+				require.NoError(t, repo.SetCounterMetric(ctx, "PollCount", 2))
+				require.NoError(t, repo.SetCounterMetric(ctx, "PollCount", 3))
+
+				got, err := repo.GetCounterMetric(ctx, "PollCount")
+				require.NoError(t, err)
+				assert.Equal(t, models.Counter(5), got)
+			})
+
+			t.Run("GetMetric возвращает тип, значение и автора", func(t *testing.T) {
+				repo := open(t)
+				ctx := identity.WithIdentity(context.Background(), identity.Identity{Name: "agent-1", Source: identity.SourceToken})
+
+				require.NoError(t, repo.SetMetric(ctx, models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(7))}))
+				require.NoError(t, repo.SetMetric(ctx, models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: ptr(0.0)}))
+
+				counter, err := repo.GetMetric(ctx, "PollCount")
+				require.NoError(t, err)
+				assert.Equal(t, models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(7)), UpdatedBy: "agent-1"}, counter)
+
+				gauge, err := repo.GetMetric(ctx, "Alloc")
+				require.NoError(t, err)
+				assert.Equal(t, models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: ptr(0.0), UpdatedBy: "agent-1"}, gauge, "нулевой gauge остаётся gauge")
+			})
+
+			t.Run("gauge сменился на counter", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+				require.NoError(t, repo.SetGaugeMetric(ctx, "Switched", 1.5))
+				require.NoError(t, repo.SetCounterMetric(ctx, "Switched", 4))
+
+				got, err := repo.GetCounterMetric(ctx, "Switched")
+				require.NoError(t, err)
+				assert.Equal(t, models.Counter(4), got)
+			})
+
+			t.Run("нет метрики", func(t *testing.T) {
+				repo := open(t)
+
+				_, err := repo.GetMetric(context.Background(), "Unknown")
+				assert.Error(t, err)
+			})
+
+			t.Run("UpsertMetrics возвращает накопленные значения по одному на метрику", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+				require.NoError(t, repo.SetCounterMetric(ctx, "PollCount", 5))
+
+				upserted, err := repo.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+					{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+					{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+					{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(2))},
+					{ID: "Alloc", MType: models.GaugeType, Value: ptr(3.0)},
+				}})
+				require.NoError(t, err)
+				assert.Equal(t, []models.Metrics{
+					{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(8))},
+					{ID: "Alloc", MType: models.GaugeType, Value: ptr(3.0)},
+				}, upserted.Metrics)
+			})
+
+			t.Run("пачка с некорректной метрикой не применяется", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+				require.NoError(t, repo.SetCounterMetric(ctx, "PollCount", 5))
+
+				_, err := repo.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+					{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+					{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+					{ID: "Broken", MType: models.CounterType},
+				}})
+				require.Error(t, err)
+
+				counter, err := repo.GetCounterMetric(ctx, "PollCount")
+				require.NoError(t, err)
+				assert.Equal(t, models.Counter(5), counter)
+				_, err = repo.GetMetric(ctx, "Alloc")
+				assert.Error(t, err)
+			})
+
+			t.Run("GetAllMetrics по алфавиту", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+				require.NoError(t, repo.SetGaugeMetric(ctx, "Zeta", 1.5))
+				require.NoError(t, repo.SetCounterMetric(ctx, "Alpha", 3))
+
+				assert.Equal(t, []string{"Alpha: 3", "Zeta: 1.5"}, repo.GetAllMetrics(ctx))
+			})
+
+			t.Run("параллельные пачки не теряют прирост counter", func(t *testing.T) {
+				repo := open(t)
+				ctx := context.Background()
+				const workers, batches = 4, 25
+
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for b := 0; b < batches; b++ {
+							_, err := repo.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+								{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+								{ID: "Alloc", MType: models.GaugeType, Value: ptr(float64(b))},
+							}})
+							assert.NoError(t, err)
+						}
+					}()
+				}
+				wg.Wait()
+
+				counter, err := repo.GetCounterMetric(ctx, "PollCount")
+				require.NoError(t, err)
+				assert.Equal(t, models.Counter(workers*batches), counter)
+			})
+		})
+	}
+}
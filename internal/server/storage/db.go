@@ -2,13 +2,19 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
-	"sync"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/NikolosHGW/metric/internal/server/identity"
 )
 
 func NewDBStorage(sql *sqlx.DB, log customLogger) *DBStorage {
@@ -18,37 +24,62 @@ func NewDBStorage(sql *sqlx.DB, log customLogger) *DBStorage {
 	}
 }
 
+// DBStorage хранилище в PostgreSQL. Блокировок в процессе нет: параллельные записи
+// разводит сама база, а запись, отменённую ею из-за конкурентов или обрыва соединения,
+// повторяет db.RunInTx
 type DBStorage struct {
-	sql *sqlx.DB
-	log customLogger
-	m   sync.Mutex
+	sql     *sqlx.DB
+	log     customLogger
+	timeout time.Duration
+	history bool
 }
 
+// SetHistory включает запись каждого нового значения в секционированную таблицу истории
+func (ds *DBStorage) SetHistory(enabled bool) {
+	ds.history = enabled
+}
+
+// SetStatementTimeout ограничивает время каждого запроса к базе, 0 без ограничения
+func (ds *DBStorage) SetStatementTimeout(timeout time.Duration) {
+	ds.timeout = timeout
+}
+
+func (ds *DBStorage) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ds.timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, ds.timeout)
+}
+
+// SetMetric записывает метрику, автором считается m.UpdatedBy, а если он пуст, клиент из контекста
 func (ds *DBStorage) SetMetric(ctx context.Context, m models.Metrics) error {
-	ds.m.Lock()
-	defer ds.m.Unlock()
-	_, err := ds.sql.ExecContext(
-		ctx,
-		`INSERT INTO metrics (id, type, delta, value)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (id) DO UPDATE SET type = EXCLUDED.type, 
-			delta = metrics.delta + EXCLUDED.delta, 
-			value = EXCLUDED.value`,
-		m.ID,
-		m.MType,
-		m.Delta,
-		m.Value,
-	)
+	_, err := ds.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{m}})
 
 	return err
 }
 
+func updatedBy(ctx context.Context, m models.Metrics) string {
+	if m.UpdatedBy != "" {
+		return m.UpdatedBy
+	}
+
+	return identity.NameFromContext(ctx)
+}
+
 func (ds *DBStorage) GetMetric(ctx context.Context, name string) (models.Metrics, error) {
-	row := ds.sql.QueryRowxContext(ctx, "SELECT id, type, delta, value FROM metrics WHERE id = $1", name)
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	row := ds.sql.QueryRowxContext(
+		ctx,
+		"SELECT id, type, delta, value, COALESCE(updated_by, '') FROM metrics WHERE id = $1",
+		name,
+	)
 
 	model := models.Metrics{}
 
-	err := row.Scan(&model.ID, &model.MType, &model.Delta, &model.Value)
+	err := row.Scan(&model.ID, &model.MType, &model.Delta, &model.Value, &model.UpdatedBy)
 
 	if err != nil {
 		ds.log.Info("cannot scan row when getting metric", zap.Error(err))
@@ -79,27 +110,32 @@ func (ds *DBStorage) SetCounterMetric(ctx context.Context, name string, value mo
 
 func (ds *DBStorage) GetGaugeMetric(ctx context.Context, name string) (models.Gauge, error) {
 	metric, err := ds.GetMetric(ctx, name)
-
 	if err != nil {
-		var value models.Gauge
-		return value, err
+		return 0, err
+	}
+	if metric.Value == nil {
+		return 0, fmt.Errorf("%s is not a gauge", name)
 	}
 
-	return models.Gauge(*metric.Value), err
+	return models.Gauge(*metric.Value), nil
 }
 
 func (ds *DBStorage) GetCounterMetric(ctx context.Context, name string) (models.Counter, error) {
 	metric, err := ds.GetMetric(ctx, name)
-
 	if err != nil {
-		var value models.Counter
-		return value, err
+		return 0, err
+	}
+	if metric.Delta == nil {
+		return 0, fmt.Errorf("%s is not a counter", name)
 	}
 
-	return models.Counter(*metric.Delta), err
+	return models.Counter(*metric.Delta), nil
 }
 
 func (ds *DBStorage) GetAllMetrics(ctx context.Context) []string {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
 	rows, err := ds.sql.QueryxContext(ctx, "SELECT id, type, delta, value FROM metrics ORDER BY id")
 
 	var metricStrings []string
@@ -118,8 +154,8 @@ func (ds *DBStorage) GetAllMetrics(ctx context.Context) []string {
 	for rows.Next() {
 		var name string
 		var mType string
-		var delta int64
-		var value float64
+		var delta sql.NullInt64
+		var value sql.NullFloat64
 		err = rows.Scan(&name, &mType, &delta, &value)
 
 		if err != nil {
@@ -127,9 +163,11 @@ func (ds *DBStorage) GetAllMetrics(ctx context.Context) []string {
 			return metricStrings
 		}
 
-		result := fmt.Sprintf("%v", delta)
-		if mType == models.GaugeType {
-			result = fmt.Sprintf("%v", value)
+		var result string
+		if mType == models.GaugeType && value.Valid {
+			result = fmt.Sprintf("%v", value.Float64)
+		} else if delta.Valid {
+			result = fmt.Sprintf("%v", delta.Int64)
 		}
 
 		metricStrings = append(metricStrings, fmt.Sprintf("%v: %v", name, result))
@@ -145,49 +183,376 @@ func (ds *DBStorage) GetAllMetrics(ctx context.Context) []string {
 }
 
 func (ds *DBStorage) GetIsDBConnected() bool {
-	err := ds.sql.DB.Ping()
+	ctx, cancel := ds.withTimeout(context.Background())
+	defer cancel()
+	err := ds.sql.DB.PingContext(ctx)
 
 	return err == nil
 }
 
+// UpsertMetrics записывает пачку одним запросом: повторы одной метрики сначала сводятся
+// (counter суммируется, gauge берётся последний), затем строки вставляются через unnest.
+// Возвращает накопленные значения по одной строке на метрику в порядке первого появления
 func (ds *DBStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
-	ds.m.Lock()
-	defer ds.m.Unlock()
-	var upsertedMetrics []models.Metrics
-
-	tx, err := ds.sql.BeginTxx(ctx, nil)
+	batch := make([]models.Metrics, 0, len(metricCollection.Metrics))
+	for _, metric := range metricCollection.Metrics {
+		if err := validateMetric(metric); err != nil {
+			return *models.NewMetricCollection(), err
+		}
+		metric.UpdatedBy = updatedBy(ctx, metric)
+		batch = append(batch, metric)
+	}
+	aggregated := aggregateMetrics(batch)
+
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	args := metricArrays(sortedByID(aggregated))
+	var upserted []models.Metrics
+	err := db.RunInTx(ctx, ds.sql, func(tx *sqlx.Tx) error {
+		upserted = nil
+		return tx.SelectContext(ctx, &upserted,
+			`WITH upserted AS (
+				INSERT INTO metrics (id, type, delta, value, updated_by)
+				SELECT id, type, delta, value, NULLIF(updated_by, '')
+				FROM unnest($1::varchar[], $2::varchar[], $3::bigint[], $4::double precision[], $5::varchar[])
+					AS batch(id, type, delta, value, updated_by)
+				ON CONFLICT (id) DO UPDATE SET
+					type = EXCLUDED.type,
+					delta = COALESCE(metrics.delta, 0) + EXCLUDED.delta,
+					value = EXCLUDED.value,
+					updated_by = EXCLUDED.updated_by,
+					updated_at = now()
+				RETURNING id, type, delta, value, updated_by
+			), samples AS (
+				INSERT INTO metric_samples (id, type, delta, value, updated_by)
+				SELECT id, type, delta, value, updated_by FROM upserted WHERE $6
+			)
+			SELECT id, type, delta, value, COALESCE(updated_by, '') AS updated_by FROM upserted`,
+			append(args, ds.history)...,
+		)
+	})
 	if err != nil {
+		ds.log.Info("cannot UpsertMetrics", zap.Error(err))
 		return *models.NewMetricCollection(), err
 	}
 
-	for _, metric := range metricCollection.Metrics {
-		var upsertedMetric models.Metrics
-		err := tx.GetContext(ctx, &upsertedMetric,
-			`INSERT INTO metrics (id, type, delta, value)
-            VALUES ($1, $2, $3, $4)
-            ON CONFLICT (id) DO UPDATE SET
-                type = EXCLUDED.type,
-                delta = metrics.delta + EXCLUDED.delta,
-                value = EXCLUDED.value
-            RETURNING *`,
-			metric.ID, metric.MType, metric.Delta, metric.Value,
+	byID := make(map[string]models.Metrics, len(upserted))
+	for _, m := range upserted {
+		byID[m.ID] = m
+	}
+	result := make([]models.Metrics, 0, len(aggregated))
+	for _, m := range aggregated {
+		result = append(result, byID[m.ID])
+	}
+
+	return models.MetricCollection{Metrics: result}, nil
+}
+
+// History значения метрики, записанные в [from, to), по возрастанию времени
+func (ds *DBStorage) History(ctx context.Context, name string, from, to time.Time) ([]models.HistoryPoint, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	var samples []struct {
+		models.Metrics
+		RecordedAt time.Time `db:"recorded_at"`
+	}
+	err := ds.sql.SelectContext(ctx, &samples,
+		`SELECT id, type, delta, value, COALESCE(updated_by, '') AS updated_by, recorded_at
+		FROM metric_samples
+		WHERE id = $1 AND recorded_at >= $2 AND recorded_at < $3
+		ORDER BY recorded_at`,
+		name, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read history: %w", err)
+	}
+
+	points := make([]models.HistoryPoint, 0, len(samples))
+	for _, s := range samples {
+		points = append(points, models.HistoryPoint{Time: s.RecordedAt, Metric: s.Metrics})
+	}
+
+	return points, nil
+}
+
+// LastUpdated время последней записи каждой метрики
+func (ds *DBStorage) LastUpdated(ctx context.Context) (map[string]time.Time, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	var rows []struct {
+		ID        string    `db:"id"`
+		UpdatedAt time.Time `db:"updated_at"`
+	}
+	if err := ds.sql.SelectContext(ctx, &rows, "SELECT id, updated_at FROM metrics"); err != nil {
+		return nil, fmt.Errorf("cannot read last updated: %w", err)
+	}
+
+	updated := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		updated[row.ID] = row.UpdatedAt
+	}
+
+	return updated, nil
+}
+
+// ExpireMetrics удаляет из names метрики, не обновлявшиеся с before, и возвращает удалённые.
+// Метрика, записанная после выбора names, не удаляется
+func (ds *DBStorage) ExpireMetrics(ctx context.Context, names []string, before time.Time) ([]string, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	var expired []string
+	err := db.RunInTx(ctx, ds.sql, func(tx *sqlx.Tx) error {
+		expired = nil
+		return tx.SelectContext(ctx, &expired,
+			"DELETE FROM metrics WHERE id = ANY($1) AND updated_at < $2 RETURNING id",
+			pq.Array(names), before,
 		)
-		if err != nil {
-			rollBackErr := tx.Rollback()
-			if rollBackErr != nil {
-				ds.log.Info("cannot rollback UpsertMetrics", zap.Error(rollBackErr))
-			}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot expire metrics: %w", err)
+	}
 
-			ds.log.Info("cannot UpsertMetrics", zap.Error(err))
+	return expired, nil
+}
 
-			return *models.NewMetricCollection(), err
+// SaveRollups записывает сводки уровня step одним запросом, сводки за те же интервалы заменяются
+func (ds *DBStorage) SaveRollups(ctx context.Context, step time.Duration, rollups []models.Rollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	args := append([]any{int64(step / time.Second)}, rollupArrays(rollups)...)
+	err := db.RunInTx(ctx, ds.sql, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO metric_rollups (step_seconds, id, bucket_start, type, count, min, max, avg, delta, rate)
+			SELECT $1, id, bucket_start, type, count, min, max, avg, delta, rate
+			FROM unnest($2::varchar[], $3::timestamptz[], $4::varchar[], $5::bigint[],
+				$6::double precision[], $7::double precision[], $8::double precision[], $9::bigint[], $10::double precision[])
+				AS batch(id, bucket_start, type, count, min, max, avg, delta, rate)
+			ON CONFLICT (step_seconds, id, bucket_start) DO UPDATE SET
+				type = EXCLUDED.type,
+				count = EXCLUDED.count,
+				min = EXCLUDED.min,
+				max = EXCLUDED.max,
+				avg = EXCLUDED.avg,
+				delta = EXCLUDED.delta,
+				rate = EXCLUDED.rate`,
+			args...,
+		)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot save rollups: %w", err)
+	}
+
+	return nil
+}
+
+// Rollups сводки уровня step по интервалам, начавшимся в [from, to)
+func (ds *DBStorage) Rollups(ctx context.Context, name string, step time.Duration, from, to time.Time) ([]models.Rollup, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	var rollups []models.Rollup
+	err := ds.sql.SelectContext(ctx, &rollups,
+		`SELECT id, bucket_start, type, count, min, max, avg, delta, rate
+		FROM metric_rollups
+		WHERE step_seconds = $1 AND id = $2 AND bucket_start >= $3 AND bucket_start < $4
+		ORDER BY bucket_start`,
+		int64(step/time.Second), name, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rollups: %w", err)
+	}
+	for i := range rollups {
+		rollups[i].Step = step
+	}
+
+	return rollups, nil
+}
+
+// DeleteRollups удаляет сводки уровня step по интервалам, начавшимся до before
+func (ds *DBStorage) DeleteRollups(ctx context.Context, step time.Duration, before time.Time) (int, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	res, err := ds.sql.ExecContext(ctx,
+		"DELETE FROM metric_rollups WHERE step_seconds = $1 AND bucket_start < $2",
+		int64(step/time.Second), before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("cannot delete rollups: %w", err)
+	}
+	removed, err := res.RowsAffected()
+
+	return int(removed), err
+}
+
+// ExportMetrics выгружает все метрики для снимка
+func (ds *DBStorage) ExportMetrics(ctx context.Context) ([]models.Metrics, error) {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	var metrics []models.Metrics
+	err := ds.sql.SelectContext(ctx, &metrics,
+		"SELECT id, type, delta, value, COALESCE(updated_by, '') AS updated_by FROM metrics ORDER BY id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot export metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// ImportMetrics заменяет значения метрик значениями из снимка одним запросом,
+// counter не суммируется с текущим
+func (ds *DBStorage) ImportMetrics(ctx context.Context, metrics []models.Metrics) error {
+	ctx, cancel := ds.withTimeout(ctx)
+	defer cancel()
+
+	latest := make(map[string]int, len(metrics))
+	unique := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if i, ok := latest[m.ID]; ok {
+			unique[i] = m
+			continue
 		}
-		upsertedMetrics = append(upsertedMetrics, upsertedMetric)
+		latest[m.ID] = len(unique)
+		unique = append(unique, m)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return *models.NewMetricCollection(), err
+	args := metricArrays(sortedByID(unique))
+	err := db.RunInTx(ctx, ds.sql, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO metrics (id, type, delta, value, updated_by)
+			SELECT id, type, delta, value, NULLIF(updated_by, '')
+			FROM unnest($1::varchar[], $2::varchar[], $3::bigint[], $4::double precision[], $5::varchar[])
+				AS batch(id, type, delta, value, updated_by)
+			ON CONFLICT (id) DO UPDATE SET
+				type = EXCLUDED.type,
+				delta = EXCLUDED.delta,
+				value = EXCLUDED.value,
+				updated_by = EXCLUDED.updated_by,
+				updated_at = now()`,
+			args...,
+		)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("cannot import metrics: %w", err)
+	}
+
+	return nil
+}
+
+// aggregateMetrics сводит повторы метрик в пачке так, как их применили бы по очереди:
+// delta counter суммируются, у gauge остаётся последнее значение, автором считается
+// последний записавший. Если тип метрики в пачке меняется, учитываются записи после смены.
+// Порядок метрик сохраняется по первому появлению
+func aggregateMetrics(metrics []models.Metrics) []models.Metrics {
+	index := make(map[string]int, len(metrics))
+	aggregated := make([]models.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		i, ok := index[m.ID]
+		if !ok {
+			index[m.ID] = len(aggregated)
+			aggregated = append(aggregated, copyMetric(m))
+			continue
+		}
+
+		prev := aggregated[i]
+		if m.MType == models.CounterType && prev.MType == models.CounterType && prev.Delta != nil && m.Delta != nil {
+			delta := *prev.Delta + *m.Delta
+			prev.Delta = &delta
+			prev.UpdatedBy = m.UpdatedBy
+			aggregated[i] = prev
+			continue
+		}
+		aggregated[i] = copyMetric(m)
+	}
+
+	return aggregated
+}
+
+func copyMetric(m models.Metrics) models.Metrics {
+	if m.Delta != nil {
+		delta := *m.Delta
+		m.Delta = &delta
+	}
+	if m.Value != nil {
+		value := *m.Value
+		m.Value = &value
 	}
 
-	return models.MetricCollection{Metrics: upsertedMetrics}, nil
+	return m
+}
+
+// sortedByID копия пачки в порядке имён: параллельные пачки блокируют строки
+// в одном порядке и не упираются друг в друга взаимной блокировкой
+func sortedByID(metrics []models.Metrics) []models.Metrics {
+	sorted := slices.Clone(metrics)
+	slices.SortFunc(sorted, func(a, b models.Metrics) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+
+	return sorted
+}
+
+// metricArrays раскладывает пачку по столбцам для unnest, отсутствующие значения передаются как NULL
+func metricArrays(metrics []models.Metrics) []any {
+	ids := make([]string, len(metrics))
+	types := make([]string, len(metrics))
+	deltas := make([]sql.NullInt64, len(metrics))
+	values := make([]sql.NullFloat64, len(metrics))
+	authors := make([]string, len(metrics))
+	for i, m := range metrics {
+		ids[i] = m.ID
+		types[i] = m.MType
+		if m.Delta != nil {
+			deltas[i] = sql.NullInt64{Int64: *m.Delta, Valid: true}
+		}
+		if m.Value != nil {
+			values[i] = sql.NullFloat64{Float64: *m.Value, Valid: true}
+		}
+		authors[i] = m.UpdatedBy
+	}
+
+	return []any{pq.Array(ids), pq.Array(types), pq.Array(deltas), pq.Array(values), pq.Array(authors)}
+}
+
+// rollupArrays раскладывает сводки по столбцам для unnest
+func rollupArrays(rollups []models.Rollup) []any {
+	ids := make([]string, len(rollups))
+	starts := make([]string, len(rollups))
+	types := make([]string, len(rollups))
+	counts := make([]int64, len(rollups))
+	mins := make([]float64, len(rollups))
+	maxs := make([]float64, len(rollups))
+	avgs := make([]float64, len(rollups))
+	deltas := make([]int64, len(rollups))
+	rates := make([]float64, len(rollups))
+	for i, r := range rollups {
+		ids[i] = r.ID
+		starts[i] = r.Start.UTC().Format(time.RFC3339Nano)
+		types[i] = r.MType
+		counts[i] = r.Count
+		mins[i] = r.Min
+		maxs[i] = r.Max
+		avgs[i] = r.Avg
+		deltas[i] = r.Delta
+		rates[i] = r.Rate
+	}
+
+	return []any{
+		pq.Array(ids), pq.Array(starts), pq.Array(types), pq.Array(counts),
+		pq.Array(mins), pq.Array(maxs), pq.Array(avgs), pq.Array(deltas), pq.Array(rates),
+	}
 }
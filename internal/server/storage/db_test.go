@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregateMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		batch []models.Metrics
+		want  []models.Metrics
+	}{
+		{
+			name: "counter суммируется, автор последний",
+			batch: []models.Metrics{
+				{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(2)), UpdatedBy: "a"},
+				{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+				{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(3)), UpdatedBy: "b"},
+			},
+			want: []models.Metrics{
+				{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(5)), UpdatedBy: "b"},
+				{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+			},
+		},
+		{
+			name: "у gauge остаётся последнее значение",
+			batch: []models.Metrics{
+				{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+				{ID: "Alloc", MType: models.GaugeType, Value: ptr(2.0)},
+			},
+			want: []models.Metrics{
+				{ID: "Alloc", MType: models.GaugeType, Value: ptr(2.0)},
+			},
+		},
+		{
+			name: "смена типа начинает сведение заново",
+			batch: []models.Metrics{
+				{ID: "X", MType: models.CounterType, Delta: ptr(int64(2))},
+				{ID: "X", MType: models.GaugeType, Value: ptr(1.0)},
+				{ID: "X", MType: models.CounterType, Delta: ptr(int64(4))},
+			},
+			want: []models.Metrics{
+				{ID: "X", MType: models.CounterType, Delta: ptr(int64(4))},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, aggregateMetrics(tt.batch))
+		})
+	}
+}
+
+func TestAggregateMetrics_DoesNotModifyBatch(t *testing.T) {
+	batch := []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(2))},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(3))},
+	}
+	aggregateMetrics(batch)
+
+	assert.Equal(t, int64(2), *batch[0].Delta)
+}
+
+func TestMetricArrays(t *testing.T) {
+	args := metricArrays(sortedByID([]models.Metrics{
+		{ID: "b", MType: models.GaugeType, Value: ptr(0.1), UpdatedBy: "agent"},
+		{ID: "a", MType: models.CounterType, Delta: ptr(int64(7))},
+	}))
+
+	want := []string{`{"a","b"}`, `{"counter","gauge"}`, `{7,NULL}`, `{NULL,0.1}`, `{"","agent"}`}
+	require.Len(t, args, len(want))
+	for i, arg := range args {
+		value, err := arg.(driver.Valuer).Value()
+		require.NoError(t, err)
+		assert.Equal(t, want[i], value)
+	}
+}
+
+// openPostgres DBStorage с историей над очищенной базой из TEST_DATABASE_DSN,
+// без неё тест пропускается
+func openPostgres(t *testing.T) *DBStorage {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		// в CI база поднимается всегда, пропуск там означал бы непроверенный DBStorage
+		if os.Getenv("CI") != "" {
+			t.Fatal("TEST_DATABASE_DSN не задан")
+		}
+		t.Skip("TEST_DATABASE_DSN не задан")
+	}
+	database, err := db.InitDB(dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+	_, err = database.Exec("TRUNCATE metrics, metric_samples, metric_rollups")
+	require.NoError(t, err)
+
+	ds := NewDBStorage(database, testLogger{})
+	ds.SetHistory(true)
+
+	return ds
+}
+
+func TestDBStorage_UpsertMetrics(t *testing.T) {
+	ds := openPostgres(t)
+	ctx := context.Background()
+	start := time.Now().Add(-time.Minute)
+	require.NoError(t, ds.SetGaugeMetric(ctx, "Switched", 1.5))
+
+	upserted, err := ds.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(2))},
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(3))},
+		{ID: "Switched", MType: models.CounterType, Delta: ptr(int64(4))},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(5))},
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.0)},
+		{ID: "Switched", MType: models.CounterType, Delta: ptr(int64(4))},
+	}, upserted.Metrics)
+
+	counter, err := ds.GetCounterMetric(ctx, "Switched")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(4), counter, "gauge, сменившийся на counter, считается от нуля")
+
+	points, err := ds.History(ctx, "PollCount", start, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, points, 1, "повторы пачки пишутся в историю одной записью")
+	assert.Equal(t, int64(5), *points[0].Metric.Delta)
+}
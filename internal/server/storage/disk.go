@@ -2,136 +2,245 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 
 	"github.com/NikolosHGW/metric/internal/models"
 	"go.uber.org/zap"
 )
 
+// DefaultGenerations сколько предыдущих снимков хранится рядом с текущим
+const DefaultGenerations = 2
+
+// Storage хранилище, которое умеет целиком выгрузить метрики в снимок и загрузить их обратно.
+// Его реализуют и MemStorage, и DBStorage
 type Storage interface {
-	GetMetricsModels(context.Context) []models.Metrics
-	SetMetric(context.Context, models.Metrics) error
+	ExportMetrics(context.Context) ([]models.Metrics, error)
+	ImportMetrics(context.Context, []models.Metrics) error
 }
 
-type Producer struct {
-	file    *os.File
-	encoder *json.Encoder
+type customLogger interface {
+	Info(string, ...zap.Field)
 }
 
-func NewProducer(fileName string) (*Producer, error) {
-	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		return nil, err
+// compactor журнал, который сжимается в снимок. walSeq номер последней записи журнала,
+// вошедшей в снимок: при восстановлении такие записи не проигрываются повторно
+type compactor interface {
+	Compact(snapshot func(metrics []models.Metrics, walSeq uint64) error) error
+	SetCheckpoint(walSeq uint64)
+}
+
+type DiskStorage struct {
+	strg        Storage
+	log         customLogger
+	wal         compactor
+	fileName    string
+	format      string
+	generations int
+}
+
+func NewDiskStorage(strg Storage, log customLogger, fileName string) *DiskStorage {
+	return &DiskStorage{
+		strg:        strg,
+		log:         log,
+		fileName:    fileName,
+		format:      FormatJSON,
+		generations: DefaultGenerations,
 	}
+}
 
-	return &Producer{
-		file:    file,
-		encoder: json.NewEncoder(file),
-	}, nil
+// SetWAL включает сжатие журнала: снимок пишется под блокировкой журнала, после чего журнал обнуляется
+func (ds *DiskStorage) SetWAL(wal compactor) {
+	ds.wal = wal
 }
 
-func (p *Producer) WriteMetric(metric models.Metrics) error {
-	return p.encoder.Encode(&metric)
+// SetFormat задаёт формат новых снимков, читаются снимки любого формата
+func (ds *DiskStorage) SetFormat(format string) {
+	ds.format = format
 }
 
-func (p *Producer) Close() error {
-	return p.file.Close()
+// SetGenerations задаёт, сколько предыдущих снимков хранить как file.1, file.2 и т.д.
+func (ds *DiskStorage) SetGenerations(n int) {
+	ds.generations = max(n, 0)
 }
 
-type Consumer struct {
-	file    *os.File
-	decoder *json.Decoder
+func (ds DiskStorage) WriteToDisk() {
+	var err error
+	if ds.wal != nil {
+		err = ds.wal.Compact(ds.writeSnapshot)
+	} else {
+		var metrics []models.Metrics
+		metrics, err = ds.strg.ExportMetrics(context.Background())
+		if err == nil {
+			err = ds.writeSnapshot(metrics, 0)
+		}
+	}
+	if err != nil {
+		ds.log.Info("cannot write snapshot", zap.Error(err))
+	}
 }
 
-func NewConsumer(fileName string) (*Consumer, error) {
-	file, err := os.OpenFile(fileName, os.O_RDONLY|os.O_CREATE, 0666)
+// writeSnapshot пишет снимок во временный файл и переименовывает его поверх прежнего,
+// так что при падении на диске остаётся либо старый, либо новый снимок целиком.
+// Прежний снимок сдвигается в предыдущие поколения
+func (ds DiskStorage) writeSnapshot(metrics []models.Metrics, walSeq uint64) error {
+	tmp, err := writeTempSnapshot(ds.fileName, ds.format, metrics, walSeq)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := ds.rotateGenerations(); err != nil {
+		return err
 	}
 
-	return &Consumer{
-		file:    file,
-		decoder: json.NewDecoder(file),
-	}, nil
+	return commitSnapshot(tmp, ds.fileName)
 }
 
-func (c *Consumer) ReadMetric() (*models.Metrics, error) {
-	metric := &models.Metrics{}
-	if err := c.decoder.Decode(&metric); err != nil {
-		return nil, err
+// WriteSnapshotFile атомарно записывает снимок формата format в файл name
+func WriteSnapshotFile(name, format string, metrics []models.Metrics) error {
+	tmp, err := writeTempSnapshot(name, format, metrics, 0)
+	if err != nil {
+		return err
 	}
 
-	return metric, nil
+	return commitSnapshot(tmp, name)
 }
 
-func (c *Consumer) Close() error {
-	return c.file.Close()
-}
+// writeTempSnapshot пишет снимок рядом с name и сбрасывает его на диск
+func writeTempSnapshot(name, format string, metrics []models.Metrics, walSeq uint64) (string, error) {
+	tmp := name + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return "", fmt.Errorf("cannot open snapshot: %w", err)
+	}
 
-type customLogger interface {
-	Info(string, ...zap.Field)
-}
+	if err := writeMetrics(file, format, metrics, walSeq); err != nil {
+		return "", errors.Join(err, file.Close())
+	}
+	if err := file.Sync(); err != nil {
+		return "", errors.Join(fmt.Errorf("cannot sync snapshot: %w", err), file.Close())
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("cannot close snapshot: %w", err)
+	}
 
-type DiskStorage struct {
-	strg     Storage
-	log      customLogger
-	fileName string
+	return tmp, nil
 }
 
-func NewDiskStorage(strg Storage, log customLogger, fileName string) *DiskStorage {
-	return &DiskStorage{
-		strg:     strg,
-		log:      log,
-		fileName: fileName,
+func commitSnapshot(tmp, name string) error {
+	if err := os.Rename(tmp, name); err != nil {
+		return fmt.Errorf("cannot rename snapshot: %w", err)
 	}
+
+	return syncDir(filepath.Dir(name))
 }
 
-func (ds DiskStorage) WriteToDisk() {
-	Producer, err := NewProducer(ds.fileName)
+func writeMetrics(w io.Writer, format string, metrics []models.Metrics, walSeq uint64) error {
+	producer, err := newProducer(w, format, walSeq)
 	if err != nil {
-		ds.log.Info("cannot open file", zap.Error(err))
+		return err
 	}
-	defer func() {
-		err := Producer.Close()
-		if err != nil {
-			ds.log.Info("cannot close Producer", zap.Error(err))
+	for _, metric := range metrics {
+		if err := producer.WriteMetric(metric); err != nil {
+			return fmt.Errorf("cannot encode: %w", err)
 		}
-	}()
+	}
+	if err := producer.Finish(); err != nil {
+		return fmt.Errorf("cannot finish snapshot: %w", err)
+	}
 
-	for _, metric := range ds.strg.GetMetricsModels(context.Background()) {
-		if err := Producer.WriteMetric(metric); err != nil {
-			ds.log.Info("cannot encode", zap.Error(err))
+	return nil
+}
+
+func (ds DiskStorage) rotateGenerations() error {
+	for i := ds.generations; i >= 1; i-- {
+		err := os.Rename(ds.generationName(i-1), ds.generationName(i))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("cannot rotate snapshot: %w", err)
 		}
 	}
+
+	return nil
 }
 
+// generationName путь к снимку поколения n, 0 текущий снимок
+func (ds DiskStorage) generationName(n int) string {
+	if n == 0 {
+		return ds.fileName
+	}
+
+	return ds.fileName + "." + strconv.Itoa(n)
+}
+
+// WriteToStorage загружает самый новый целый снимок: если текущий повреждён,
+// берётся предыдущее поколение. Снимок загружается только в пустое хранилище,
+// чтобы не затереть более свежие данные в базе
 func (ds DiskStorage) WriteToStorage() {
-	Consumer, err := NewConsumer(ds.fileName)
+	ctx := context.Background()
+
+	existing, err := ds.strg.ExportMetrics(ctx)
 	if err != nil {
-		ds.log.Info("cannot open file", zap.Error(err))
+		ds.log.Info("cannot check storage before restore", zap.Error(err))
+		return
 	}
-	defer func() {
-		err := Consumer.Close()
+	if len(existing) > 0 {
+		ds.log.Info("storage is not empty, snapshot is not restored", zap.Int("metrics", len(existing)))
+		return
+	}
+
+	for i := 0; i <= ds.generations; i++ {
+		name := ds.generationName(i)
+		metrics, walSeq, err := readSnapshotFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
 		if err != nil {
-			ds.log.Info("cannot close Consumer", zap.Error(err))
+			ds.log.Info("cannot read snapshot", zap.String("file", name), zap.Error(err))
+			continue
+		}
+		if i > 0 {
+			ds.log.Info("restoring from previous snapshot generation", zap.String("file", name))
 		}
-	}()
 
-	for {
-		metric, err := Consumer.ReadMetric()
-		if err != nil {
-			ds.log.Info("cannot decode", zap.Error(err))
-			break
+		if err := ds.strg.ImportMetrics(ctx, metrics); err != nil {
+			ds.log.Info("cannot import snapshot", zap.String("file", name), zap.Error(err))
+			return
 		}
-		err = ds.strg.SetMetric(context.Background(), *metric)
-		if err != nil {
-			ds.log.Info("cannot SetMetric", zap.Error(err))
-			break
+		if ds.wal != nil {
+			ds.wal.SetCheckpoint(walSeq)
 		}
+
+		return
 	}
 }
 
 func (ds DiskStorage) CanWriteToDisk() bool {
 	return ds.fileName != ""
 }
+
+func readSnapshotFile(name string) ([]models.Metrics, uint64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return readSnapshot(file)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("cannot open snapshot dir: %w", err)
+	}
+	if err := d.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("cannot sync snapshot dir: %w", err), d.Close())
+	}
+
+	return d.Close()
+}
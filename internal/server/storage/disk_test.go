@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGauge(t *testing.T, disk *DiskStorage, mem *MemStorage, value models.Gauge) {
+	t.Helper()
+
+	require.NoError(t, mem.SetGaugeMetric(context.Background(), "Alloc", value))
+	disk.WriteToDisk()
+}
+
+func TestDiskStorage_Generations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	mem := NewMemStorage()
+	disk := NewDiskStorage(mem, testLogger{}, path)
+	disk.SetGenerations(2)
+
+	for i := 1; i <= 4; i++ {
+		writeGauge(t, disk, mem, models.Gauge(i))
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want float64
+	}{
+		{name: "текущий снимок", file: path, want: 4},
+		{name: "первое поколение", file: path + ".1", want: 3},
+		{name: "второе поколение", file: path + ".2", want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, _, err := readSnapshotFile(tt.file)
+			require.NoError(t, err)
+			require.Len(t, metrics, 1)
+			assert.Equal(t, tt.want, *metrics[0].Value)
+		})
+	}
+
+	_, err := os.Stat(path + ".3")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(path + ".tmp")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDiskStorage_WriteToStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string)
+		want    models.Gauge
+		wantErr bool
+	}{
+		{
+			name:    "целый снимок",
+			corrupt: func(t *testing.T, path string) {},
+			want:    2,
+		},
+		{
+			name: "испорчено значение, берётся предыдущее поколение",
+			corrupt: func(t *testing.T, path string) {
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				data = bytes.Replace(data, []byte(`"value":2`), []byte(`"value":9`), 1)
+				require.NoError(t, os.WriteFile(path, data, 0666))
+			},
+			want: 1,
+		},
+		{
+			name: "обрезанный снимок, берётся предыдущее поколение",
+			corrupt: func(t *testing.T, path string) {
+				require.NoError(t, os.Truncate(path, 10))
+			},
+			want: 1,
+		},
+		{
+			name: "все поколения испорчены",
+			corrupt: func(t *testing.T, path string) {
+				require.NoError(t, os.WriteFile(path, []byte("broken"), 0666))
+				require.NoError(t, os.WriteFile(path+".1", []byte("broken"), 0666))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.json")
+			mem := NewMemStorage()
+			disk := NewDiskStorage(mem, testLogger{}, path)
+			writeGauge(t, disk, mem, 1)
+			writeGauge(t, disk, mem, 2)
+			tt.corrupt(t, path)
+
+			restored := NewMemStorage()
+			NewDiskStorage(restored, testLogger{}, path).WriteToStorage()
+
+			value, err := restored.GetGaugeMetric(context.Background(), "Alloc")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+}
+
+func TestReadSnapshot_Legacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"id":"PollCount","type":"counter","delta":5}`+"\n"), 0666))
+
+	metrics, _, err := readSnapshotFile(path)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(5), *metrics[0].Delta)
+}
+
+func TestDiskStorage_WriteToDisk_OpenError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "metrics.json")
+	mem := NewMemStorage()
+	disk := NewDiskStorage(mem, testLogger{}, path)
+
+	assert.NotPanics(t, func() {
+		writeGauge(t, disk, mem, 1)
+		disk.WriteToStorage()
+	})
+}
+
+func TestDiskStorage_WriteToStorage_NotEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	src := NewMemStorage()
+	writeGauge(t, NewDiskStorage(src, testLogger{}, path), src, 1)
+
+	dst := NewMemStorage()
+	require.NoError(t, dst.SetGaugeMetric(context.Background(), "Alloc", 42))
+	NewDiskStorage(dst, testLogger{}, path).WriteToStorage()
+
+	value, err := dst.GetGaugeMetric(context.Background(), "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, models.Gauge(42), value, "снимок не затирает данные непустого хранилища")
+}
@@ -3,24 +3,117 @@ package storage
 import (
 	"context"
 	"fmt"
+	"hash/maphash"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
 )
 
+// memShards число секций MemStorage, степень двойки
+const memShards = 32
+
+// shardSeed общий для всех MemStorage, чтобы секция метрики не зависела от экземпляра
+var shardSeed = maphash.MakeSeed()
+
 type metricValue struct {
+	updatedAt time.Time
+	updatedBy string
+	// mType тип последней записи, пустой у значений без типа считается по counter
+	mType   string
 	gauge   models.Gauge
 	counter models.Counter
 }
 
-type MemStorage struct {
+// memShard часть метрик со своей блокировкой: записи в разные секции не ждут друг друга,
+// а чтения одной секции идут параллельно
+type memShard struct {
+	mu      sync.RWMutex
 	metrics map[string]metricValue
-	mtx     sync.Mutex
+}
+
+// MemStorage хранилище в памяти. Метрики разложены по секциям по хешу имени
+type MemStorage struct {
+	shards [memShards]memShard
+}
+
+func (ms *MemStorage) shard(name string) *memShard {
+	return &ms.shards[maphash.String(shardSeed, name)&(memShards-1)]
+}
+
+func (ms *MemStorage) load(name string) (metricValue, bool) {
+	sh := ms.shard(name)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	metric, exist := sh.metrics[name]
+
+	return metric, exist
+}
+
+// update меняет метрику под блокировкой её секции
+func (ms *MemStorage) update(name string, fn func(metric metricValue, exist bool) metricValue) {
+	sh := ms.shard(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if sh.metrics == nil {
+		sh.metrics = make(map[string]metricValue)
+	}
+	metric, exist := sh.metrics[name]
+	sh.metrics[name] = fn(metric, exist)
+}
+
+// snapshot копия всех метрик на один момент: секции блокируются на чтение все сразу,
+// поэтому снимок не смешивает записи до и после параллельной пачки
+func (ms *MemStorage) snapshot() map[string]metricValue {
+	size := 0
+	for i := range ms.shards {
+		ms.shards[i].mu.RLock()
+		size += len(ms.shards[i].metrics)
+	}
+	defer func() {
+		for i := range ms.shards {
+			ms.shards[i].mu.RUnlock()
+		}
+	}()
+
+	metrics := make(map[string]metricValue, size)
+	for i := range ms.shards {
+		for name, metric := range ms.shards[i].metrics {
+			metrics[name] = metric
+		}
+	}
+
+	return metrics
+}
+
+// lockShards блокирует на запись секции всех метрик пачки в порядке номеров,
+// чтобы параллельные пачки не ждали друг друга по кругу
+func (ms *MemStorage) lockShards(metrics []models.Metrics) func() {
+	var locked [memShards]bool
+	for _, m := range metrics {
+		locked[maphash.String(shardSeed, m.ID)&(memShards-1)] = true
+	}
+	for i := range ms.shards {
+		if locked[i] {
+			ms.shards[i].mu.Lock()
+		}
+	}
+
+	return func() {
+		for i := range ms.shards {
+			if locked[i] {
+				ms.shards[i].mu.Unlock()
+			}
+		}
+	}
 }
 
 func (ms *MemStorage) GetGaugeMetric(_ context.Context, name string) (models.Gauge, error) {
-	metric, exist := ms.metrics[name]
+	metric, exist := ms.load(name)
 	if exist {
 		return metric.gauge, nil
 	}
@@ -29,7 +122,7 @@ func (ms *MemStorage) GetGaugeMetric(_ context.Context, name string) (models.Gau
 }
 
 func (ms *MemStorage) GetCounterMetric(_ context.Context, name string) (models.Counter, error) {
-	metric, exist := ms.metrics[name]
+	metric, exist := ms.load(name)
 	if exist {
 		return metric.counter, nil
 	}
@@ -37,74 +130,66 @@ func (ms *MemStorage) GetCounterMetric(_ context.Context, name string) (models.C
 	return 0, fmt.Errorf("counter metric %s not found", name)
 }
 
-func (ms *MemStorage) SetGaugeMetric(_ context.Context, name string, value models.Gauge) error {
-	ms.mtx.Lock()
-	metric, exist := ms.metrics[name]
-	if exist {
+func (ms *MemStorage) SetGaugeMetric(ctx context.Context, name string, value models.Gauge) error {
+	ms.setGauge(name, value, identity.NameFromContext(ctx))
+
+	return nil
+}
+
+func (ms *MemStorage) setGauge(name string, value models.Gauge, updatedBy string) {
+	ms.update(name, func(metric metricValue, _ bool) metricValue {
 		metric.gauge = value
-		ms.metrics[name] = metric
-	} else {
-		if ms.metrics == nil {
-			ms.metrics = make(map[string]metricValue)
-		}
-		ms.metrics[name] = metricValue{
-			gauge: value,
-		}
-	}
+		metric.mType = models.GaugeType
+		metric.updatedBy = updatedBy
+		metric.updatedAt = time.Now()
+
+		return metric
+	})
+}
 
-	ms.mtx.Unlock()
+func (ms *MemStorage) SetCounterMetric(ctx context.Context, name string, value models.Counter) error {
+	ms.setCounter(name, value, identity.NameFromContext(ctx))
 
 	return nil
 }
 
-func (ms *MemStorage) SetCounterMetric(_ context.Context, name string, value models.Counter) error {
-	ms.mtx.Lock()
-	metric, exist := ms.metrics[name]
-	if exist {
+func (ms *MemStorage) setCounter(name string, value models.Counter, updatedBy string) {
+	ms.update(name, func(metric metricValue, _ bool) metricValue {
 		metric.counter += value
-		ms.metrics[name] = metric
-	} else {
-		if ms.metrics == nil {
-			ms.metrics = make(map[string]metricValue)
-		}
-		ms.metrics[name] = metricValue{
-			counter: value,
-		}
-	}
-
-	ms.mtx.Unlock()
+		metric.mType = models.CounterType
+		metric.updatedBy = updatedBy
+		metric.updatedAt = time.Now()
 
-	return nil
+		return metric
+	})
 }
 
+// SetMetric записывает метрику, автором считается m.UpdatedBy, а если он пуст, клиент из контекста
 func (ms *MemStorage) SetMetric(ctx context.Context, m models.Metrics) error {
-	if m.MType == models.CounterType {
-		err := ms.SetCounterMetric(ctx, m.ID, models.Counter(*m.Delta))
-		if err != nil {
-			return fmt.Errorf("can not SetCounterMetric: %w", err)
-		}
+	_, err := ms.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{m}})
 
-		return nil
-	}
+	return err
+}
 
-	err := ms.SetGaugeMetric(ctx, m.ID, models.Gauge(*m.Value))
-	if err != nil {
-		return fmt.Errorf("can not SetGaugeMetric: %w", err)
+// isCounter тип метрики по последней записи, у значений без типа counter определяется по ненулевому значению
+func (metric metricValue) isCounter() bool {
+	if metric.mType != "" {
+		return metric.mType == models.CounterType
 	}
 
-	return nil
+	return metric.counter != 0
 }
 
 func getMetricsModel(_ context.Context, name string, metric metricValue) models.Metrics {
-	if metric.counter != 0 {
-		return models.Metrics{ID: name, MType: models.CounterType, Delta: (*int64)(&metric.counter)}
+	if metric.isCounter() {
+		return models.Metrics{ID: name, MType: models.CounterType, Delta: (*int64)(&metric.counter), UpdatedBy: metric.updatedBy}
 	}
 
-	return models.Metrics{ID: name, MType: models.GaugeType, Value: (*float64)(&metric.gauge)}
+	return models.Metrics{ID: name, MType: models.GaugeType, Value: (*float64)(&metric.gauge), UpdatedBy: metric.updatedBy}
 }
 
 func (ms *MemStorage) GetMetric(ctx context.Context, name string) (models.Metrics, error) {
-	metric, exist := ms.metrics[name]
+	metric, exist := ms.load(name)
 	if exist {
 		return getMetricsModel(ctx, name, metric), nil
 	}
@@ -113,20 +198,90 @@ func (ms *MemStorage) GetMetric(ctx context.Context, name string) (models.Metric
 }
 
 func (ms *MemStorage) GetMetricsModels(ctx context.Context) []models.Metrics {
-	models := make([]models.Metrics, 0, len(ms.metrics))
-	for k := range ms.metrics {
-		model, _ := ms.GetMetric(ctx, k)
-		models = append(models, model)
+	metrics := ms.snapshot()
+	models := make([]models.Metrics, 0, len(metrics))
+	for k, v := range metrics {
+		models = append(models, getMetricsModel(ctx, k, v))
 	}
 
 	return models
 }
 
+// ExportMetrics выгружает все метрики для снимка
+func (ms *MemStorage) ExportMetrics(ctx context.Context) ([]models.Metrics, error) {
+	return ms.GetMetricsModels(ctx), nil
+}
+
+// ImportMetrics заменяет значения метрик значениями из снимка, counter не суммируется с текущим
+func (ms *MemStorage) ImportMetrics(_ context.Context, metrics []models.Metrics) error {
+	for _, m := range metrics {
+		if err := validateMetric(m); err != nil {
+			return err
+		}
+	}
+
+	// в снимке нет времени записи, восстановленные метрики считаются обновлёнными сейчас
+	now := time.Now()
+	for _, m := range metrics {
+		value := metricValue{updatedBy: m.UpdatedBy, updatedAt: now}
+		if m.MType == models.CounterType {
+			value.counter = models.Counter(*m.Delta)
+			value.mType = models.CounterType
+		} else {
+			value.gauge = models.Gauge(*m.Value)
+			value.mType = models.GaugeType
+		}
+		ms.update(m.ID, func(metricValue, bool) metricValue {
+			return value
+		})
+	}
+
+	return nil
+}
+
+// LastUpdated время последней записи каждой метрики
+func (ms *MemStorage) LastUpdated(context.Context) (map[string]time.Time, error) {
+	metrics := ms.snapshot()
+	updated := make(map[string]time.Time, len(metrics))
+	for name, metric := range metrics {
+		updated[name] = metric.updatedAt
+	}
+
+	return updated, nil
+}
+
+// ExpireMetrics удаляет из names метрики, не обновлявшиеся с before, и возвращает удалённые
+func (ms *MemStorage) ExpireMetrics(_ context.Context, names []string, before time.Time) ([]string, error) {
+	var expired []string
+	for _, name := range names {
+		sh := ms.shard(name)
+		sh.mu.Lock()
+		metric, exist := sh.metrics[name]
+		if exist && metric.updatedAt.Before(before) {
+			delete(sh.metrics, name)
+			expired = append(expired, name)
+		}
+		sh.mu.Unlock()
+	}
+
+	return expired, nil
+}
+
+// remove удаляет метрику независимо от времени её записи
+func (ms *MemStorage) remove(name string) {
+	sh := ms.shard(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	delete(sh.metrics, name)
+}
+
 func (ms *MemStorage) GetAllMetrics(_ context.Context) []string {
-	result := make([]string, len(ms.metrics))
+	metrics := ms.snapshot()
+	result := make([]string, len(metrics))
 
-	keys := make([]string, 0, len(ms.metrics))
-	for k := range ms.metrics {
+	keys := make([]string, 0, len(metrics))
+	for k := range metrics {
 		keys = append(keys, k)
 	}
 
@@ -134,8 +289,8 @@ func (ms *MemStorage) GetAllMetrics(_ context.Context) []string {
 
 	i := 0
 	for _, k := range keys {
-		v := ms.metrics[k]
-		if v.counter != 0 {
+		v := metrics[k]
+		if v.isCounter() {
 			result[i] = fmt.Sprintf("%v: %v", k, v.counter)
 		} else {
 			result[i] = fmt.Sprintf("%v: %v", k, v.gauge)
@@ -148,7 +303,9 @@ func (ms *MemStorage) GetAllMetrics(_ context.Context) []string {
 
 func NewMemStorage() *MemStorage {
 	storage := new(MemStorage)
-	storage.metrics = make(map[string]metricValue)
+	for i := range storage.shards {
+		storage.shards[i].metrics = make(map[string]metricValue)
+	}
 
 	return storage
 }
@@ -157,13 +314,44 @@ func (ms *MemStorage) GetIsDBConnected() bool {
 	return false
 }
 
+// UpsertMetrics применяет пачку целиком или не применяет совсем: сначала проверяются все
+// метрики, затем повторы сводятся, как в DBStorage, и пачка записывается под блокировкой
+// всех её секций, так что читатели не видят её частично. Возвращает накопленные значения
+// по одной метрике в порядке первого появления
 func (ms *MemStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
+	batch := make([]models.Metrics, 0, len(metricCollection.Metrics))
 	for _, m := range metricCollection.Metrics {
-		err := ms.SetMetric(ctx, m)
-		if err != nil {
-			return metricCollection, fmt.Errorf("can not SetMetric: %w", err)
+		if err := validateMetric(m); err != nil {
+			return *models.NewMetricCollection(), fmt.Errorf("can not SetMetric: %w", err)
+		}
+		m.UpdatedBy = updatedBy(ctx, m)
+		batch = append(batch, m)
+	}
+	aggregated := aggregateMetrics(batch)
+
+	unlock := ms.lockShards(aggregated)
+	defer unlock()
+
+	now := time.Now()
+	upserted := make([]models.Metrics, 0, len(aggregated))
+	for _, m := range aggregated {
+		sh := ms.shard(m.ID)
+		if sh.metrics == nil {
+			sh.metrics = make(map[string]metricValue)
+		}
+		metric := sh.metrics[m.ID]
+		if m.MType == models.CounterType {
+			metric.counter += models.Counter(*m.Delta)
+			metric.mType = models.CounterType
+		} else {
+			metric.gauge = models.Gauge(*m.Value)
+			metric.mType = models.GaugeType
 		}
+		metric.updatedBy = m.UpdatedBy
+		metric.updatedAt = now
+		sh.metrics[m.ID] = metric
+		upserted = append(upserted, getMetricsModel(ctx, m.ID, metric))
 	}
 
-	return metricCollection, nil
+	return models.MetricCollection{Metrics: upserted}, nil
 }
@@ -3,10 +3,16 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMemStorage_SetMetric(t *testing.T) {
@@ -22,7 +28,7 @@ func TestMemStorage_SetMetric(t *testing.T) {
 		t.Errorf("failed to SetMetric: %v", err)
 	}
 
-	metric, exist := ms.metrics["foo"]
+	metric, exist := ms.load("foo")
 	assert.True(t, exist, "метрика не найдена в хранилище")
 	assert.Equal(t, models.Gauge(*mockModel.Value), metric.gauge, "метрика не соответствует установленной")
 }
@@ -42,12 +48,9 @@ func TestMemStorage_GetMetric(t *testing.T) {
 			Delta: &barValue,
 		},
 	}
-	ms := &MemStorage{
-		metrics: map[string]metricValue{
-			"foo": {gauge: models.Gauge(fooValue)},
-			"bar": {counter: models.Counter(barValue)},
-		},
-	}
+	ms := &MemStorage{}
+	ms.update("foo", func(metricValue, bool) metricValue { return metricValue{gauge: models.Gauge(fooValue)} })
+	ms.update("bar", func(metricValue, bool) metricValue { return metricValue{counter: models.Counter(barValue)} })
 
 	testCases := []struct {
 		name     string
@@ -242,3 +245,161 @@ func TestMemStorage_GetAllMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_SetMetric_UpdatedBy(t *testing.T) {
+	ms := NewMemStorage()
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{Name: "agent-1", Source: identity.SourceToken})
+	value := 1.5
+	delta := int64(2)
+
+	assert.NoError(t, ms.SetMetric(ctx, models.Metrics{ID: "gauge", MType: "gauge", Value: &value}))
+	assert.NoError(t, ms.SetMetric(context.Background(), models.Metrics{ID: "counter", MType: "counter", Delta: &delta, UpdatedBy: "agent-2"}))
+
+	gauge, err := ms.GetMetric(ctx, "gauge")
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", gauge.UpdatedBy)
+
+	counter, err := ms.GetMetric(ctx, "counter")
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-2", counter.UpdatedBy)
+}
+
+func TestMemStorage_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	src := NewMemStorage()
+	assert.NoError(t, src.SetCounterMetric(ctx, "PollCount", 5))
+	assert.NoError(t, src.SetGaugeMetric(ctx, "Alloc", 1.5))
+
+	exported, err := src.ExportMetrics(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, exported, 2)
+
+	dst := NewMemStorage()
+	assert.NoError(t, dst.SetCounterMetric(ctx, "PollCount", 100))
+	assert.NoError(t, dst.ImportMetrics(ctx, exported))
+
+	counter, err := dst.GetCounterMetric(ctx, "PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Counter(5), counter, "counter из снимка заменяет текущее значение")
+
+	gauge, err := dst.GetGaugeMetric(ctx, "Alloc")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Gauge(1.5), gauge)
+
+	err = dst.ImportMetrics(ctx, []models.Metrics{{ID: "broken", MType: models.CounterType}})
+	assert.Error(t, err)
+}
+
+func TestMemStorage_ExpireMetrics(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	require.NoError(t, ms.SetGaugeMetric(ctx, "Alloc", 1))
+	require.NoError(t, ms.SetCounterMetric(ctx, "PollCount", 1))
+
+	updated, err := ms.LastUpdated(ctx)
+	require.NoError(t, err)
+	require.Len(t, updated, 2)
+	assert.False(t, updated["Alloc"].IsZero())
+
+	expired, err := ms.ExpireMetrics(ctx, []string{"Alloc"}, updated["Alloc"])
+	require.NoError(t, err)
+	assert.Empty(t, expired, "метрика, записанная в before, не устарела")
+
+	expired, err = ms.ExpireMetrics(ctx, []string{"Alloc", "Missing"}, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc"}, expired)
+	assert.Equal(t, []string{"PollCount: 1"}, ms.GetAllMetrics(ctx))
+}
+
+func TestMemStorage_ConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMemStorage()
+	const writers, batches = 8, 100
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := benchBatch(20, "")
+			for i := 0; i < batches; i++ {
+				_, err := ms.UpsertMetrics(ctx, batch)
+				assert.NoError(t, err)
+			}
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < batches; i++ {
+				ms.GetAllMetrics(ctx)
+				_, _ = ms.ExportMetrics(ctx)
+				_, _ = ms.GetMetric(ctx, "counter0")
+			}
+		}()
+	}
+	wg.Wait()
+
+	counter, err := ms.GetCounterMetric(ctx, "counter0")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(writers*batches), counter)
+	assert.Len(t, ms.GetAllMetrics(ctx), 20)
+}
+
+// benchBatch пачка из n метрик, половина counter с delta 1, половина gauge
+func benchBatch(n int, prefix string) models.MetricCollection {
+	batch := models.MetricCollection{Metrics: make([]models.Metrics, 0, n)}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			batch.Metrics = append(batch.Metrics, models.Metrics{ID: fmt.Sprintf("%scounter%d", prefix, i/2), MType: models.CounterType, Delta: ptr(int64(1))})
+			continue
+		}
+		batch.Metrics = append(batch.Metrics, models.Metrics{ID: fmt.Sprintf("%sgauge%d", prefix, i/2), MType: models.GaugeType, Value: ptr(float64(i))})
+	}
+
+	return batch
+}
+
+// BenchmarkMemStorage_UpsertMetrics пропускная способность параллельных пачек:
+// shared все горутины пишут одни и те же метрики, distinct у каждой свои,
+// with-readers половина горутин читает, пока остальные пишут
+func BenchmarkMemStorage_UpsertMetrics(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("shared", func(b *testing.B) {
+		ms := NewMemStorage()
+		batch := benchBatch(64, "")
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = ms.UpsertMetrics(ctx, batch)
+			}
+		})
+	})
+
+	b.Run("distinct", func(b *testing.B) {
+		ms := NewMemStorage()
+		var id atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			batch := benchBatch(64, fmt.Sprintf("g%d-", id.Add(1)))
+			for pb.Next() {
+				_, _ = ms.UpsertMetrics(ctx, batch)
+			}
+		})
+	})
+
+	b.Run("with-readers", func(b *testing.B) {
+		ms := NewMemStorage()
+		batch := benchBatch(64, "")
+		_, _ = ms.UpsertMetrics(ctx, batch)
+		var id atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			reader := id.Add(1)%2 == 0
+			for pb.Next() {
+				if reader {
+					_, _ = ms.GetMetric(ctx, "counter0")
+					continue
+				}
+				_, _ = ms.UpsertMetrics(ctx, batch)
+			}
+		})
+	})
+}
@@ -0,0 +1,425 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/proto"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Форматы снимка
+const (
+	// FormatJSON по строке JSON на метрику
+	FormatJSON = "json"
+	// FormatBinary метрики proto.Metric с префиксом длины в uvarint
+	FormatBinary = "binary"
+)
+
+// SnapshotVersion текущая версия формата снимка, пишется в заголовок.
+// Версия 2 добавила в заголовок номер последней записи журнала, вошедшей в снимок
+const SnapshotVersion = 2
+
+// minSnapshotVersion самая старая версия снимка, которая ещё читается
+const minSnapshotVersion = 1
+
+// binaryMagic начало бинарного снимка, за ним один байт версии
+var binaryMagic = []byte("MSNB")
+
+var (
+	// ErrSnapshotCorrupt контрольная сумма или содержимое снимка не сходятся
+	ErrSnapshotCorrupt = errors.New("snapshot is corrupt")
+	// ErrSnapshotVersion снимок записан более новой версией сервера
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+	// ErrSnapshotFormat неизвестный формат снимка
+	ErrSnapshotFormat = errors.New("unknown snapshot format")
+)
+
+// ValidSnapshotFormat проверяет название формата снимка
+func ValidSnapshotFormat(format string) error {
+	switch format {
+	case FormatJSON, FormatBinary:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrSnapshotFormat, format)
+}
+
+// snapshotMeta служебные строки JSON снимка: заголовок с версией и завершающая строка
+// с SHA-256 всего, что записано до неё
+type snapshotMeta struct {
+	Checksum string `json:"checksum,omitempty"`
+	Version  int    `json:"version,omitempty"`
+	Count    int    `json:"count,omitempty"`
+	WALSeq   uint64 `json:"wal_seq,omitempty"`
+}
+
+// Producer потоково пишет снимок в выбранном формате и считает его контрольную сумму
+type Producer struct {
+	writer *bufio.Writer
+	hash   hash.Hash
+	out    io.Writer
+	format string
+	count  int
+}
+
+// NewProducer пишет заголовок снимка формата format в w
+func NewProducer(w io.Writer, format string) (*Producer, error) {
+	return newProducer(w, format, 0)
+}
+
+// newProducer пишет в заголовок walSeq, номер последней записи журнала, вошедшей в снимок
+func newProducer(w io.Writer, format string, walSeq uint64) (*Producer, error) {
+	if err := ValidSnapshotFormat(format); err != nil {
+		return nil, err
+	}
+
+	writer := bufio.NewWriter(w)
+	h := sha256.New()
+	p := &Producer{
+		writer: writer,
+		hash:   h,
+		out:    io.MultiWriter(writer, h),
+		format: format,
+	}
+
+	var err error
+	if format == FormatBinary {
+		header := append(append([]byte{}, binaryMagic...), SnapshotVersion)
+		_, err = p.out.Write(binary.AppendUvarint(header, walSeq))
+	} else {
+		err = json.NewEncoder(p.out).Encode(snapshotMeta{Version: SnapshotVersion, WALSeq: walSeq})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot write snapshot header: %w", err)
+	}
+
+	return p, nil
+}
+
+func (p *Producer) WriteMetric(metric models.Metrics) error {
+	if p.format == FormatBinary {
+		data, err := protobuf.Marshal(toProtoMetric(metric))
+		if err != nil {
+			return err
+		}
+		if _, err := p.out.Write(binary.AppendUvarint(nil, uint64(len(data)))); err != nil {
+			return err
+		}
+		if _, err := p.out.Write(data); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(p.out).Encode(&metric); err != nil {
+		return err
+	}
+	p.count++
+
+	return nil
+}
+
+// Finish дописывает число метрик и контрольную сумму и сбрасывает буфер в w
+func (p *Producer) Finish() error {
+	sum := p.hash.Sum(nil)
+
+	var err error
+	if p.format == FormatBinary {
+		// нулевая длина отмечает конец записей
+		trailer := binary.AppendUvarint(nil, 0)
+		trailer = binary.AppendUvarint(trailer, uint64(p.count))
+		_, err = p.writer.Write(append(trailer, sum...))
+	} else {
+		err = json.NewEncoder(p.writer).Encode(snapshotMeta{Checksum: hex.EncodeToString(sum), Count: p.count})
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.writer.Flush()
+}
+
+// Consumer потоково читает снимок любого формата, формат определяется по заголовку.
+// Контрольная сумма проверяется при достижении конца снимка, поэтому метрики
+// нельзя применять до того, как ReadMetric вернул io.EOF
+type Consumer struct {
+	reader *bufio.Reader
+	hash   hash.Hash
+	format string
+	count  int
+	walSeq uint64
+	// versioned снимок с заголовком обязан заканчиваться контрольной суммой,
+	// снимки старого формата без заголовка читаются как есть
+	versioned bool
+	done      bool
+}
+
+func NewConsumer(r io.Reader) (*Consumer, error) {
+	c := &Consumer{
+		reader: bufio.NewReader(r),
+		hash:   sha256.New(),
+		format: FormatJSON,
+	}
+
+	magic, err := c.reader.Peek(len(binaryMagic) + 1)
+	if err == nil && bytes.Equal(magic[:len(binaryMagic)], binaryMagic) {
+		version := int(magic[len(binaryMagic)])
+		if version < minSnapshotVersion || version > SnapshotVersion {
+			return nil, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+		}
+		c.hash.Write(magic)
+		if _, err := c.reader.Discard(len(magic)); err != nil {
+			return nil, err
+		}
+		if version >= 2 {
+			prefix := &recordingReader{r: c.reader}
+			if c.walSeq, err = binary.ReadUvarint(prefix); err != nil {
+				return nil, corrupt(err)
+			}
+			c.hash.Write(prefix.read)
+		}
+		c.format = FormatBinary
+		c.versioned = true
+	}
+
+	return c, nil
+}
+
+// Format формат читаемого снимка
+func (c *Consumer) Format() string {
+	return c.format
+}
+
+// WALSeq номер последней записи журнала, вошедшей в снимок, 0 у снимков без журнала.
+// У JSON снимка он известен после первого ReadMetric
+func (c *Consumer) WALSeq() uint64 {
+	return c.walSeq
+}
+
+// ReadMetric возвращает следующую метрику или io.EOF, если снимок прочитан и проверен
+func (c *Consumer) ReadMetric() (models.Metrics, error) {
+	if c.done {
+		return models.Metrics{}, io.EOF
+	}
+	if c.format == FormatBinary {
+		return c.readBinary()
+	}
+
+	return c.readJSON()
+}
+
+func (c *Consumer) readBinary() (models.Metrics, error) {
+	prefix := &recordingReader{r: c.reader}
+	size, err := binary.ReadUvarint(prefix)
+	if err != nil {
+		return models.Metrics{}, corrupt(err)
+	}
+
+	if size == 0 {
+		count, err := binary.ReadUvarint(c.reader)
+		if err != nil {
+			return models.Metrics{}, corrupt(err)
+		}
+		sum := make([]byte, sha256.Size)
+		if _, err := io.ReadFull(c.reader, sum); err != nil {
+			return models.Metrics{}, corrupt(err)
+		}
+		if err := c.verify(sum, int(count)); err != nil {
+			return models.Metrics{}, err
+		}
+		return models.Metrics{}, io.EOF
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return models.Metrics{}, corrupt(err)
+	}
+	c.hash.Write(prefix.read)
+	c.hash.Write(data)
+
+	var metric proto.Metric
+	if err := protobuf.Unmarshal(data, &metric); err != nil {
+		return models.Metrics{}, corrupt(err)
+	}
+	c.count++
+
+	return fromProtoMetric(&metric), nil
+}
+
+func (c *Consumer) readJSON() (models.Metrics, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return models.Metrics{}, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			if errors.Is(err, io.EOF) {
+				if c.versioned {
+					return models.Metrics{}, fmt.Errorf("%w: missing checksum", ErrSnapshotCorrupt)
+				}
+				c.done = true
+				return models.Metrics{}, io.EOF
+			}
+			continue
+		}
+
+		var meta snapshotMeta
+		if json.Unmarshal(line, &meta) == nil && (meta.Checksum != "" || meta.Version != 0) {
+			if meta.Checksum != "" {
+				sum, err := hex.DecodeString(meta.Checksum)
+				if err != nil {
+					return models.Metrics{}, corrupt(err)
+				}
+				if err := c.verify(sum, meta.Count); err != nil {
+					return models.Metrics{}, err
+				}
+				return models.Metrics{}, io.EOF
+			}
+			if c.count > 0 || c.versioned {
+				return models.Metrics{}, fmt.Errorf("%w: unexpected header", ErrSnapshotCorrupt)
+			}
+			if meta.Version < minSnapshotVersion || meta.Version > SnapshotVersion {
+				return models.Metrics{}, fmt.Errorf("%w: %d", ErrSnapshotVersion, meta.Version)
+			}
+			c.walSeq = meta.WALSeq
+			c.versioned = true
+			c.hash.Write(line)
+			continue
+		}
+
+		var metric models.Metrics
+		if err := json.Unmarshal(line, &metric); err != nil {
+			return models.Metrics{}, corrupt(err)
+		}
+		c.hash.Write(line)
+		c.count++
+
+		return metric, nil
+	}
+}
+
+func (c *Consumer) verify(sum []byte, count int) error {
+	if !bytes.Equal(sum, c.hash.Sum(nil)) {
+		return fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+	if count != c.count {
+		return fmt.Errorf("%w: expected %d metrics, got %d", ErrSnapshotCorrupt, count, c.count)
+	}
+	c.done = true
+
+	return nil
+}
+
+// ReadSnapshot читает снимок целиком и проверяет его контрольную сумму
+func ReadSnapshot(r io.Reader) ([]models.Metrics, error) {
+	metrics, _, err := readSnapshot(r)
+
+	return metrics, err
+}
+
+// readSnapshot как ReadSnapshot, но возвращает и номер последней записи журнала из заголовка
+func readSnapshot(r io.Reader) ([]models.Metrics, uint64, error) {
+	consumer, err := NewConsumer(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var metrics []models.Metrics
+	for {
+		metric, err := consumer.ReadMetric()
+		if errors.Is(err, io.EOF) {
+			return metrics, consumer.WALSeq(), nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		metrics = append(metrics, metric)
+	}
+}
+
+// ConvertSnapshot перекладывает снимок из src в dst в формате format
+// и возвращает число метрик. Исходный снимок проверяется до записи в dst
+func ConvertSnapshot(src io.Reader, dst io.Writer, format string) (int, error) {
+	metrics, err := ReadSnapshot(src)
+	if err != nil {
+		return 0, err
+	}
+
+	producer, err := NewProducer(dst, format)
+	if err != nil {
+		return 0, err
+	}
+	for _, metric := range metrics {
+		if err := producer.WriteMetric(metric); err != nil {
+			return 0, fmt.Errorf("cannot encode: %w", err)
+		}
+	}
+	if err := producer.Finish(); err != nil {
+		return 0, err
+	}
+
+	return len(metrics), nil
+}
+
+func toProtoMetric(m models.Metrics) *proto.Metric {
+	metric := &proto.Metric{
+		Id:        m.ID,
+		Type:      m.MType,
+		UpdatedBy: m.UpdatedBy,
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+
+	return metric
+}
+
+func fromProtoMetric(m *proto.Metric) models.Metrics {
+	metric := models.Metrics{
+		ID:        m.GetId(),
+		MType:     m.GetType(),
+		UpdatedBy: m.GetUpdatedBy(),
+	}
+	if metric.MType == models.CounterType {
+		delta := m.GetDelta()
+		metric.Delta = &delta
+	} else {
+		value := m.GetValue()
+		metric.Value = &value
+	}
+
+	return metric
+}
+
+func corrupt(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w: %w", ErrSnapshotCorrupt, err)
+}
+
+// recordingReader запоминает прочитанные байты префикса длины для контрольной суммы
+type recordingReader struct {
+	r    io.ByteReader
+	read []byte
+}
+
+func (c *recordingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.read = append(c.read, b)
+	}
+
+	return b, err
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics(n int) []models.Metrics {
+	metrics := make([]models.Metrics, 0, n)
+	for i := 0; i < n; i++ {
+		value := float64(i) + 0.5
+		delta := int64(i)
+		if i%2 == 0 {
+			metrics = append(metrics, models.Metrics{ID: fmt.Sprintf("gauge%d", i), MType: models.GaugeType, Value: &value, UpdatedBy: "agent"})
+		} else {
+			metrics = append(metrics, models.Metrics{ID: fmt.Sprintf("counter%d", i), MType: models.CounterType, Delta: &delta})
+		}
+	}
+
+	return metrics
+}
+
+func encodeSnapshot(t *testing.T, format string, metrics []models.Metrics) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	require.NoError(t, writeMetrics(&buf, format, metrics, 0))
+
+	return buf.Bytes()
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	metrics := testMetrics(100)
+
+	for _, format := range []string{FormatJSON, FormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			consumer, err := NewConsumer(bytes.NewReader(encodeSnapshot(t, format, metrics)))
+			require.NoError(t, err)
+			assert.Equal(t, format, consumer.Format())
+
+			got, err := ReadSnapshot(bytes.NewReader(encodeSnapshot(t, format, metrics)))
+			require.NoError(t, err)
+			assert.Equal(t, metrics, got)
+		})
+	}
+
+	assert.Less(t, len(encodeSnapshot(t, FormatBinary, metrics)), len(encodeSnapshot(t, FormatJSON, metrics)))
+}
+
+func TestSnapshot_Corrupt(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		corrupt func([]byte) []byte
+		wantErr error
+	}{
+		{
+			name:    "json: обрезан конец",
+			format:  FormatJSON,
+			corrupt: func(data []byte) []byte { return data[:len(data)-20] },
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:    "json: потеряна строка с контрольной суммой",
+			format:  FormatJSON,
+			corrupt: func(data []byte) []byte { return data[:bytes.LastIndexByte(data[:len(data)-1], '\n')+1] },
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:   "json: неизвестная версия",
+			format: FormatJSON,
+			corrupt: func(data []byte) []byte {
+				return bytes.Replace(data, []byte(`{"version":2}`), []byte(`{"version":7}`), 1)
+			},
+			wantErr: ErrSnapshotVersion,
+		},
+		{
+			name:    "binary: обрезан конец",
+			format:  FormatBinary,
+			corrupt: func(data []byte) []byte { return data[:len(data)-40] },
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:   "binary: испорчен байт",
+			format: FormatBinary,
+			corrupt: func(data []byte) []byte {
+				data[20] ^= 0xff
+				return data
+			},
+			wantErr: ErrSnapshotCorrupt,
+		},
+		{
+			name:   "binary: неизвестная версия",
+			format: FormatBinary,
+			corrupt: func(data []byte) []byte {
+				data[len(binaryMagic)] = 7
+				return data
+			},
+			wantErr: ErrSnapshotVersion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(encodeSnapshot(t, tt.format, testMetrics(10)))
+
+			_, err := ReadSnapshot(bytes.NewReader(data))
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSnapshot_ChecksumWithoutHeader(t *testing.T) {
+	line := `{"delta":5,"id":"PollCount","type":"counter"}` + "\n"
+	sum := sha256.Sum256([]byte(line))
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{name: "сумма сходится", checksum: hex.EncodeToString(sum[:])},
+		{name: "сумма не сходится", checksum: strings.Repeat("0", sha256.Size*2), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := line + `{"checksum":"` + tt.checksum + `","count":1}` + "\n"
+
+			metrics, err := ReadSnapshot(strings.NewReader(data))
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrSnapshotCorrupt)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, metrics, 1)
+			assert.Equal(t, int64(5), *metrics[0].Delta)
+		})
+	}
+}
+
+func TestConvertSnapshot(t *testing.T) {
+	metrics := testMetrics(20)
+	jsonData := encodeSnapshot(t, FormatJSON, metrics)
+
+	var binaryData bytes.Buffer
+	n, err := ConvertSnapshot(bytes.NewReader(jsonData), &binaryData, FormatBinary)
+	require.NoError(t, err)
+	assert.Equal(t, len(metrics), n)
+
+	var back bytes.Buffer
+	_, err = ConvertSnapshot(bytes.NewReader(binaryData.Bytes()), &back, FormatJSON)
+	require.NoError(t, err)
+	assert.Equal(t, jsonData, back.Bytes())
+
+	_, err = ConvertSnapshot(bytes.NewReader(jsonData), &back, "xml")
+	assert.ErrorIs(t, err, ErrSnapshotFormat)
+}
+
+func TestSnapshot_WALSeq(t *testing.T) {
+	for _, format := range []string{FormatJSON, FormatBinary} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeMetrics(&buf, format, testMetrics(3), 42))
+
+			metrics, walSeq, err := readSnapshot(&buf)
+			require.NoError(t, err)
+			assert.Len(t, metrics, 3)
+			assert.Equal(t, uint64(42), walSeq)
+		})
+	}
+}
+
+func TestSnapshot_Version1(t *testing.T) {
+	header := `{"version":1}` + "\n"
+	line := `{"delta":5,"id":"PollCount","type":"counter"}` + "\n"
+	sum := sha256.Sum256([]byte(header + line))
+	data := header + line + `{"checksum":"` + hex.EncodeToString(sum[:]) + `","count":1}` + "\n"
+
+	metrics, walSeq, err := readSnapshot(strings.NewReader(data))
+	require.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Zero(t, walSeq, "снимок первой версии не знает о журнале")
+}
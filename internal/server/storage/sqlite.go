@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/NikolosHGW/metric/internal/models"
+)
+
+// upsertSQLite та же семантика, что и у DBStorage: counter прибавляется к накопленному,
+// gauge заменяется
+const upsertSQLite = `INSERT INTO metrics (id, type, delta, value, updated_by, updated_at)
+	VALUES (?, ?, ?, ?, NULLIF(?, ''), CAST(strftime('%s', 'now') AS INTEGER))
+	ON CONFLICT (id) DO UPDATE SET
+		type = excluded.type,
+		delta = COALESCE(metrics.delta, 0) + excluded.delta,
+		value = excluded.value,
+		updated_by = excluded.updated_by,
+		updated_at = excluded.updated_at`
+
+// SQLiteStorage хранилище во встроенной базе SQLite для установки из одного сервера.
+// Соединение с базой одно (см. db.InitSQLite), поэтому отдельная блокировка не нужна
+type SQLiteStorage struct {
+	sql *sqlx.DB
+	log customLogger
+}
+
+func NewSQLiteStorage(sql *sqlx.DB, log customLogger) *SQLiteStorage {
+	return &SQLiteStorage{
+		sql: sql,
+		log: log,
+	}
+}
+
+// SetMetric записывает метрику, автором считается m.UpdatedBy, а если он пуст, клиент из контекста
+func (ss *SQLiteStorage) SetMetric(ctx context.Context, m models.Metrics) error {
+	_, err := ss.sql.ExecContext(ctx, upsertSQLite, m.ID, m.MType, m.Delta, m.Value, updatedBy(ctx, m))
+
+	return err
+}
+
+func (ss *SQLiteStorage) GetMetric(ctx context.Context, name string) (models.Metrics, error) {
+	model := models.Metrics{}
+	err := ss.sql.QueryRowxContext(
+		ctx,
+		"SELECT id, type, delta, value, COALESCE(updated_by, '') FROM metrics WHERE id = ?",
+		name,
+	).Scan(&model.ID, &model.MType, &model.Delta, &model.Value, &model.UpdatedBy)
+	if err != nil {
+		ss.log.Info("cannot scan row when getting metric", zap.Error(err))
+	}
+
+	return model, err
+}
+
+func (ss *SQLiteStorage) SetGaugeMetric(ctx context.Context, name string, value models.Gauge) error {
+	return ss.SetMetric(ctx, models.Metrics{
+		ID:    name,
+		MType: models.GaugeType,
+		Value: (*float64)(&value),
+	})
+}
+
+func (ss *SQLiteStorage) SetCounterMetric(ctx context.Context, name string, value models.Counter) error {
+	return ss.SetMetric(ctx, models.Metrics{
+		ID:    name,
+		MType: models.CounterType,
+		Delta: (*int64)(&value),
+	})
+}
+
+func (ss *SQLiteStorage) GetGaugeMetric(ctx context.Context, name string) (models.Gauge, error) {
+	metric, err := ss.GetMetric(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if metric.Value == nil {
+		return 0, fmt.Errorf("%s is not a gauge", name)
+	}
+
+	return models.Gauge(*metric.Value), nil
+}
+
+func (ss *SQLiteStorage) GetCounterMetric(ctx context.Context, name string) (models.Counter, error) {
+	metric, err := ss.GetMetric(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if metric.Delta == nil {
+		return 0, fmt.Errorf("%s is not a counter", name)
+	}
+
+	return models.Counter(*metric.Delta), nil
+}
+
+func (ss *SQLiteStorage) GetAllMetrics(ctx context.Context) []string {
+	var metricStrings []string
+
+	metrics, err := ss.ExportMetrics(ctx)
+	if err != nil {
+		ss.log.Info("cannot get all metric", zap.Error(err))
+		return metricStrings
+	}
+
+	for _, m := range metrics {
+		var result string
+		if m.MType == models.GaugeType && m.Value != nil {
+			result = fmt.Sprintf("%v", *m.Value)
+		} else if m.Delta != nil {
+			result = fmt.Sprintf("%v", *m.Delta)
+		}
+		metricStrings = append(metricStrings, fmt.Sprintf("%v: %v", m.ID, result))
+	}
+
+	return metricStrings
+}
+
+func (ss *SQLiteStorage) GetIsDBConnected() bool {
+	return ss.sql.DB.Ping() == nil
+}
+
+// UpsertMetrics записывает пачку в одной транзакции. Повторы сводятся, как в DBStorage,
+// и возвращаются накопленные значения по одной метрике в порядке первого появления
+func (ss *SQLiteStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
+	batch := make([]models.Metrics, 0, len(metricCollection.Metrics))
+	for _, metric := range metricCollection.Metrics {
+		if err := validateMetric(metric); err != nil {
+			return *models.NewMetricCollection(), err
+		}
+		metric.UpdatedBy = updatedBy(ctx, metric)
+		batch = append(batch, metric)
+	}
+
+	tx, err := ss.sql.BeginTxx(ctx, nil)
+	if err != nil {
+		return *models.NewMetricCollection(), err
+	}
+
+	var upsertedMetrics []models.Metrics
+	for _, metric := range aggregateMetrics(batch) {
+		var upsertedMetric models.Metrics
+		err := tx.GetContext(ctx, &upsertedMetric,
+			upsertSQLite+` RETURNING id, type, delta, value, COALESCE(updated_by, '') AS updated_by`,
+			metric.ID, metric.MType, metric.Delta, metric.Value, metric.UpdatedBy,
+		)
+		if err != nil {
+			if rollBackErr := tx.Rollback(); rollBackErr != nil {
+				ss.log.Info("cannot rollback UpsertMetrics", zap.Error(rollBackErr))
+			}
+			ss.log.Info("cannot UpsertMetrics", zap.Error(err))
+
+			return *models.NewMetricCollection(), err
+		}
+		upsertedMetrics = append(upsertedMetrics, upsertedMetric)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return *models.NewMetricCollection(), err
+	}
+
+	return models.MetricCollection{Metrics: upsertedMetrics}, nil
+}
+
+// ExportMetrics выгружает все метрики для снимка
+func (ss *SQLiteStorage) ExportMetrics(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	err := ss.sql.SelectContext(ctx, &metrics,
+		"SELECT id, type, delta, value, COALESCE(updated_by, '') AS updated_by FROM metrics ORDER BY id",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot export metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+// ImportMetrics заменяет значения метрик значениями из снимка в одной транзакции,
+// counter не суммируется с текущим
+func (ss *SQLiteStorage) ImportMetrics(ctx context.Context, metrics []models.Metrics) error {
+	tx, err := ss.sql.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, metric := range metrics {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO metrics (id, type, delta, value, updated_by, updated_at)
+			VALUES (?, ?, ?, ?, NULLIF(?, ''), CAST(strftime('%s', 'now') AS INTEGER))
+			ON CONFLICT (id) DO UPDATE SET
+				type = excluded.type,
+				delta = excluded.delta,
+				value = excluded.value,
+				updated_by = excluded.updated_by,
+				updated_at = excluded.updated_at`,
+			metric.ID, metric.MType, metric.Delta, metric.Value, metric.UpdatedBy,
+		)
+		if err != nil {
+			if rollBackErr := tx.Rollback(); rollBackErr != nil {
+				ss.log.Info("cannot rollback ImportMetrics", zap.Error(rollBackErr))
+			}
+			return fmt.Errorf("cannot import metric %s: %w", metric.ID, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LastUpdated время последней записи каждой метрики с точностью до секунды
+func (ss *SQLiteStorage) LastUpdated(ctx context.Context) (map[string]time.Time, error) {
+	var rows []struct {
+		ID        string `db:"id"`
+		UpdatedAt int64  `db:"updated_at"`
+	}
+	if err := ss.sql.SelectContext(ctx, &rows, "SELECT id, updated_at FROM metrics"); err != nil {
+		return nil, fmt.Errorf("cannot read last updated: %w", err)
+	}
+
+	updated := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		updated[row.ID] = time.Unix(row.UpdatedAt, 0)
+	}
+
+	return updated, nil
+}
+
+// ExpireMetrics удаляет из names метрики, не обновлявшиеся с before, и возвращает удалённые
+func (ss *SQLiteStorage) ExpireMetrics(ctx context.Context, names []string, before time.Time) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In("DELETE FROM metrics WHERE id IN (?) AND updated_at < ? RETURNING id", names, before.Unix())
+	if err != nil {
+		return nil, err
+	}
+	var expired []string
+	if err := ss.sql.SelectContext(ctx, &expired, query, args...); err != nil {
+		return nil, fmt.Errorf("cannot expire metrics: %w", err)
+	}
+
+	return expired, nil
+}
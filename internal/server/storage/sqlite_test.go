@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func openSQLite(t *testing.T, path string) *SQLiteStorage {
+	t.Helper()
+
+	database, err := db.InitSQLite(path)
+	if errors.Is(err, db.ErrSQLiteUnavailable) {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+
+	return NewSQLiteStorage(database, testLogger{})
+}
+
+func TestSQLiteStorage_UpsertMetrics(t *testing.T) {
+	ss := openSQLite(t, ":memory:")
+	ctx := context.Background()
+
+	delta := int64(5)
+	value := 1.5
+	batch := models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: &delta},
+		{ID: "Alloc", MType: models.GaugeType, Value: &value},
+		{ID: "PollCount", MType: models.CounterType, Delta: &delta},
+	}}
+
+	upserted, err := ss.UpsertMetrics(ctx, batch)
+	require.NoError(t, err)
+	require.Len(t, upserted.Metrics, 2, "по одному значению на метрику")
+	assert.Equal(t, int64(10), *upserted.Metrics[0].Delta, "counter в пачке накапливается")
+
+	require.NoError(t, ss.SetCounterMetric(ctx, "PollCount", 1))
+	require.NoError(t, ss.SetGaugeMetric(ctx, "Alloc", 2.5))
+
+	tests := []struct {
+		name string
+		id   string
+		want models.Metrics
+	}{
+		{
+			name: "counter прибавляется к накопленному",
+			id:   "PollCount",
+			want: models.Metrics{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(11))},
+		},
+		{
+			name: "gauge заменяется",
+			id:   "Alloc",
+			want: models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: ptr(2.5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ss.GetMetric(ctx, tt.id)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = ss.GetMetric(ctx, "missing")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"Alloc: 2.5", "PollCount: 11"}, ss.GetAllMetrics(ctx))
+}
+
+func TestSQLiteStorage_ExportImport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	ctx := context.Background()
+
+	src := openSQLite(t, path)
+	require.NoError(t, src.SetCounterMetric(ctx, "PollCount", 3))
+	require.NoError(t, src.SetMetric(ctx, models.Metrics{ID: "Alloc", MType: models.GaugeType, Value: ptr(7.0), UpdatedBy: "agent-1"}))
+	require.NoError(t, src.sql.Close())
+
+	reopened := openSQLite(t, path)
+	metrics, err := reopened.ExportMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metrics{
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(7.0), UpdatedBy: "agent-1"},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(3))},
+	}, metrics, "данные и миграции переживают повторное открытие файла")
+
+	require.NoError(t, reopened.ImportMetrics(ctx, []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(1))},
+	}))
+	counter, err := reopened.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(1), counter, "импорт заменяет counter, а не суммирует")
+}
+
+func TestSQLiteStorage_ExpireMetrics(t *testing.T) {
+	ss := openSQLite(t, ":memory:")
+	ctx := context.Background()
+	require.NoError(t, ss.SetGaugeMetric(ctx, "Alloc", 1))
+	require.NoError(t, ss.SetCounterMetric(ctx, "PollCount", 1))
+
+	updated, err := ss.LastUpdated(ctx)
+	require.NoError(t, err)
+	require.Len(t, updated, 2)
+	assert.WithinDuration(t, time.Now(), updated["Alloc"], 2*time.Second)
+
+	expired, err := ss.ExpireMetrics(ctx, []string{"Alloc"}, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, expired)
+
+	expired, err = ss.ExpireMetrics(ctx, []string{"Alloc", "Missing"}, time.Now().Add(2*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc"}, expired)
+	_, err = ss.GetMetric(ctx, "Alloc")
+	assert.Error(t, err)
+}
@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/NikolosHGW/metric/internal/server/identity"
+	"go.uber.org/zap"
+)
+
+// Политики fsync журнала
+const (
+	// WALSyncAlways fsync после каждой записи, ничего не теряется при падении
+	WALSyncAlways = "always"
+	// WALSyncInterval fsync раз в интервал, при падении теряется не больше интервала
+	WALSyncInterval = "interval"
+	// WALSyncNever fsync только при сжатии и закрытии, остальное на усмотрение ОС
+	WALSyncNever = "never"
+)
+
+var (
+	ErrWALClosed         = errors.New("wal is not open")
+	ErrInvalidSyncPolicy = errors.New("unknown wal sync policy")
+)
+
+// ValidWALSync проверяет название политики fsync
+func ValidWALSync(policy string) error {
+	switch policy {
+	case WALSyncAlways, WALSyncInterval, WALSyncNever:
+		return nil
+	}
+
+	return fmt.Errorf("%w: %q", ErrInvalidSyncPolicy, policy)
+}
+
+// walFile открытый файл журнала
+type walFile interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+// WALStorage хранилище в памяти с журналом упреждающей записи: каждая принятая запись
+// сначала дописывается в журнал и только потом применяется к MemStorage.
+// Журнал хранит пачки приращений counter и значений gauge по строке JSON на пачку,
+// поэтому оборванная при падении пачка отбрасывается целиком, как и в MemStorage.
+// После сжатия в снимок журнал обнуляется. Записи пронумерованы, снимок помнит номер
+// последней вошедшей в него записи, поэтому журнал, не обнулённый из-за падения
+// сразу после записи снимка, не проигрывается поверх него второй раз
+type WALStorage struct {
+	*MemStorage
+	log          customLogger
+	file         walFile
+	path         string
+	syncPolicy   string
+	syncInterval time.Duration
+	mu           sync.Mutex
+	dirty        bool
+	// seq номер последней записи журнала
+	seq uint64
+	// checkpoint номер последней записи, вошедшей в загруженный снимок
+	checkpoint uint64
+}
+
+// walRecord строка журнала: пачка метрик, которая применяется целиком, или метрики,
+// удалённые по TTL. Запись без метрик хранит только номер, с которого продолжается
+// нумерация после обнуления журнала
+type walRecord struct {
+	Metrics []models.Metrics `json:"metrics,omitempty"`
+	Expired []string         `json:"expired,omitempty"`
+	Seq     uint64           `json:"seq,omitempty"`
+}
+
+// NewWALStorage конструктор, файл журнала открывается в Recover
+func NewWALStorage(mem *MemStorage, log customLogger, path, syncPolicy string, syncInterval time.Duration) *WALStorage {
+	return &WALStorage{
+		MemStorage:   mem,
+		log:          log,
+		path:         path,
+		syncPolicy:   syncPolicy,
+		syncInterval: syncInterval,
+	}
+}
+
+// SetCheckpoint запоминает номер последней записи журнала, вошедшей в загруженный снимок.
+// Вызывается до Recover
+func (s *WALStorage) SetCheckpoint(walSeq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoint = walSeq
+}
+
+// Recover при replay проигрывает журнал поверх уже загруженного снимка, иначе очищает его,
+// и открывает журнал на запись. Оборванная при падении последняя запись отбрасывается,
+// записи, уже вошедшие в снимок, пропускаются
+func (s *WALStorage) Recover(replay bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, last, err := s.replay(replay)
+	if err != nil {
+		return err
+	}
+	s.seq = max(s.checkpoint, last)
+	if !replay {
+		size = 0
+	}
+
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open wal: %w", err)
+	}
+	s.file = file
+	if size == 0 {
+		return s.reset()
+	}
+	if err := file.Truncate(size); err != nil {
+		return fmt.Errorf("cannot truncate wal: %w", err)
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot seek wal: %w", err)
+	}
+
+	return nil
+}
+
+// replay читает журнал, при apply применяет его записи после checkpoint к MemStorage
+// и возвращает размер целой части журнала и номер последней записи
+func (s *WALStorage) replay(apply bool) (int64, uint64, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot open wal: %w", err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			s.log.Info("cannot close wal", zap.Error(err))
+		}
+	}()
+
+	var size int64
+	var last uint64
+	var count, skipped int
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				s.log.Info("wal: dropping torn record", zap.Int64("offset", size))
+			}
+			break
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("cannot read wal: %w", err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			s.log.Info("wal: dropping corrupt tail", zap.Int64("offset", size), zap.Error(err))
+			break
+		}
+		size += int64(len(line))
+		last = max(last, record.Seq)
+		switch {
+		case !apply || len(record.Metrics)+len(record.Expired) == 0:
+		case record.Seq <= s.checkpoint:
+			skipped++
+		default:
+			for _, name := range record.Expired {
+				s.MemStorage.remove(name)
+			}
+			if len(record.Metrics) > 0 {
+				_, err := s.MemStorage.UpsertMetrics(context.Background(), models.MetricCollection{Metrics: record.Metrics})
+				if err != nil {
+					s.log.Info("wal: cannot apply record", zap.Uint64("seq", record.Seq), zap.Error(err))
+				}
+			}
+			count++
+		}
+	}
+
+	if apply {
+		s.log.Info("wal replayed", zap.String("path", s.path), zap.Int("records", count), zap.Int("in snapshot", skipped))
+	}
+
+	return size, last, nil
+}
+
+func (s *WALStorage) SetGaugeMetric(ctx context.Context, name string, value models.Gauge) error {
+	v := float64(value)
+
+	return s.SetMetric(ctx, models.Metrics{ID: name, MType: models.GaugeType, Value: &v})
+}
+
+func (s *WALStorage) SetCounterMetric(ctx context.Context, name string, value models.Counter) error {
+	delta := int64(value)
+
+	return s.SetMetric(ctx, models.Metrics{ID: name, MType: models.CounterType, Delta: &delta})
+}
+
+// SetMetric записывает метрику в журнал, затем в память
+func (s *WALStorage) SetMetric(ctx context.Context, m models.Metrics) error {
+	_, err := s.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{m}})
+
+	return err
+}
+
+// UpsertMetrics дописывает всю пачку в журнал одной строкой и применяет её к памяти
+func (s *WALStorage) UpsertMetrics(ctx context.Context, metricCollection models.MetricCollection) (models.MetricCollection, error) {
+	record := walRecord{Metrics: make([]models.Metrics, 0, len(metricCollection.Metrics))}
+	for _, m := range metricCollection.Metrics {
+		if err := validateMetric(m); err != nil {
+			return metricCollection, err
+		}
+		if m.UpdatedBy == "" {
+			m.UpdatedBy = identity.NameFromContext(ctx)
+		}
+		record.Metrics = append(record.Metrics, m)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record.Seq = s.seq + 1
+	if err := s.appendRecord(record); err != nil {
+		return metricCollection, err
+	}
+	s.seq = record.Seq
+
+	return s.MemStorage.UpsertMetrics(ctx, metricCollection)
+}
+
+// ExpireMetrics удаляет из names метрики, не обновлявшиеся с before, и возвращает удалённые.
+// Удаление сначала записывается в журнал, иначе после перезапуска метрики вернулись бы из него
+func (s *WALStorage) ExpireMetrics(ctx context.Context, names []string, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// записи в MemStorage идут под s.mu, поэтому время записи не изменится до удаления
+	updated, err := s.MemStorage.LastUpdated(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := make([]string, 0, len(names))
+	for _, name := range names {
+		if at, ok := updated[name]; ok && at.Before(before) {
+			stale = append(stale, name)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+
+	record := walRecord{Expired: stale, Seq: s.seq + 1}
+	if err := s.appendRecord(record); err != nil {
+		return nil, err
+	}
+	s.seq = record.Seq
+
+	return s.MemStorage.ExpireMetrics(ctx, stale, before)
+}
+
+// appendRecord дописывает запись в журнал строкой JSON
+func (s *WALStorage) appendRecord(record walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("cannot encode wal record: %w", err)
+	}
+
+	return s.append(append(data, '\n'))
+}
+
+// append дописывает записи в журнал. Если запись или fsync не удались, журнал
+// обрезается до прежнего конца: иначе следующие записи легли бы за оборванной строкой
+// и при восстановлении отбросились бы вместе с ней
+func (s *WALStorage) append(data []byte) error {
+	if s.file == nil {
+		return ErrWALClosed
+	}
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("cannot seek wal: %w", err)
+	}
+	if _, err := s.file.Write(data); err != nil {
+		return s.rollback(offset, fmt.Errorf("cannot write wal: %w", err))
+	}
+	if s.syncPolicy == WALSyncAlways {
+		if err := s.file.Sync(); err != nil {
+			return s.rollback(offset, fmt.Errorf("cannot sync wal: %w", err))
+		}
+		return nil
+	}
+	s.dirty = true
+
+	return nil
+}
+
+// rollback обрезает журнал до offset после неудачной записи. Если и это не удалось,
+// журнал закрывается: дописывать за оборванной строкой нельзя
+func (s *WALStorage) rollback(offset int64, cause error) error {
+	err := s.file.Truncate(offset)
+	if err == nil {
+		_, err = s.file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		err = errors.Join(cause, fmt.Errorf("cannot roll back wal: %w", err), s.file.Close())
+		s.file = nil
+		return err
+	}
+
+	return cause
+}
+
+// Compact передаёт текущее состояние и номер последней записи в snapshot и после его
+// успешной записи обнуляет журнал. Записи на время сжатия блокируются, чтобы снимок
+// и журнал не разошлись
+func (s *WALStorage) Compact(snapshot func(metrics []models.Metrics, walSeq uint64) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics, err := s.MemStorage.ExportMetrics(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := snapshot(metrics, s.seq); err != nil {
+		return err
+	}
+	if s.file != nil {
+		return s.reset()
+	}
+
+	// журнал уже закрыт при остановке, но его записи вошли в снимок
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("cannot open wal: %w", err)
+	}
+	s.file = file
+	err = s.reset()
+	s.file = nil
+
+	return errors.Join(err, file.Close())
+}
+
+// reset обнуляет журнал, оставляя в нём только номер последней записи, чтобы нумерация
+// продолжилась и после перезапуска без снимка
+func (s *WALStorage) reset() error {
+	if err := s.file.Truncate(0); err != nil {
+		return fmt.Errorf("cannot truncate wal: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("cannot seek wal: %w", err)
+	}
+	if s.seq > 0 {
+		data, err := json.Marshal(walRecord{Seq: s.seq})
+		if err != nil {
+			return fmt.Errorf("cannot encode wal record: %w", err)
+		}
+		if _, err := s.file.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("cannot write wal: %w", err)
+		}
+	}
+	s.dirty = false
+
+	return s.file.Sync()
+}
+
+// Run сбрасывает журнал на диск раз в syncInterval для политики interval
+func (s *WALStorage) Run(ctx context.Context) {
+	if s.syncPolicy != WALSyncInterval || s.syncInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Sync(); err != nil {
+				s.log.Info("cannot sync wal", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync сбрасывает на диск накопленные записи журнала
+func (s *WALStorage) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil || !s.dirty {
+		return nil
+	}
+	s.dirty = false
+
+	return s.file.Sync()
+}
+
+// Close сбрасывает журнал на диск и закрывает его
+func (s *WALStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+
+	return err
+}
+
+func validateMetric(m models.Metrics) error {
+	if m.MType == models.CounterType && m.Delta == nil {
+		return fmt.Errorf("can not SetCounterMetric: counter %s without delta", m.ID)
+	}
+	if m.MType != models.CounterType && m.Value == nil {
+		return fmt.Errorf("can not SetGaugeMetric: gauge %s without value", m.ID)
+	}
+
+	return nil
+}
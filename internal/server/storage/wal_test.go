@@ -0,0 +1,315 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/NikolosHGW/metric/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type testLogger struct{}
+
+func (testLogger) Info(string, ...zap.Field) {}
+
+func openWAL(t *testing.T, path string, replay bool) *WALStorage {
+	t.Helper()
+
+	s := NewWALStorage(NewMemStorage(), testLogger{}, path, WALSyncAlways, time.Second)
+	require.NoError(t, s.Recover(replay))
+	t.Cleanup(func() {
+		assert.NoError(t, s.Close())
+	})
+
+	return s
+}
+
+func TestWALStorage_Recover(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+
+	s := openWAL(t, path, true)
+	require.NoError(t, s.SetGaugeMetric(ctx, "Alloc", 1.5))
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+	delta := int64(4)
+	value := 2.5
+	_, err := s.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: &delta},
+		{ID: "Alloc", MType: models.GaugeType, Value: &value},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	tests := []struct {
+		name        string
+		replay      bool
+		wantGauge   models.Gauge
+		wantCounter models.Counter
+		wantErr     bool
+	}{
+		{name: "журнал проигрывается", replay: true, wantGauge: 2.5, wantCounter: 7},
+		{name: "без replay журнал очищается", replay: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored := openWAL(t, path, tt.replay)
+
+			gauge, err := restored.GetGaugeMetric(ctx, "Alloc")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantGauge, gauge)
+
+			counter, err := restored.GetCounterMetric(ctx, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCounter, counter)
+		})
+	}
+}
+
+func TestWALStorage_RecoverTornTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+
+	s := openWAL(t, path, true)
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+	require.NoError(t, s.Close())
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"PollCount","type":"coun`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	restored := openWAL(t, path, true)
+	require.NoError(t, restored.SetCounterMetric(ctx, "PollCount", 1))
+	require.NoError(t, restored.Close())
+
+	again := openWAL(t, path, true)
+	counter, err := again.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(4), counter)
+}
+
+func TestWALStorage_RecoverTornBatch(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics.json.wal")
+
+	s := openWAL(t, path, true)
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+	committed, err := os.Stat(path)
+	require.NoError(t, err)
+	_, err = s.UpsertMetrics(ctx, models.MetricCollection{Metrics: []models.Metrics{
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(5))},
+		{ID: "Alloc", MType: models.GaugeType, Value: ptr(1.5)},
+		{ID: "PollCount", MType: models.CounterType, Delta: ptr(int64(7))},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	full, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// падение могло оборвать запись пачки на любом байте
+	for cut := committed.Size() + 1; cut < int64(len(full)); cut++ {
+		torn := filepath.Join(dir, "torn.wal")
+		require.NoError(t, os.WriteFile(torn, full[:cut], 0666))
+
+		restored := NewWALStorage(NewMemStorage(), testLogger{}, torn, WALSyncAlways, time.Second)
+		require.NoError(t, restored.Recover(true))
+
+		counter, err := restored.GetCounterMetric(ctx, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, models.Counter(3), counter, "обрыв на байте %d", cut)
+		_, err = restored.GetMetric(ctx, "Alloc")
+		assert.Error(t, err, "обрыв на байте %d: часть пачки не применяется", cut)
+		require.NoError(t, restored.Close())
+	}
+}
+
+func TestWALStorage_RejectsInvalidMetric(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	s := openWAL(t, path, true)
+
+	err := s.SetMetric(context.Background(), models.Metrics{ID: "PollCount", MType: models.CounterType})
+	assert.Error(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestDiskStorage_CompactWAL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := snapshotPath + ".wal"
+
+	s := openWAL(t, walPath, true)
+	disk := NewDiskStorage(s.MemStorage, testLogger{}, snapshotPath)
+	disk.SetWAL(s)
+
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+	disk.WriteToDisk()
+
+	data, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "PollCount", "после сжатия в журнале нет записей")
+
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 2))
+	require.NoError(t, s.Close())
+
+	restored := NewWALStorage(NewMemStorage(), testLogger{}, walPath, WALSyncAlways, time.Second)
+	NewDiskStorage(restored.MemStorage, testLogger{}, snapshotPath).WriteToStorage()
+	require.NoError(t, restored.Recover(true))
+	defer func() {
+		assert.NoError(t, restored.Close())
+	}()
+
+	counter, err := restored.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(5), counter)
+}
+
+// restoreWAL загружает снимок и проигрывает поверх него журнал, как при старте сервера
+func restoreWAL(t *testing.T, snapshotPath, walPath string, replay bool) *WALStorage {
+	t.Helper()
+
+	restored := NewWALStorage(NewMemStorage(), testLogger{}, walPath, WALSyncAlways, time.Second)
+	disk := NewDiskStorage(restored.MemStorage, testLogger{}, snapshotPath)
+	disk.SetWAL(restored)
+	if replay {
+		disk.WriteToStorage()
+	}
+	require.NoError(t, restored.Recover(replay))
+	t.Cleanup(func() {
+		assert.NoError(t, restored.Close())
+	})
+
+	return restored
+}
+
+func TestDiskStorage_CompactWALCrashBeforeTruncate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := snapshotPath + ".wal"
+
+	s := openWAL(t, walPath, true)
+	disk := NewDiskStorage(s.MemStorage, testLogger{}, snapshotPath)
+	disk.SetWAL(s)
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+
+	// падение после записи снимка, но до обнуления журнала
+	journal, err := os.ReadFile(walPath)
+	require.NoError(t, err)
+	disk.WriteToDisk()
+	require.NoError(t, s.Close())
+	require.NoError(t, os.WriteFile(walPath, journal, 0666))
+
+	restored := restoreWAL(t, snapshotPath, walPath, true)
+	counter, err := restored.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(3), counter, "записи из снимка не проигрываются второй раз")
+
+	require.NoError(t, restored.SetCounterMetric(ctx, "PollCount", 2))
+	require.NoError(t, restored.Close())
+	again := restoreWAL(t, snapshotPath, walPath, true)
+	counter, err = again.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(5), counter, "новые записи продолжают нумерацию после снимка")
+}
+
+func TestWALStorage_SeqSurvivesRecoverWithoutReplay(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "metrics.json")
+	walPath := snapshotPath + ".wal"
+
+	s := openWAL(t, walPath, true)
+	disk := NewDiskStorage(s.MemStorage, testLogger{}, snapshotPath)
+	disk.SetWAL(s)
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+	disk.WriteToDisk()
+	require.NoError(t, s.Close())
+
+	fresh := restoreWAL(t, snapshotPath, walPath, false)
+	require.NoError(t, fresh.SetGaugeMetric(ctx, "Alloc", 1.5))
+	require.NoError(t, fresh.Close())
+
+	restored := restoreWAL(t, snapshotPath, walPath, true)
+	gauge, err := restored.GetGaugeMetric(ctx, "Alloc")
+	require.NoError(t, err, "запись после старта без снимка не считается вошедшей в старый снимок")
+	assert.Equal(t, models.Gauge(1.5), gauge)
+}
+
+// shortWriteFile файл журнала, запись в который обрывается на середине, как при нехватке места
+type shortWriteFile struct {
+	walFile
+	fail bool
+}
+
+func (f *shortWriteFile) Write(p []byte) (int, error) {
+	if !f.fail {
+		return f.walFile.Write(p)
+	}
+	n, _ := f.walFile.Write(p[:len(p)/2])
+
+	return n, syscall.ENOSPC
+}
+
+func TestWALStorage_AppendRollback(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+
+	s := openWAL(t, path, true)
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+
+	file := &shortWriteFile{walFile: s.file, fail: true}
+	s.file = file
+	assert.ErrorIs(t, s.SetCounterMetric(ctx, "PollCount", 5), syscall.ENOSPC)
+
+	file.fail = false
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 1))
+	require.NoError(t, s.Close())
+
+	restored := openWAL(t, path, true)
+	counter, err := restored.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(4), counter, "запись после оборванной не потеряна")
+}
+
+func TestWALStorage_ExpireMetrics(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+
+	s := openWAL(t, path, true)
+	require.NoError(t, s.SetGaugeMetric(ctx, "Alloc", 1.5))
+	require.NoError(t, s.SetCounterMetric(ctx, "PollCount", 3))
+
+	expired, err := s.ExpireMetrics(ctx, []string{"Alloc", "Unknown"}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Alloc"}, expired)
+
+	expired, err = s.ExpireMetrics(ctx, []string{"PollCount"}, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, expired, "свежая метрика не удаляется")
+	require.NoError(t, s.Close())
+
+	restored := openWAL(t, path, true)
+	_, err = restored.GetMetric(ctx, "Alloc")
+	assert.Error(t, err, "удалённая метрика не возвращается из журнала")
+	counter, err := restored.GetCounterMetric(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, models.Counter(3), counter)
+}
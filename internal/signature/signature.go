@@ -0,0 +1,142 @@
+// Пакет signature подписывает запросы HMAC-SHA256 вместе с меткой времени и nonce
+// и проверяет подписи на сервере с защитой от повторной отправки
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Имена заголовков HTTP. В метаданных gRPC используются те же имена в нижнем регистре
+const (
+	HashHeader      = "HashSHA256"
+	TimestampHeader = "X-Signature-Timestamp"
+	NonceHeader     = "X-Signature-Nonce"
+
+	DefaultWindow = 5 * time.Minute
+
+	nonceSize     = 16
+	evictInterval = time.Second
+)
+
+var (
+	ErrMissingParams  = errors.New("signature timestamp and nonce are required")
+	ErrInvalidTime    = errors.New("invalid signature timestamp")
+	ErrStaleTimestamp = errors.New("signature timestamp is outside of the allowed window")
+	ErrReplayedNonce  = errors.New("signature nonce has already been used")
+	ErrHashMismatch   = errors.New("signature hash mismatch")
+)
+
+// Params параметры подписи, передаваемые вместе с запросом
+type Params struct {
+	Hash      string
+	Timestamp string
+	Nonce     string
+}
+
+// Sign подписывает тело запроса с новой меткой времени и случайным nonce
+func Sign(key string, body []byte) (Params, error) {
+	buf := make([]byte, nonceSize)
+	if _, err := rand.Read(buf); err != nil {
+		return Params{}, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+
+	p := Params{
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:     hex.EncodeToString(buf),
+	}
+	p.Hash = Hash(key, body, p.Timestamp, p.Nonce)
+
+	return p, nil
+}
+
+// Hash считает HMAC-SHA256 от метки времени, nonce и тела запроса
+func Hash(key string, body []byte, timestamp, nonce string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(timestamp))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(nonce))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verifier проверяет подписи запросов и запоминает использованные nonce на время окна
+type Verifier struct {
+	lastEvict time.Time
+	now       func() time.Time
+	nonces    map[string]time.Time
+	key       string
+	window    time.Duration
+	mu        sync.Mutex
+}
+
+// NewVerifier конструктор, window допустимое расхождение метки времени с часами сервера
+func NewVerifier(key string, window time.Duration) *Verifier {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	return &Verifier{
+		now:    time.Now,
+		nonces: make(map[string]time.Time),
+		key:    key,
+		window: window,
+	}
+}
+
+// Verify проверяет подпись тела запроса. Nonce запоминается только после успешной проверки хеша,
+// чтобы неподписанные запросы не могли заполнить кеш
+func (v *Verifier) Verify(body []byte, p Params) error {
+	if p.Timestamp == "" || p.Nonce == "" {
+		return ErrMissingParams
+	}
+
+	unix, err := strconv.ParseInt(p.Timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTime
+	}
+	ts := time.Unix(unix, 0)
+
+	now := v.now()
+	if ts.Before(now.Add(-v.window)) || ts.After(now.Add(v.window)) {
+		return ErrStaleTimestamp
+	}
+
+	if !hmac.Equal([]byte(Hash(v.key, body, p.Timestamp, p.Nonce)), []byte(p.Hash)) {
+		return ErrHashMismatch
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.evict(now)
+	if _, seen := v.nonces[p.Nonce]; seen {
+		return ErrReplayedNonce
+	}
+	// после ts + window запрос с этой меткой времени и так будет отклонён
+	v.nonces[p.Nonce] = ts.Add(v.window)
+
+	return nil
+}
+
+func (v *Verifier) evict(now time.Time) {
+	if now.Sub(v.lastEvict) < evictInterval {
+		return
+	}
+	v.lastEvict = now
+
+	for nonce, expiresAt := range v.nonces {
+		if now.After(expiresAt) {
+			delete(v.nonces, nonce)
+		}
+	}
+}
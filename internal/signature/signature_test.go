@@ -0,0 +1,124 @@
+package signature
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifier_Verify(t *testing.T) {
+	const key = "secret"
+	body := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+
+	signed := func(t *testing.T, ts time.Time, nonce string) Params {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		return Params{
+			Hash:      Hash(key, body, timestamp, nonce),
+			Timestamp: timestamp,
+			Nonce:     nonce,
+		}
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		params      func(t *testing.T) Params
+		expectedErr error
+	}{
+		{
+			name: "Корректная подпись",
+			params: func(t *testing.T) Params {
+				p, err := Sign(key, body)
+				require.NoError(t, err)
+				return p
+			},
+		},
+		{
+			name: "Подпись без метки времени и nonce",
+			params: func(t *testing.T) Params {
+				return Params{Hash: "abc"}
+			},
+			expectedErr: ErrMissingParams,
+		},
+		{
+			name: "Метка времени не число",
+			params: func(t *testing.T) Params {
+				return Params{Hash: "abc", Timestamp: "yesterday", Nonce: "n"}
+			},
+			expectedErr: ErrInvalidTime,
+		},
+		{
+			name: "Устаревшая метка времени",
+			params: func(t *testing.T) Params {
+				return signed(t, now.Add(-10*time.Minute), "old")
+			},
+			expectedErr: ErrStaleTimestamp,
+		},
+		{
+			name: "Метка времени из будущего",
+			params: func(t *testing.T) Params {
+				return signed(t, now.Add(10*time.Minute), "future")
+			},
+			expectedErr: ErrStaleTimestamp,
+		},
+		{
+			name: "Подделанная метка времени",
+			params: func(t *testing.T) Params {
+				p := signed(t, now, "forged")
+				p.Timestamp = strconv.FormatInt(now.Unix()+1, 10)
+				return p
+			},
+			expectedErr: ErrHashMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(key, DefaultWindow)
+			err := v.Verify(body, tt.params(t))
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifier_Replay(t *testing.T) {
+	body := []byte("payload")
+	v := NewVerifier("secret", time.Minute)
+
+	p, err := Sign("secret", body)
+	require.NoError(t, err)
+
+	require.NoError(t, v.Verify(body, p))
+	assert.ErrorIs(t, v.Verify(body, p), ErrReplayedNonce)
+
+	fresh, err := Sign("secret", body)
+	require.NoError(t, err)
+	assert.NoError(t, v.Verify(body, fresh))
+}
+
+func TestVerifier_EvictsExpiredNonces(t *testing.T) {
+	body := []byte("payload")
+	v := NewVerifier("secret", time.Minute)
+	now := time.Now()
+	v.now = func() time.Time { return now }
+
+	p, err := Sign("secret", body)
+	require.NoError(t, err)
+	require.NoError(t, v.Verify(body, p))
+
+	now = now.Add(2 * time.Minute)
+	fresh, err := Sign("secret", body)
+	require.NoError(t, err)
+	fresh.Timestamp = strconv.FormatInt(now.Unix(), 10)
+	fresh.Hash = Hash("secret", body, fresh.Timestamp, fresh.Nonce)
+	require.NoError(t, v.Verify(body, fresh))
+
+	assert.NotContains(t, v.nonces, p.Nonce)
+}
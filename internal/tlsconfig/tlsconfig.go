@@ -0,0 +1,149 @@
+// Пакет tlsconfig собирает *tls.Config для сервера и агента из путей к сертификатам
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const DefaultMinVersion = "1.2"
+
+// Options параметры TLS, общие для сервера и агента.
+// На сервере CAFile включает mTLS: клиент обязан предъявить сертификат, подписанный этим CA.
+// На агенте CAFile используется для проверки сертификата сервера, а CertFile/KeyFile
+// предъявляются серверу как клиентский сертификат.
+type Options struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string
+	MinVersion string
+	ServerName string
+}
+
+// Enabled возвращает true, если задан хотя бы один параметр TLS
+func (o Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.CAFile != ""
+}
+
+// MutualTLS возвращает true, если сервер должен требовать клиентский сертификат
+func (o Options) MutualTLS() bool {
+	return o.CAFile != ""
+}
+
+// NewServerConfig конфиг TLS для сервера, nil если TLS не настроен
+func NewServerConfig(opts Options) (*tls.Config, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("tls: server certificate and key are required")
+	}
+
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: cannot load server key pair: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if opts.MutualTLS() {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// NewClientConfig конфиг TLS для агента, nil если TLS не настроен
+func NewClientConfig(opts Options) (*tls.Config, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+
+	minVersion, err := ParseVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: opts.ServerName,
+	}
+
+	if opts.CAFile != "" {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: cannot load client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ParseVersion переводит строку вида "1.2" в константу tls.VersionTLS12
+func ParseVersion(version string) (uint16, error) {
+	switch version {
+	case "", DefaultMinVersion:
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("tls: unsupported min version %q, expected 1.2 or 1.3", version)
+}
+
+// PeerName возвращает имя клиента из проверенного сертификата: CommonName,
+// а при его отсутствии первый DNS SAN
+func PeerName(state tls.ConnectionState) (string, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	leaf := state.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName, true
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0], true
+	}
+
+	return "", false
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tls: cannot read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,119 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/NikolosHGW/metric/internal/tlsconfig/tlstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{version: "", want: tls.VersionTLS12},
+		{version: "1.2", want: tls.VersionTLS12},
+		{version: "1.3", want: tls.VersionTLS13},
+		{version: "1.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewServerConfig(t *testing.T) {
+	files := tlstest.Generate(t, t.TempDir(), "agent-1")
+
+	cfg, err := NewServerConfig(Options{})
+	assert.NoError(t, err)
+	assert.Nil(t, cfg, "без настроек TLS выключен")
+
+	_, err = NewServerConfig(Options{CertFile: files.ServerCert})
+	assert.Error(t, err, "без ключа сервер не запускается")
+
+	cfg, err = NewServerConfig(Options{CertFile: files.ServerCert, KeyFile: files.ServerKey, MinVersion: "1.3"})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	cfg, err = NewServerConfig(Options{CertFile: files.ServerCert, KeyFile: files.ServerKey, CAFile: files.CA})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+
+	_, err = NewServerConfig(Options{CertFile: files.ServerCert, KeyFile: files.ServerKey, CAFile: files.ServerKey})
+	assert.Error(t, err, "в бандле CA нет сертификатов")
+}
+
+func TestMutualTLS_HTTP(t *testing.T) {
+	files := tlstest.Generate(t, t.TempDir(), "agent-1")
+
+	serverConfig, err := NewServerConfig(Options{CertFile: files.ServerCert, KeyFile: files.ServerKey, CAFile: files.CA})
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := PeerName(*r.TLS)
+		assert.True(t, ok)
+		_, err := io.WriteString(w, name)
+		assert.NoError(t, err)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	t.Run("Клиент с сертификатом", func(t *testing.T) {
+		clientConfig, err := NewClientConfig(Options{CertFile: files.ClientCert, KeyFile: files.ClientKey, CAFile: files.CA})
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		defer func() {
+			assert.NoError(t, resp.Body.Close())
+		}()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "agent-1", string(body))
+	})
+
+	t.Run("Клиент без сертификата", func(t *testing.T) {
+		clientConfig, err := NewClientConfig(Options{CAFile: files.CA})
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			assert.NoError(t, resp.Body.Close())
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("Клиент не доверяет серверу", func(t *testing.T) {
+		other := tlstest.Generate(t, t.TempDir(), "agent-1")
+		clientConfig, err := NewClientConfig(Options{CertFile: files.ClientCert, KeyFile: files.ClientKey, CAFile: other.CA})
+		require.NoError(t, err)
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			assert.NoError(t, resp.Body.Close())
+		}
+		assert.Error(t, err)
+	})
+}